@@ -2,23 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-	"os/signal"
 	"syscall"
+	"time"
 
 	"go.uber.org/multierr"
+	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/maxm86545/concurrency_go/internal/cli"
+	"github.com/maxm86545/concurrency_go/internal/config"
 	"github.com/maxm86545/concurrency_go/internal/database"
 	"github.com/maxm86545/concurrency_go/internal/database/compute"
 	"github.com/maxm86545/concurrency_go/internal/database/storage"
 	"github.com/maxm86545/concurrency_go/internal/logger"
+	"github.com/maxm86545/concurrency_go/internal/network"
+	"github.com/maxm86545/concurrency_go/internal/shutdown"
 )
 
-const maxCommandLen = 128
-
 func main() {
 	if err := run(); err != nil {
 		panic(err)
@@ -26,31 +30,170 @@ func main() {
 }
 
 func run() (errReturned error) {
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	configPath := flag.String("config", "", "YAML configuration file, defaults are used when empty")
+	address := flag.String("address", "", "TCP address to serve queries on, overrides network.address from the config")
+	queryTimeout := flag.Duration("query-timeout", 0, "maximum duration of a single query, 0 disables the limit")
+	queryLogPath := flag.String("query-log", "", "file to record every query but per-connection settings such as DEFAULTTTL; feed it back on stdin to replay it")
+	noReply := flag.Bool("no-reply", false, "do not answer successful SETs and DELs on stdin; TCP clients opt in with NOREPLY ON")
+	emptyLineMarker := flag.String("empty-line-marker", "", "what to answer empty lines over TCP with, empty ignores them")
+	multiQuery := flag.Bool("multi-query", false, "run each line as queries separated by semicolons, answering each in turn")
+	statusLine := flag.Bool("status-line", false, "prefix every response with a status line, as pkg/client expects")
+	sweepInterval := flag.Duration("sweep-interval", time.Second, "how often expired keys are reclaimed, 0 disables the sweeper")
+	maxTTL := flag.Duration("max-ttl", 0, "longest TTL EXPIRE and ROTATE may set, 0 disables the limit")
+	rejectLongTTL := flag.Bool("reject-long-ttl", false, "reject TTLs above --max-ttl instead of shortening them")
+	indexPrefix := flag.String("index-prefix", "", "index the keys with this prefix by value for INDEXGET, empty disables the index")
+	appendSeparator := flag.String("append-separator", ",", "what APPENDSEP inserts between values")
+	findValue := flag.Bool("enable-findvalue", false, "allow FINDVALUE, which scans every value")
+	expensiveQueryLimit := flag.Int("expensive-query-limit", 0, "how many GETPREFIX, KEYS and FINDVALUE queries may run at once, others fail with busy; 0 disables the limit")
+	keyEncoding := flag.String("key-encoding", "raw", "how GETPREFIX and FINDVALUE write non-printable keys: raw, hex or base64")
+	selfTest := flag.Bool("selftest", false, "exercise storage, the query log and the logger before serving, failing fast on errors")
+	seedPath := flag.String("seed-file", "", "file of newline-delimited SET queries to load on startup")
+	snapshotPath := flag.String("snapshot-file", "", "file to load the data from on startup and to snapshot it to")
+	snapshotInterval := flag.Duration("snapshot-interval", time.Minute, "how often to snapshot the data, 0 only on shutdown")
+	flag.Parse()
+
+	// A second signal skips the drain and the final snapshot, like a second Ctrl-C is expected to.
+	ctx, stop := shutdown.NotifyContext(context.Background(), func(sig os.Signal) {
+		fmt.Fprintf(os.Stderr, "received %s during shutdown, exiting immediately\n", sig)
+		os.Exit(shutdown.ExitCode(sig))
+	}, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	log, err := logger.MakeFileLogger("app.log")
+	cfg := config.Default()
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+	}
+
+	if *address != "" {
+		cfg.Network.Address = *address
+	}
+
+	log, err := makeLogger(cfg.Logging)
 	if err != nil {
 		return fmt.Errorf("create logger: %w", err)
 	}
-	defer multierr.AppendFunc(&errReturned, log.Sync)
+	defer multierr.AppendFunc(&errReturned, func() error { return logger.Sync(log) })
+
+	keyEncodings := map[string]database.KeyEncoding{
+		"raw":    database.KeyEncodingRaw,
+		"hex":    database.KeyEncodingHex,
+		"base64": database.KeyEncodingBase64,
+	}
+
+	encoding, ok := keyEncodings[*keyEncoding]
+	if !ok {
+		return fmt.Errorf("unknown key encoding %q", *keyEncoding)
+	}
+
+	dbOpts := []database.Option{
+		database.WithAppendSeparator([]byte(*appendSeparator)),
+		database.WithFindValue(*findValue),
+		database.WithKeyEncoding(encoding),
+		database.WithExpensiveQueryLimit(*expensiveQueryLimit),
+		database.WithMaxResponseSize(cfg.Network.MaxResponseSize),
+	}
+	if *queryLogPath != "" {
+		queryLog, err := os.OpenFile(*queryLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("open query log: %w", err)
+		}
+		defer multierr.AppendInvoke(&errReturned, multierr.Close(queryLog))
+
+		dbOpts = append(dbOpts, database.WithQueryLog(queryLog))
+	}
+
+	maxTTLPolicy := storage.MaxTTLClamp
+	if *rejectLongTTL {
+		maxTTLPolicy = storage.MaxTTLReject
+	}
+
+	storeOpts := []storage.Option{
+		storage.WithSweepInterval(*sweepInterval),
+		storage.WithMaxTTL(*maxTTL, maxTTLPolicy),
+	}
+	if *indexPrefix != "" {
+		storeOpts = append(storeOpts, storage.WithIndex([]byte(*indexPrefix)))
+	}
+
+	store := storage.NewStorage(storeOpts...)
+	defer multierr.AppendInvoke(&errReturned, multierr.Close(store))
 
 	db := database.NewDatabase(
 		log,
-		compute.NewCompute(maxCommandLen),
-		storage.NewStorage(),
+		compute.NewCompute(cfg.Compute.MaxCommandLength, computeOpts(cfg.Compute)...),
+		store,
+		dbOpts...,
 	)
 
+	// The self-test writes and deletes a reserved key, so it runs while the store is still empty.
+	if *selfTest {
+		if err := db.SelfTest(ctx); err != nil {
+			return err
+		}
+
+		log.Info("self-test passed")
+		if err := logger.Sync(log); err != nil {
+			return fmt.Errorf("self-test: logger: %w", err)
+		}
+	}
+
+	if *snapshotPath != "" {
+		if err := loadSnapshot(store, *snapshotPath); err != nil {
+			return err
+		}
+	}
+
+	if *seedPath != "" {
+		loaded, err := seed(ctx, db, *seedPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "seeded %d keys from %s\n", loaded, *seedPath)
+	}
+
 	cliApp, err := cli.NewCliApp(
 		os.Stdin,
 		os.Stdout,
 		os.Stderr,
 		db,
+		cli.WithQueryTimeout(*queryTimeout),
+		cli.WithNoReply(*noReply),
+		cli.WithStatusLine(*statusLine),
+		cli.WithMultiQuery(*multiQuery),
+		cli.WithSkipComments(true),
 	)
 	if err != nil {
 		return fmt.Errorf("create cli app: %w", err)
 	}
 
+	var server *network.TCPServer
+	if cfg.Network.Address != "" {
+		connOpts := []cli.Option{
+			cli.WithQueryTimeout(*queryTimeout),
+			cli.WithStatusLine(*statusLine),
+			cli.WithMultiQuery(*multiQuery),
+			cli.WithSkipComments(true),
+		}
+		if *emptyLineMarker != "" {
+			connOpts = append(connOpts, cli.WithEmptyLineMarker([]byte(*emptyLineMarker)))
+		}
+
+		server, err = network.NewTCPServer(
+			cfg.Network.Address,
+			db,
+			log,
+			network.WithAppOptions(connOpts...),
+			network.WithMaxConnections(cfg.Network.MaxConnections),
+		)
+		if err != nil {
+			return fmt.Errorf("create tcp server: %w", err)
+		}
+	}
+
 	eg, egCtx := errgroup.WithContext(ctx)
 
 	err = cliApp.WriteHelp()
@@ -62,5 +205,117 @@ func run() (errReturned error) {
 		return cliApp.Run(egCtx)
 	})
 
-	return eg.Wait()
+	if server != nil {
+		eg.Go(func() error {
+			return server.Run(egCtx)
+		})
+	}
+
+	if *snapshotPath != "" && *snapshotInterval > 0 {
+		eg.Go(func() error {
+			ticker := time.NewTicker(*snapshotInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					if err := writeSnapshot(store, *snapshotPath); err != nil {
+						log.Warn("periodic snapshot failed", zap.Error(err))
+					}
+				case <-egCtx.Done():
+					return nil
+				}
+			}
+		})
+	}
+
+	err = eg.Wait()
+
+	// The final snapshot is taken once nothing can write anymore.
+	if *snapshotPath != "" {
+		err = multierr.Append(err, writeSnapshot(store, *snapshotPath))
+	}
+
+	return err
+}
+
+func loadSnapshot(store *storage.Storage, path string) (errReturned error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+	defer multierr.AppendInvoke(&errReturned, multierr.Close(f))
+
+	if err := store.LoadSnapshot(f); err != nil {
+		return fmt.Errorf("load snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// writeSnapshot replaces the snapshot at path through a temporary file, so a crash leaves
+// either the old snapshot or the new one.
+func writeSnapshot(store *storage.Storage, path string) error {
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+
+	err = store.Snapshot(f)
+	err = multierr.Append(err, f.Sync())
+	err = multierr.Append(err, f.Close())
+	if err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func computeOpts(cfg config.ComputeConfig) []compute.Option {
+	opts := make([]compute.Option, 0, len(cfg.ArgLimits)+2)
+	opts = append(opts,
+		compute.WithMaxArgLens(cfg.MaxKeyLength, cfg.MaxValueLength),
+		compute.WithStrict(cfg.Strict),
+	)
+	for command, limits := range cfg.ArgLimits {
+		opts = append(opts, compute.WithArgLimits(command, compute.ArgLimits{
+			MaxKeyLen:   limits.MaxKeyLength,
+			MaxValueLen: limits.MaxValueLength,
+		}))
+	}
+
+	return opts
+}
+
+func makeLogger(cfg config.LoggingConfig) (*zap.Logger, error) {
+	if cfg.Output == config.LogOutputStdout {
+		return logger.MakeConsoleLogger(cfg.Level)
+	}
+
+	return logger.MakeFileLogger(cfg.Output, cfg.Level)
+}
+
+func seed(ctx context.Context, db *database.Database, path string) (loaded int, errReturned error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open seed file: %w", err)
+	}
+	defer multierr.AppendInvoke(&errReturned, multierr.Close(f))
+
+	loaded, err = db.Seed(ctx, f)
+	if err != nil {
+		return loaded, fmt.Errorf("load seed file: %w", err)
+	}
+
+	return loaded, nil
 }
@@ -2,21 +2,30 @@ package cli
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"time"
+
+	"go.uber.org/multierr"
 
 	"github.com/maxm86545/concurrency_go/internal/database"
 )
 
 var (
 	resultOK       = []byte("OK")
+	resultStatusOK = []byte("+OK")
 	resultNotFound = []byte("NOT_FOUND")
-	newLine        = []byte{'\n'}
+	errNotFound    = []byte("ERR not found")
+	errBusy        = []byte("ERR busy")
+	commentPrefix  = []byte{'#'}
 )
 
 type iQueryExecutor interface {
 	Exec(ctx context.Context, rawQuery []byte) database.ExecResult
+	ExecMulti(ctx context.Context, rawQuery []byte) []database.ExecResult
 }
 
 type App struct {
@@ -24,76 +33,268 @@ type App struct {
 	stdout io.Writer
 	stderr io.Writer
 	qe     iQueryExecutor
+
+	// out and errOut collect a response so that it reaches stdout or stderr in one write.
+	out    *bufio.Writer
+	errOut *bufio.Writer
+
+	split                bufio.SplitFunc
+	maxQueryLen          int
+	queryTimeout         time.Duration
+	continueOnWriteError bool
+	statusLine           bool
+	notFoundAsError      bool
+	skipComments         bool
+	skipEmptyLines       bool
+	emptyLineMarker      []byte
+	noReply              bool
+	multiQuery           bool
 }
 
+type Option func(cli *App)
+
 func NewCliApp(
 	stdin io.Reader,
 	stdout io.Writer,
 	stderr io.Writer,
 	qe iQueryExecutor,
+	opts ...Option,
 ) (*App, error) {
-	return &App{
-		stdin:  stdin,
-		stdout: stdout,
-		stderr: stderr,
-		qe:     qe,
-	}, nil
+	cli := &App{
+		stdin:       stdin,
+		stdout:      stdout,
+		stderr:      stderr,
+		qe:          qe,
+		out:         bufio.NewWriter(stdout),
+		errOut:      bufio.NewWriter(stderr),
+		split:       bufio.ScanLines,
+		maxQueryLen: bufio.MaxScanTokenSize,
+	}
+
+	for _, opt := range opts {
+		opt(cli)
+	}
+
+	return cli, nil
+}
+
+func WithContinueOnWriteError(continueOnWriteError bool) Option {
+	return func(cli *App) {
+		cli.continueOnWriteError = continueOnWriteError
+	}
+}
+
+func WithDelimiter(delim byte) Option {
+	return func(cli *App) {
+		cli.split = splitOn(delim)
+	}
+}
+
+func WithMaxQueryLen(maxQueryLen int) Option {
+	return func(cli *App) {
+		cli.maxQueryLen = maxQueryLen
+	}
+}
+
+func WithQueryTimeout(queryTimeout time.Duration) Option {
+	return func(cli *App) {
+		cli.queryTimeout = queryTimeout
+	}
+}
+
+func WithSkipComments(skipComments bool) Option {
+	return func(cli *App) {
+		cli.skipComments = skipComments
+	}
+}
+
+// WithSkipEmptyLines leaves queries of nothing but whitespace unanswered instead of passing
+// them on to be rejected as empty.
+func WithSkipEmptyLines(skipEmptyLines bool) Option {
+	return func(cli *App) {
+		cli.skipEmptyLines = skipEmptyLines
+	}
+}
+
+// WithEmptyLineMarker answers queries of nothing but whitespace with marker on stdout; it wins
+// over WithSkipEmptyLines. A nil marker turns it off.
+func WithEmptyLineMarker(marker []byte) Option {
+	return func(cli *App) {
+		cli.emptyLineMarker = marker
+	}
+}
+
+// WithStatusLine starts every session with status lines, as if it began with STATUSLINE ON:
+// answers with data are preceded by a +OK line and OK becomes +OK.
+func WithStatusLine(statusLine bool) Option {
+	return func(cli *App) {
+		cli.statusLine = statusLine
+	}
+}
+
+// WithNoReply starts every session in no-reply mode, as if it began with NOREPLY ON: successful
+// SETs and DELs are not answered, while errors and every other query still are.
+func WithNoReply(noReply bool) Option {
+	return func(cli *App) {
+		cli.noReply = noReply
+	}
+}
+
+// WithMultiQuery runs each line as queries separated by semicolons, answering every query in
+// turn; semicolons inside quoted arguments do not separate queries.
+func WithMultiQuery(multiQuery bool) Option {
+	return func(cli *App) {
+		cli.multiQuery = multiQuery
+	}
 }
 
+func WithNotFoundAsError(notFoundAsError bool) Option {
+	return func(cli *App) {
+		cli.notFoundAsError = notFoundAsError
+	}
+}
+
+// Run answers queries from stdin until it is exhausted, ctx is done or a write fails. When it
+// returns with input left, it closes stdin if that is an io.Closer, so that the goroutine
+// reading it stops too.
 func (cli *App) Run(ctx context.Context) error {
+	var writeErrs error
+
+	ctx = database.WithSession(ctx)
+	if cli.noReply {
+		// The session was just created, so this cannot fail.
+		_ = database.SetNoReply(ctx, true)
+	}
+	if cli.statusLine {
+		_ = database.SetStatusLine(ctx, true)
+	}
+
 	scanner := bufio.NewScanner(cli.stdin)
+	scanner.Split(cli.split)
+	scanner.Buffer(nil, cli.maxQueryLen)
 
-	for scanner.Scan() {
-		query := scanner.Bytes()
-		r := cli.qe.Exec(ctx, query)
+	queries := make(chan []byte)
+	processed := make(chan struct{})
+	stop := make(chan struct{})
+	readerDone := make(chan struct{})
+	defer func() {
+		close(stop)
 
-		if r.Err != nil {
-			if _, wError := cli.stderr.Write([]byte(r.Err.Error())); wError != nil {
-				return fmt.Errorf("writing to stderr: %v", wError)
+		// A reader blocked in Scan only returns once its input is closed.
+		select {
+		case <-readerDone:
+		default:
+			if closer, ok := cli.stdin.(io.Closer); ok {
+				_ = closer.Close()
 			}
-			if _, wError := cli.stderr.Write(newLine); wError != nil {
-				return fmt.Errorf("writing to stderr: %v", wError)
+		}
+	}()
+
+	// The scanner reuses its buffer, so the reader waits until each query is processed.
+	go func() {
+		defer close(readerDone)
+		defer close(queries)
+
+		for scanner.Scan() {
+			select {
+			case queries <- scanner.Bytes():
+			case <-stop:
+				return
 			}
 
-			continue
+			select {
+			case <-processed:
+			case <-stop:
+				return
+			}
 		}
+	}()
 
-		var data []byte
-		switch r.Status {
-		case database.StatusOkNoData:
-			data = resultOK
-		case database.StatusNotFound:
-			data = resultNotFound
-		default:
-			data = r.Data
+	for {
+		var query []byte
+
+		select {
+		case <-ctx.Done():
+			return writeErrs
+		case q, ok := <-queries:
+			if !ok {
+				return multierr.Append(writeErrs, cli.scanErr(scanner))
+			}
+
+			query = q
 		}
 
-		if _, wError := cli.stdout.Write(data); wError != nil {
-			return fmt.Errorf("writing to stdout: %v", wError)
+		if ctx.Err() != nil {
+			return writeErrs
 		}
 
-		if _, wError := cli.stdout.Write(newLine); wError != nil {
-			return fmt.Errorf("writing to stdout: %v", wError)
+		if err := cli.handle(ctx, query); err != nil {
+			if !cli.continueOnWriteError {
+				return err
+			}
+
+			writeErrs = multierr.Append(writeErrs, err)
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("scan: %v", err)
+		processed <- struct{}{}
 	}
-
-	return nil
 }
 
 func (cli *App) WriteHelp() error {
 	data := []byte("\nHELP:\n" +
-		"query = set_command | get_command | del_command\n" +
-		"set_command = \"SET\" argument argument\n" +
+		"query = set_command | get_command | getrange_command | del_command | getdefault_command\n" +
+		"      | setimmutable_command | unlock_command | debug_command | help_command | latency_command\n" +
+		"      | stats_command | setmax_command | setmin_command | getprefix_command | exists_command\n" +
+		"      | incr_command | increx_command | decr_command | mset_command | mget_command | expire_command\n" +
+		"      | ttl_command | delif_command | diff_command | rotate_command | explain_command\n" +
+		"      | appendsep_command | findvalue_command | defaultttl_command | echo_command\n" +
+		"      | keys_command | flush_command | dbsize_command | indexget_command | noreply_command\n" +
+		"      | statusline_command\n" +
+		"set_command = \"SET\" argument argument [ \"EX\" integer ]\n" +
 		"get_command = \"GET\" argument\n" +
+		"getrange_command = \"GETRANGE\" argument integer integer\n" +
 		"del_command = \"DEL\" argument\n" +
-		"argument    = punctuation | letter | digit { punctuation | letter | digit }\n" +
+		"getdefault_command = \"GETDEFAULT\" argument argument\n" +
+		"setimmutable_command = \"SETIMMUTABLE\" argument argument\n" +
+		"unlock_command = \"UNLOCK\" argument\n" +
+		"debug_command = \"DEBUG\" \"JMAP\"\n" +
+		"help_command = \"HELP\" argument\n" +
+		"latency_command = \"LATENCY\"\n" +
+		"stats_command = \"STATS\" \"PARSE\"\n" +
+		"setmax_command = \"SETMAX\" argument integer\n" +
+		"setmin_command = \"SETMIN\" argument integer\n" +
+		"getprefix_command = \"GETPREFIX\" argument\n" +
+		"exists_command = \"EXISTS\" argument\n" +
+		"incr_command = \"INCR\" argument\n" +
+		"increx_command = \"INCREX\" argument integer\n" +
+		"decr_command = \"DECR\" argument\n" +
+		"mset_command = \"MSET\" argument argument { argument argument }\n" +
+		"mget_command = \"MGET\" argument { argument }\n" +
+		"expire_command = \"EXPIRE\" argument integer\n" +
+		"ttl_command = \"TTL\" argument\n" +
+		"delif_command = \"DELIF\" argument argument\n" +
+		"diff_command = \"DIFF\" argument argument\n" +
+		"rotate_command = \"ROTATE\" argument argument integer\n" +
+		"explain_command = \"EXPLAIN\" query\n" +
+		"appendsep_command = \"APPENDSEP\" argument argument\n" +
+		"findvalue_command = \"FINDVALUE\" argument\n" +
+		"defaultttl_command = \"DEFAULTTTL\" integer\n" +
+		"echo_command = \"ECHO\" argument\n" +
+		"keys_command = \"KEYS\" argument\n" +
+		"flush_command = \"FLUSH\"\n" +
+		"dbsize_command = \"DBSIZE\"\n" +
+		"indexget_command = \"INDEXGET\" argument\n" +
+		"noreply_command = \"NOREPLY\" ( \"ON\" | \"OFF\" )\n" +
+		"statusline_command = \"STATUSLINE\" ( \"ON\" | \"OFF\" )\n" +
+		"argument    = word | quoted\n" +
+		"word        = character { character }\n" +
+		"quoted      = \"\\\"\" { character | \" \" } \"\\\"\"\n" +
+		"character   = punctuation | letter | digit | escape\n" +
+		"escape      = \"\\\\\" ( \"\\\"\" | \"\\\\\" | \"n\" | \"t\" )\n" +
 		"punctuation = \"\\*\" | \"/\" | \"_\" | ...\n" +
 		"letter      = \"a\" | ... | \"z\" | \"A\" | ... | \"Z\"\n" +
 		"digit       = \"0\" | ... | \"9\"\n" +
+		"integer     = [ \"-\" ] digit { digit }\n" +
 		"\n",
 	)
 
@@ -104,3 +305,192 @@ func (cli *App) WriteHelp() error {
 
 	return nil
 }
+
+func (cli *App) handle(ctx context.Context, query []byte) error {
+	blank := len(bytes.TrimSpace(query)) == 0
+
+	switch {
+	case cli.skipComments && bytes.HasPrefix(query, commentPrefix):
+		return nil
+	case blank && cli.emptyLineMarker != nil:
+		cli.writeLine(cli.emptyLineMarker)
+	case blank && cli.skipEmptyLines:
+		return nil
+	case cli.multiQuery:
+		// Over TCP stdout and stderr are the same connection, so each answer is flushed before
+		// the next one is written to keep them in query order.
+		for _, r := range cli.execMulti(ctx, query) {
+			cli.writeResult(ctx, r)
+
+			if err := cli.flush(); err != nil {
+				return err
+			}
+		}
+	default:
+		cli.writeResult(ctx, cli.exec(ctx, query))
+	}
+
+	return cli.flush()
+}
+
+func (cli *App) flush() error {
+	if err := flush(cli.out, cli.stdout); err != nil {
+		return fmt.Errorf("writing to stdout: %v", err)
+	}
+
+	if err := flush(cli.errOut, cli.stderr); err != nil {
+		return fmt.Errorf("writing to stderr: %v", err)
+	}
+
+	return nil
+}
+
+// flush writes out what w has buffered. On failure it drops the rest, clearing the error
+// bufio.Writer would otherwise keep, so that the next response starts clean.
+func flush(w *bufio.Writer, dst io.Writer) error {
+	err := w.Flush()
+	if err != nil {
+		w.Reset(dst)
+	}
+
+	return err
+}
+
+func (cli *App) scanErr(scanner *bufio.Scanner) error {
+	err := scanner.Err()
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, bufio.ErrTooLong) {
+		err = fmt.Errorf("query exceeds maximum length of %d bytes", cli.maxQueryLen)
+	}
+
+	return fmt.Errorf("scan: %v", err)
+}
+
+func (cli *App) exec(ctx context.Context, query []byte) database.ExecResult {
+	return withTimeout(ctx, cli.queryTimeout, query, cli.qe.Exec, func(r database.ExecResult) database.ExecResult {
+		return r
+	})
+}
+
+// execMulti is exec for a line of queries; the timeout applies to the whole line.
+func (cli *App) execMulti(ctx context.Context, query []byte) []database.ExecResult {
+	return withTimeout(ctx, cli.queryTimeout, query, cli.qe.ExecMulti, func(r database.ExecResult) []database.ExecResult {
+		return []database.ExecResult{r}
+	})
+}
+
+// withTimeout runs exec on query, giving up after timeout unless it is 0; failed turns the
+// error result of giving up into what exec returns.
+func withTimeout[R any](
+	ctx context.Context,
+	timeout time.Duration,
+	query []byte,
+	exec func(ctx context.Context, query []byte) R,
+	failed func(database.ExecResult) R,
+) R {
+	if timeout <= 0 {
+		return exec(ctx, query)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The executor may outlive this call, so it must not see the scanner buffer being reused.
+	query = bytes.Clone(query)
+	results := make(chan R, 1)
+
+	go func() {
+		results <- exec(ctx, query)
+	}()
+
+	select {
+	case r := <-results:
+		return r
+	case <-ctx.Done():
+		err := ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("query timed out after %s", timeout)
+		}
+
+		return failed(database.ExecResult{Status: database.StatusErr, Err: err})
+	}
+}
+
+// writeResult buffers the response to r; handle flushes it, and reports write errors then.
+func (cli *App) writeResult(ctx context.Context, r database.ExecResult) {
+	if errors.Is(r.Err, database.ErrBusy) {
+		cli.writeErrLine(errBusy)
+
+		return
+	}
+
+	if r.Err != nil {
+		_, _ = cli.errOut.WriteString(r.Err.Error())
+		_ = cli.errOut.WriteByte('\n')
+
+		return
+	}
+
+	if cli.notFoundAsError && r.Status == database.StatusNotFound {
+		cli.writeErrLine(errNotFound)
+
+		return
+	}
+
+	if r.NoReply {
+		return
+	}
+
+	statusLine := database.StatusLine(ctx)
+
+	var data []byte
+	switch r.Status {
+	case database.StatusOkNoData:
+		data = resultOK
+		if statusLine {
+			data = resultStatusOK
+		}
+	case database.StatusNotFound:
+		data = resultNotFound
+	default:
+		data = r.Data
+	}
+
+	if statusLine && r.Status == database.StatusOK {
+		cli.writeLine(resultStatusOK)
+	}
+
+	cli.writeLine(data)
+}
+
+// writeLine and writeErrLine ignore errors: bufio.Writer keeps the first one for the flush.
+func (cli *App) writeLine(data []byte) {
+	_, _ = cli.out.Write(data)
+	_ = cli.out.WriteByte('\n')
+}
+
+func splitOn(delim byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+
+		if atEOF {
+			return len(data), data, nil
+		}
+
+		return 0, nil, nil
+	}
+}
+
+func (cli *App) writeErrLine(data []byte) {
+	_, _ = cli.errOut.Write(data)
+	_ = cli.errOut.WriteByte('\n')
+}
@@ -1,18 +1,26 @@
 package cli_test
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
 
 	"github.com/maxm86545/concurrency_go/internal/cli"
 	"github.com/maxm86545/concurrency_go/internal/database"
+	"github.com/maxm86545/concurrency_go/internal/database/compute"
+	"github.com/maxm86545/concurrency_go/internal/database/storage"
 )
 
 var newLine = []byte{'\n'}
@@ -178,7 +186,7 @@ func TestApp_Run_IOErrors(t *testing.T) {
 		{
 			name:        "newline write error to stdout",
 			stdin:       strings.NewReader("OK\n"),
-			stdout:      &newlineFailWriter{Writer: &bytes.Buffer{}, textErr: "stdout newline fail"},
+			stdout:      &lineEndFailWriter{Writer: &bytes.Buffer{}, textErr: "stdout newline fail"},
 			stderr:      &bytes.Buffer{},
 			expectedErr: "writing to stdout: stdout newline fail",
 		},
@@ -186,7 +194,7 @@ func TestApp_Run_IOErrors(t *testing.T) {
 			name:        "newline write error to stderr",
 			stdin:       strings.NewReader("FAIL\n"),
 			stdout:      &bytes.Buffer{},
-			stderr:      &newlineFailWriter{Writer: &bytes.Buffer{}, textErr: "stderr newline fail"},
+			stderr:      &lineEndFailWriter{Writer: &bytes.Buffer{}, textErr: "stderr newline fail"},
 			expectedErr: "writing to stderr: stderr newline fail",
 		},
 	}
@@ -210,6 +218,555 @@ func TestApp_Run_IOErrors(t *testing.T) {
 	}
 }
 
+func TestApp_Run_WritesResponseWhole(t *testing.T) {
+	qe := &mockQueryExecutor{
+		results: map[string]database.ExecResult{
+			"OK":   {Status: database.StatusOK, Data: []byte("ok-response")},
+			"FAIL": {Status: database.StatusErr, Err: errors.New("fail-response")},
+		},
+	}
+
+	// A newline is never written on its own, so a writer failing only on one sees no failure.
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	app, err := cli.NewCliApp(
+		strings.NewReader("OK\nFAIL\nOK\n"),
+		&newlineFailWriter{Writer: stdout, textErr: "stdout newline fail"},
+		&newlineFailWriter{Writer: stderr, textErr: "stderr newline fail"},
+		qe,
+	)
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	require.NoError(t, app.Run(context.Background()))
+	assert.Equal(t, "ok-response\nok-response\n", stdout.String())
+	assert.Equal(t, "fail-response\n", stderr.String())
+}
+
+func TestApp_Run_ContinueOnWriteError(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []cli.Option
+		expectedOut string
+	}{
+		{
+			name:        "abort by default",
+			opts:        nil,
+			expectedOut: "",
+		},
+		{
+			name:        "continue disabled",
+			opts:        []cli.Option{cli.WithContinueOnWriteError(false)},
+			expectedOut: "",
+		},
+		{
+			name:        "continue enabled",
+			opts:        []cli.Option{cli.WithContinueOnWriteError(true)},
+			expectedOut: "second\nthird\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stdin := strings.NewReader("GET 1\nGET 2\nGET 3\n")
+			out := &bytes.Buffer{}
+			stdout := &failOnceWriter{Writer: out, textErr: "transient fail"}
+			stderr := &bytes.Buffer{}
+
+			qe := &mockQueryExecutor{
+				results: map[string]database.ExecResult{
+					"GET 1": {Status: database.StatusOK, Data: []byte("first")},
+					"GET 2": {Status: database.StatusOK, Data: []byte("second")},
+					"GET 3": {Status: database.StatusOK, Data: []byte("third")},
+				},
+			}
+
+			app, err := cli.NewCliApp(stdin, stdout, stderr, qe, tc.opts...)
+			require.NoError(t, err, "NewCliApp should not fail")
+
+			err = app.Run(context.Background())
+			require.EqualError(t, err, "writing to stdout: transient fail")
+
+			assert.Equal(t, tc.expectedOut, out.String(), "stdout mismatch")
+			assert.Empty(t, stderr.String(), "stderr mismatch")
+		})
+	}
+}
+
+func TestApp_Run_Delimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		opts        []cli.Option
+		expectedOut string
+	}{
+		{
+			name:        "newline by default",
+			input:       "GET 1\nGET 2\n",
+			expectedOut: "result1\nresult2\n",
+		},
+		{
+			name:        "null delimited",
+			input:       "GET 1\x00GET 2\x00",
+			opts:        []cli.Option{cli.WithDelimiter(0)},
+			expectedOut: "result1\nresult2\n",
+		},
+		{
+			name:        "null delimited without trailing delimiter",
+			input:       "GET 1\x00GET 2",
+			opts:        []cli.Option{cli.WithDelimiter(0)},
+			expectedOut: "result1\nresult2\n",
+		},
+		{
+			name:        "null delimited keeps newlines inside query",
+			input:       "GET\n1\x00GET 2\x00",
+			opts:        []cli.Option{cli.WithDelimiter(0)},
+			expectedOut: "result1\nresult2\n",
+		},
+		{
+			name:        "custom delimiter",
+			input:       "GET 1;GET 2;",
+			opts:        []cli.Option{cli.WithDelimiter(';')},
+			expectedOut: "result1\nresult2\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stdin := strings.NewReader(tc.input)
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+
+			qe := &mockQueryExecutor{
+				results: map[string]database.ExecResult{
+					"GET 1":  {Status: database.StatusOK, Data: []byte("result1")},
+					"GET\n1": {Status: database.StatusOK, Data: []byte("result1")},
+					"GET 2":  {Status: database.StatusOK, Data: []byte("result2")},
+				},
+			}
+
+			app, err := cli.NewCliApp(stdin, stdout, stderr, qe, tc.opts...)
+			require.NoError(t, err, "NewCliApp should not fail")
+
+			err = app.Run(context.Background())
+			require.NoError(t, err, "Run should not fail")
+
+			assert.Equal(t, tc.expectedOut, stdout.String(), "stdout mismatch")
+			assert.Empty(t, stderr.String(), "stderr mismatch")
+		})
+	}
+}
+
+func TestApp_Run_StatusLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []cli.Option
+		expectedOut string
+	}{
+		{
+			name:        "bare data by default",
+			opts:        nil,
+			expectedOut: "value\nOK\nNOT_FOUND\n",
+		},
+		{
+			name:        "status line enabled",
+			opts:        []cli.Option{cli.WithStatusLine(true)},
+			expectedOut: "+OK\nvalue\n+OK\nNOT_FOUND\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stdin := strings.NewReader("GET hit\nSET k v\nGET miss\nGET fail\n")
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+
+			qe := &mockQueryExecutor{
+				results: map[string]database.ExecResult{
+					"GET hit":  {Status: database.StatusOK, Data: []byte("value")},
+					"SET k v":  {Status: database.StatusOkNoData},
+					"GET miss": {Status: database.StatusNotFound},
+					"GET fail": {Status: database.StatusErr, Err: errors.New("query failed")},
+				},
+			}
+
+			app, err := cli.NewCliApp(stdin, stdout, stderr, qe, tc.opts...)
+			require.NoError(t, err, "NewCliApp should not fail")
+
+			err = app.Run(context.Background())
+			require.NoError(t, err, "Run should not fail")
+
+			assert.Equal(t, tc.expectedOut, stdout.String(), "stdout mismatch")
+			assert.Equal(t, "query failed\n", stderr.String(), "stderr mismatch")
+		})
+	}
+}
+
+func TestApp_Run_NoReply(t *testing.T) {
+	stdin := strings.NewReader("SET a 1\nSET b 2\nDEL a\nGET b\nSET\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	app, err := cli.NewCliApp(stdin, stdout, stderr, db, cli.WithNoReply(true), cli.WithStatusLine(true))
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	err = app.Run(context.Background())
+	require.NoError(t, err, "Run should not fail")
+
+	assert.Equal(t, "+OK\n2\n", stdout.String(), "only the GET result is written")
+	assert.NotEmpty(t, stderr.String(), "errors are still reported")
+
+	result := db.Exec(context.Background(), []byte("GET a"))
+	assert.Equal(t, database.StatusNotFound, result.Status)
+}
+
+func TestApp_Run_NoReplyOnlyWrites(t *testing.T) {
+	stdin := strings.NewReader("SET a 1\nDEFAULTTTL 0\nFLUSH\nSET b 2\nNOREPLY OFF\nSET c 3\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	app, err := cli.NewCliApp(stdin, stdout, stderr, db, cli.WithNoReply(true))
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	err = app.Run(context.Background())
+	require.NoError(t, err, "Run should not fail")
+
+	assert.Equal(t, "OK\nOK\nOK\nOK\n", stdout.String(), "DEFAULTTTL, FLUSH, NOREPLY and the SET after it are answered")
+	assert.Empty(t, stderr.String())
+}
+
+func TestApp_Run_StatusLineCommand(t *testing.T) {
+	stdin := strings.NewReader("SET a 1\nSTATUSLINE ON\nGET a\nSTATUSLINE OFF\nGET a\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	app, err := cli.NewCliApp(stdin, stdout, stderr, db)
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	err = app.Run(context.Background())
+	require.NoError(t, err, "Run should not fail")
+
+	assert.Equal(t, "OK\n+OK\n+OK\n1\nOK\n1\n", stdout.String())
+	assert.Empty(t, stderr.String())
+}
+
+func TestApp_Run_MultiQuery(t *testing.T) {
+	stdin := strings.NewReader("SET a 1; SET b 2; GET a\nSET c \"x;y\";\nGET c; GET b; FETCH\nGET b;GET missing\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	app, err := cli.NewCliApp(stdin, stdout, stderr, db, cli.WithMultiQuery(true))
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	err = app.Run(context.Background())
+	require.NoError(t, err, "Run should not fail")
+
+	assert.Equal(t, "OK\nOK\n1\nOK\n2\nNOT_FOUND\n", stdout.String(), "one answer per query")
+	assert.Equal(t, "parse query: unknown command: \"FETCH\"\n", stderr.String(), "an invalid line gets one error")
+}
+
+func TestApp_Run_Busy(t *testing.T) {
+	stdin := strings.NewReader("GETPREFIX k\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	qe := &mockQueryExecutor{
+		results: map[string]database.ExecResult{
+			"GETPREFIX k": {Status: database.StatusErr, Err: database.ErrBusy},
+		},
+	}
+
+	app, err := cli.NewCliApp(stdin, stdout, stderr, qe)
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	err = app.Run(context.Background())
+	require.NoError(t, err, "Run should not fail")
+
+	assert.Empty(t, stdout.String(), "stdout mismatch")
+	assert.Equal(t, "ERR busy\n", stderr.String(), "stderr mismatch")
+}
+
+func TestApp_Run_NotFoundAsError(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []cli.Option
+		expectedOut string
+		expectedErr string
+	}{
+		{
+			name:        "not found token by default",
+			opts:        nil,
+			expectedOut: "value\nNOT_FOUND\n",
+			expectedErr: "",
+		},
+		{
+			name:        "not found as error",
+			opts:        []cli.Option{cli.WithNotFoundAsError(true)},
+			expectedOut: "value\n",
+			expectedErr: "ERR not found\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stdin := strings.NewReader("GET hit\nGET miss\n")
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+
+			qe := &mockQueryExecutor{
+				results: map[string]database.ExecResult{
+					"GET hit":  {Status: database.StatusOK, Data: []byte("value")},
+					"GET miss": {Status: database.StatusNotFound},
+				},
+			}
+
+			app, err := cli.NewCliApp(stdin, stdout, stderr, qe, tc.opts...)
+			require.NoError(t, err, "NewCliApp should not fail")
+
+			err = app.Run(context.Background())
+			require.NoError(t, err, "Run should not fail")
+
+			assert.Equal(t, tc.expectedOut, stdout.String(), "stdout mismatch")
+			assert.Equal(t, tc.expectedErr, stderr.String(), "stderr mismatch")
+		})
+	}
+}
+
+func TestApp_Run_MaxQueryLen(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		opts        []cli.Option
+		expectedOut string
+		expectedErr string
+	}{
+		{
+			name:        "default limit exceeded",
+			input:       "GET " + strings.Repeat("x", bufio.MaxScanTokenSize) + "\n",
+			expectedErr: fmt.Sprintf("scan: query exceeds maximum length of %d bytes", bufio.MaxScanTokenSize),
+		},
+		{
+			name:        "custom limit exceeded after valid query",
+			input:       "GET 1\nGET " + strings.Repeat("x", 16) + "\n",
+			opts:        []cli.Option{cli.WithMaxQueryLen(16)},
+			expectedOut: "result1\n",
+			expectedErr: "scan: query exceeds maximum length of 16 bytes",
+		},
+		{
+			name:        "custom limit not exceeded",
+			input:       "GET 1\n",
+			opts:        []cli.Option{cli.WithMaxQueryLen(16)},
+			expectedOut: "result1\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stdin := strings.NewReader(tc.input)
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+
+			qe := &mockQueryExecutor{
+				results: map[string]database.ExecResult{
+					"GET 1": {Status: database.StatusOK, Data: []byte("result1")},
+				},
+			}
+
+			app, err := cli.NewCliApp(stdin, stdout, stderr, qe, tc.opts...)
+			require.NoError(t, err, "NewCliApp should not fail")
+
+			err = app.Run(context.Background())
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedOut, stdout.String(), "stdout mismatch")
+		})
+	}
+}
+
+func TestApp_Run_QueryTimeout(t *testing.T) {
+	const (
+		timeout = 10 * time.Millisecond
+		delay   = 200 * time.Millisecond
+	)
+
+	stdin := strings.NewReader("SLOW\nGET 1\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	qe := &slowQueryExecutor{
+		slow:  []byte("SLOW"),
+		delay: delay,
+		mockQueryExecutor: mockQueryExecutor{
+			results: map[string]database.ExecResult{
+				"SLOW":  {Status: database.StatusOK, Data: []byte("late")},
+				"GET 1": {Status: database.StatusOK, Data: []byte("result1")},
+			},
+		},
+	}
+
+	app, err := cli.NewCliApp(stdin, stdout, stderr, qe, cli.WithQueryTimeout(timeout))
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	start := time.Now()
+	err = app.Run(context.Background())
+	require.NoError(t, err, "Run should not fail")
+
+	assert.Less(t, time.Since(start), delay, "Run should not wait for the slow query")
+	assert.Equal(t, "result1\n", stdout.String(), "stdout mismatch")
+	assert.Equal(t, "query timed out after 10ms\n", stderr.String(), "stderr mismatch")
+}
+
+func TestApp_Run_SkipComments(t *testing.T) {
+	stdin := strings.NewReader("# comment\nGET 1\n#\nGET 2\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	qe := &mockQueryExecutor{
+		results: map[string]database.ExecResult{
+			"GET 1": {Status: database.StatusOK, Data: []byte("result1")},
+			"GET 2": {Status: database.StatusOK, Data: []byte("result2")},
+		},
+	}
+
+	app, err := cli.NewCliApp(stdin, stdout, stderr, qe, cli.WithSkipComments(true))
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	err = app.Run(context.Background())
+	require.NoError(t, err, "Run should not fail")
+
+	assert.Equal(t, "result1\nresult2\n", stdout.String(), "stdout mismatch")
+	assert.Empty(t, stderr.String(), "stderr mismatch")
+}
+
+func TestApp_Run_EmptyLines(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []cli.Option
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "passed on by default",
+			wantStdout: "result\n",
+			wantStderr: "empty query\nempty query\n",
+		},
+		{
+			name:       "skipped",
+			opts:       []cli.Option{cli.WithSkipEmptyLines(true)},
+			wantStdout: "result\n",
+		},
+		{
+			name:       "marker",
+			opts:       []cli.Option{cli.WithSkipEmptyLines(true), cli.WithEmptyLineMarker([]byte("-"))},
+			wantStdout: "-\nresult\n-\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin := strings.NewReader("\nGET 1\n \t\n")
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+
+			qe := &mockQueryExecutor{
+				results: map[string]database.ExecResult{
+					"":      {Status: database.StatusErr, Err: compute.ErrEmptyQuery},
+					" \t":   {Status: database.StatusErr, Err: compute.ErrEmptyQuery},
+					"GET 1": {Status: database.StatusOK, Data: []byte("result")},
+				},
+			}
+
+			app, err := cli.NewCliApp(stdin, stdout, stderr, qe, tt.opts...)
+			require.NoError(t, err, "NewCliApp should not fail")
+
+			require.NoError(t, app.Run(context.Background()))
+
+			assert.Equal(t, tt.wantStdout, stdout.String(), "stdout mismatch")
+			assert.Equal(t, tt.wantStderr, stderr.String(), "stderr mismatch")
+		})
+	}
+}
+
+func TestApp_Run_CanceledContext(t *testing.T) {
+	stdin := strings.NewReader("GET 1\nGET 2\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	app, err := cli.NewCliApp(stdin, stdout, stderr, &mockQueryExecutor{})
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = app.Run(ctx)
+	require.NoError(t, err, "Run should stop without error")
+
+	assert.Empty(t, stdout.String(), "stdout mismatch")
+	assert.Empty(t, stderr.String(), "stderr mismatch")
+}
+
+func TestApp_Run_CancelWhileWaitingForInput(t *testing.T) {
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+
+	stdout := &bytes.Buffer{}
+
+	app, err := cli.NewCliApp(stdin, stdout, &bytes.Buffer{}, &mockQueryExecutor{})
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err, "Run should stop without error")
+	case <-time.After(time.Second):
+		require.FailNow(t, "Run did not return after cancellation")
+	}
+
+	assert.Empty(t, stdout.String(), "stdout should be empty")
+}
+
+func TestApp_Run_StopsReaderOnCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+
+	app, err := cli.NewCliApp(stdin, &bytes.Buffer{}, &bytes.Buffer{}, &mockQueryExecutor{})
+	require.NoError(t, err, "NewCliApp should not fail")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	require.NoError(t, app.Run(ctx))
+
+	// The reader was blocked on the pipe; closing it is the only way it can return.
+	require.Eventually(t, func() bool {
+		return runtime.NumGoroutine() <= before
+	}, time.Second, time.Millisecond, "the goroutine reading stdin leaked")
+
+	_, err = stdinWriter.Write([]byte("GET k\n"))
+	require.ErrorIs(t, err, io.ErrClosedPipe, "Run closes stdin it has not drained")
+}
+
 func TestApp_Run_ScannerError(t *testing.T) {
 	stdin := &brokenReader{textErr: "read error"}
 	stdout := &bytes.Buffer{}
@@ -252,8 +809,38 @@ func TestApp_WriteHelp(t *testing.T) {
 	})
 }
 
+func BenchmarkApp_Run(b *testing.B) {
+	qe := &mockQueryExecutor{
+		results: map[string]database.ExecResult{
+			"SET k v":   {Status: database.StatusOkNoData},
+			"GET k":     {Status: database.StatusOK, Data: []byte("v")},
+			"GET none":  {Status: database.StatusNotFound},
+			"GET k k k": {Status: database.StatusErr, Err: compute.ErrInvalidArguments},
+		},
+	}
+
+	var script strings.Builder
+	for range 2500 {
+		script.WriteString("SET k v\nGET k\nGET none\nGET k k k\n")
+	}
+
+	// Writing to the null device keeps the cost of a write syscall in the measurement.
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	require.NoError(b, err)
+	b.Cleanup(func() { _ = devNull.Close() })
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		app, err := cli.NewCliApp(strings.NewReader(script.String()), devNull, devNull, qe)
+		require.NoError(b, err)
+		require.NoError(b, app.Run(context.Background()))
+	}
+}
+
 type mockQueryExecutor struct {
-	results map[string]database.ExecResult
+	results      map[string]database.ExecResult
+	multiResults map[string][]database.ExecResult
 }
 
 func (m *mockQueryExecutor) Exec(_ context.Context, rawQuery []byte) database.ExecResult {
@@ -264,6 +851,29 @@ func (m *mockQueryExecutor) Exec(_ context.Context, rawQuery []byte) database.Ex
 	panic("specify test case in results")
 }
 
+func (m *mockQueryExecutor) ExecMulti(_ context.Context, rawQuery []byte) []database.ExecResult {
+	if res, ok := m.multiResults[string(rawQuery)]; ok {
+		return res
+	}
+
+	panic("specify test case in multiResults")
+}
+
+type slowQueryExecutor struct {
+	mockQueryExecutor
+
+	slow  []byte
+	delay time.Duration
+}
+
+func (m *slowQueryExecutor) Exec(ctx context.Context, rawQuery []byte) database.ExecResult {
+	if bytes.Equal(rawQuery, m.slow) {
+		time.Sleep(m.delay)
+	}
+
+	return m.mockQueryExecutor.Exec(ctx, rawQuery)
+}
+
 type brokenReader struct {
 	textErr string
 }
@@ -293,3 +903,35 @@ func (w *newlineFailWriter) Write(p []byte) (int, error) {
 
 	return w.Writer.Write(p)
 }
+
+type lineEndFailWriter struct {
+	io.Writer
+
+	textErr string
+}
+
+// Write fails on any write that ends a line; App writes a response whole, newline included.
+func (w *lineEndFailWriter) Write(p []byte) (int, error) {
+	if bytes.HasSuffix(p, newLine) {
+		return 0, errors.New(w.textErr)
+	}
+
+	return w.Writer.Write(p)
+}
+
+type failOnceWriter struct {
+	io.Writer
+
+	textErr string
+	failed  bool
+}
+
+func (w *failOnceWriter) Write(p []byte) (int, error) {
+	if !w.failed {
+		w.failed = true
+
+		return 0, errors.New(w.textErr)
+	}
+
+	return w.Writer.Write(p)
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+
+	"github.com/maxm86545/concurrency_go/internal/database/compute"
+)
+
+const (
+	EngineInMemory = "in_memory"
+
+	// LogOutputStdout as the logging output sends logs to stdout instead of a file.
+	LogOutputStdout = "stdout"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+type Config struct {
+	Engine  EngineConfig  `yaml:"engine"`
+	Network NetworkConfig `yaml:"network"`
+	Logging LoggingConfig `yaml:"logging"`
+	Compute ComputeConfig `yaml:"compute"`
+}
+
+type EngineConfig struct {
+	Type string `yaml:"type"`
+}
+
+type NetworkConfig struct {
+	// Address is where the TCP server listens; empty disables it.
+	Address string `yaml:"address"`
+	// MaxConnections caps the connections served at once; 0 means no limit.
+	MaxConnections int `yaml:"max_connections"`
+	// MaxResponseSize caps the bytes a GET, GETRANGE, MGET or listing query may answer with;
+	// 0 means no limit.
+	MaxResponseSize int `yaml:"max_response_size"`
+}
+
+type LoggingConfig struct {
+	Level  zapcore.Level `yaml:"level"`
+	Output string        `yaml:"output"`
+}
+
+type ComputeConfig struct {
+	MaxCommandLength int `yaml:"max_command_length"`
+	// MaxKeyLength and MaxValueLength bound the keys and values of every command; 0 means
+	// no limit.
+	MaxKeyLength   int `yaml:"max_key_length"`
+	MaxValueLength int `yaml:"max_value_length"`
+	// Strict rejects queries with characters the query grammar does not allow.
+	Strict bool `yaml:"strict"`
+	// ArgLimits bounds key and value lengths per command, keyed by command name, which must be
+	// a built-in command.
+	ArgLimits map[string]ArgLimitsConfig `yaml:"arg_limits"`
+}
+
+// ArgLimitsConfig holds the longest key and value a command accepts; 0 means no limit.
+type ArgLimitsConfig struct {
+	MaxKeyLength   int `yaml:"max_key_length"`
+	MaxValueLength int `yaml:"max_value_length"`
+}
+
+// Default is the configuration used when no file is given; Load starts from it, so omitted
+// fields keep these values.
+func Default() *Config {
+	return &Config{
+		Engine:  EngineConfig{Type: EngineInMemory},
+		Logging: LoggingConfig{Level: zapcore.InfoLevel, Output: "app.log"},
+		Compute: ComputeConfig{MaxCommandLength: 128},
+	}
+}
+
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open config: %w", err)
+	}
+	defer f.Close()
+
+	cfg := Default()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.Engine.Type != EngineInMemory {
+		return fmt.Errorf("engine.type: unknown engine %q", c.Engine.Type)
+	}
+
+	if c.Network.MaxConnections < 0 {
+		return fmt.Errorf("network.max_connections: must not be negative, got %d", c.Network.MaxConnections)
+	}
+
+	if c.Network.MaxResponseSize < 0 {
+		return fmt.Errorf("network.max_response_size: must not be negative, got %d", c.Network.MaxResponseSize)
+	}
+
+	if c.Logging.Output == "" {
+		return errors.New("logging.output: must not be empty")
+	}
+
+	if c.Compute.MaxCommandLength <= 0 {
+		return fmt.Errorf("compute.max_command_length: must be positive, got %d", c.Compute.MaxCommandLength)
+	}
+
+	if c.Compute.MaxKeyLength < 0 || c.Compute.MaxValueLength < 0 {
+		return errors.New("compute: max key and value lengths must not be negative")
+	}
+
+	for command, limits := range c.Compute.ArgLimits {
+		if !compute.IsCommand(command) {
+			return fmt.Errorf("compute.arg_limits.%s: unknown command", command)
+		}
+
+		if limits.MaxKeyLength < 0 || limits.MaxValueLength < 0 {
+			return fmt.Errorf("compute.arg_limits.%s: lengths must not be negative", command)
+		}
+	}
+
+	return nil
+}
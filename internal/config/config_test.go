@@ -0,0 +1,124 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/maxm86545/concurrency_go/internal/config"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want *config.Config
+	}{
+		{
+			name: "all fields",
+			yaml: `
+engine:
+  type: in_memory
+network:
+  address: 127.0.0.1:3223
+  max_connections: 100
+  max_response_size: 1048576
+logging:
+  level: debug
+  output: /var/log/kv.log
+compute:
+  max_command_length: 4096
+  max_key_length: 256
+  max_value_length: 65536
+  strict: true
+  arg_limits:
+    SET:
+      max_key_length: 64
+      max_value_length: 2048
+`,
+			want: &config.Config{
+				Engine:  config.EngineConfig{Type: config.EngineInMemory},
+				Network: config.NetworkConfig{Address: "127.0.0.1:3223", MaxConnections: 100, MaxResponseSize: 1048576},
+				Logging: config.LoggingConfig{Level: zapcore.DebugLevel, Output: "/var/log/kv.log"},
+				Compute: config.ComputeConfig{
+					MaxCommandLength: 4096,
+					MaxKeyLength:     256,
+					MaxValueLength:   65536,
+					Strict:           true,
+					ArgLimits: map[string]config.ArgLimitsConfig{
+						"SET": {MaxKeyLength: 64, MaxValueLength: 2048},
+					},
+				},
+			},
+		},
+		{
+			name: "omitted fields keep defaults",
+			yaml: "network:\n  address: :3223\n",
+			want: func() *config.Config {
+				cfg := config.Default()
+				cfg.Network.Address = ":3223"
+
+				return cfg
+			}(),
+		},
+		{
+			name: "empty file",
+			yaml: "",
+			want: config.Default(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Load(writeConfig(t, tt.yaml))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg)
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{name: "unknown engine", yaml: "engine:\n  type: on_disk\n"},
+		{name: "unknown log level", yaml: "logging:\n  level: loud\n"},
+		{name: "negative max connections", yaml: "network:\n  max_connections: -1\n"},
+		{name: "negative max response size", yaml: "network:\n  max_response_size: -1\n"},
+		{name: "empty log output", yaml: "logging:\n  output: \"\"\n"},
+		{name: "zero max command length", yaml: "compute:\n  max_command_length: 0\n"},
+		{name: "negative max value length", yaml: "compute:\n  max_value_length: -1\n"},
+		{name: "negative max key length", yaml: "compute:\n  arg_limits:\n    GET:\n      max_key_length: -1\n"},
+		{name: "unknown arg limits command", yaml: "compute:\n  arg_limits:\n    FETCH:\n      max_key_length: 8\n"},
+		{name: "wrong type", yaml: "compute:\n  max_command_length: long\n"},
+		{name: "unknown field", yaml: "compute:\n  max_command_len: 64\n"},
+		{name: "malformed", yaml: "engine: [\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Load(writeConfig(t, tt.yaml))
+			require.ErrorIs(t, err, config.ErrInvalidConfig)
+			assert.Nil(t, cfg)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := config.Load(filepath.Join(t.TempDir(), "missing.yaml"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
@@ -1,7 +1,174 @@
 package compute
 
+import (
+	"fmt"
+	"strings"
+)
+
+const commandExplain = "EXPLAIN"
+
 var (
-	upperCommandSet = []byte("SET")
-	upperCommandGet = []byte("GET")
-	upperCommandDel = []byte("DEL")
+	upperOptionEX = []byte("EX")
+
+	upperSubcommandJMap  = []byte("JMAP")
+	upperSubcommandParse = []byte("PARSE")
+
+	upperOn  = []byte("ON")
+	upperOff = []byte("OFF")
 )
+
+// command is how Compute parses one command.
+type command struct {
+	// argsLen is the number of fields the command takes, the command itself included;
+	// 0 leaves checking the count to parse.
+	argsLen int
+	parse   func(fields [][]byte) (Query, error)
+}
+
+// builtinCommands holds every command but EXPLAIN, which parses through its Compute.
+var builtinCommands = map[string]command{
+	"SET": {parse: parseSet},
+	"GET": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &GetQuery{Key: fields[1]}, nil
+	}},
+	"DEL": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &DelQuery{Key: fields[1]}, nil
+	}},
+	"GETRANGE": {argsLen: 4, parse: parseGetRange},
+	"GETDEFAULT": {argsLen: 3, parse: func(fields [][]byte) (Query, error) {
+		return &GetDefaultQuery{Key: fields[1], Default: fields[2]}, nil
+	}},
+	"SETIMMUTABLE": {argsLen: 3, parse: func(fields [][]byte) (Query, error) {
+		return &SetImmutableQuery{Key: fields[1], Value: fields[2]}, nil
+	}},
+	"UNLOCK": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &UnlockQuery{Key: fields[1]}, nil
+	}},
+	"DEBUG": {argsLen: 2, parse: parseDebug},
+	"HELP":  {argsLen: 2, parse: parseHelp},
+	"LATENCY": {argsLen: 1, parse: func([][]byte) (Query, error) {
+		return &LatencyQuery{}, nil
+	}},
+	"STATS": {argsLen: 2, parse: parseStats},
+	"SETMAX": {argsLen: 3, parse: parseBound(func(key []byte, value int64) Query {
+		return &SetMaxQuery{Key: key, Value: value}
+	})},
+	"SETMIN": {argsLen: 3, parse: parseBound(func(key []byte, value int64) Query {
+		return &SetMinQuery{Key: key, Value: value}
+	})},
+	"GETPREFIX": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &GetPrefixQuery{Prefix: fields[1]}, nil
+	}},
+	"EXISTS": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &ExistsQuery{Key: fields[1]}, nil
+	}},
+	"INCR": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &IncrQuery{Key: fields[1]}, nil
+	}},
+	"INCREX": {argsLen: 3, parse: parseIncrEx},
+	"DECR": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &DecrQuery{Key: fields[1]}, nil
+	}},
+	"MSET":   {parse: parseMSet},
+	"MGET":   {parse: parseMGet},
+	"EXPIRE": {argsLen: 3, parse: parseExpire},
+	"TTL": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &TTLQuery{Key: fields[1]}, nil
+	}},
+	"DELIF": {argsLen: 3, parse: func(fields [][]byte) (Query, error) {
+		return &DelIfQuery{Key: fields[1], Expected: fields[2]}, nil
+	}},
+	"DIFF": {argsLen: 3, parse: func(fields [][]byte) (Query, error) {
+		return &DiffQuery{Key1: fields[1], Key2: fields[2]}, nil
+	}},
+	"ROTATE": {argsLen: 4, parse: parseRotate},
+	"APPENDSEP": {argsLen: 3, parse: func(fields [][]byte) (Query, error) {
+		return &AppendSepQuery{Key: fields[1], Value: fields[2]}, nil
+	}},
+	"FINDVALUE": {argsLen: 2, parse: parsePattern(func(pattern []byte) Query {
+		return &FindValueQuery{Pattern: pattern}
+	})},
+	"KEYS": {argsLen: 2, parse: parsePattern(func(pattern []byte) Query {
+		return &KeysQuery{Pattern: pattern}
+	})},
+	"FLUSH": {argsLen: 1, parse: func([][]byte) (Query, error) {
+		return &FlushQuery{}, nil
+	}},
+	"DBSIZE": {argsLen: 1, parse: func([][]byte) (Query, error) {
+		return &DBSizeQuery{}, nil
+	}},
+	"INDEXGET": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &IndexGetQuery{Field: fields[1]}, nil
+	}},
+	"DEFAULTTTL": {argsLen: 2, parse: parseDefaultTTL},
+	"NOREPLY": {argsLen: 2, parse: parseMode("noreply", func(enabled bool) Query {
+		return &NoReplyQuery{Enabled: enabled}
+	})},
+	"STATUSLINE": {argsLen: 2, parse: parseMode("statusline", func(enabled bool) Query {
+		return &StatusLineQuery{Enabled: enabled}
+	})},
+	"ECHO": {argsLen: 2, parse: func(fields [][]byte) (Query, error) {
+		return &EchoQuery{Message: fields[1]}, nil
+	}},
+}
+
+// RegisterCommand adds a command taking exactly argc arguments, which Parse hands to build.
+// build must return one of the queries of this package: no other type can implement Query, and
+// those are all the database runs, so a registered command is a shorthand for a built-in one,
+// e.g. PUT key value for SET. Names are case-insensitive; a name that is taken already is
+// refused with ErrCommandExists. Register commands before the Compute is shared, as Parse
+// reads them without locking.
+func (c *Compute) RegisterCommand(name string, argc int, build func(args [][]byte) Query) error {
+	upperName := strings.ToUpper(name)
+	if _, ok := c.commands[upperName]; ok {
+		return fmt.Errorf("%w: %q", ErrCommandExists, upperName)
+	}
+
+	c.commands[upperName] = command{
+		argsLen: argc + 1,
+		parse: func(fields [][]byte) (Query, error) {
+			return build(fields[1:]), nil
+		},
+	}
+
+	return nil
+}
+
+var commandUsages = map[string]string{
+	"SET":          "SET key value [EX seconds] - store a value, expiring after seconds if given",
+	"GET":          "GET key - retrieve a value",
+	"DEL":          "DEL key - delete a key",
+	"GETRANGE":     "GETRANGE key start end - retrieve the bytes of a value from start to end, negative offsets count from its end",
+	"GETDEFAULT":   "GETDEFAULT key default - retrieve a value, storing default if the key is missing",
+	"SETIMMUTABLE": "SETIMMUTABLE key value - store a value that rejects further SET and DEL",
+	"UNLOCK":       "UNLOCK key - make an immutable key writable again",
+	"DEBUG":        "DEBUG JMAP - report engine map statistics",
+	"HELP":         "HELP command - describe a command",
+	"LATENCY":      "LATENCY - report p50/p95/p99 query latency",
+	"STATS":        "STATS PARSE - report parse error counters",
+	"SETMAX":       "SETMAX key number - store number if it is greater than the current value",
+	"SETMIN":       "SETMIN key number - store number if it is less than the current value",
+	"GETPREFIX":    "GETPREFIX prefix - retrieve every key and value whose key starts with prefix",
+	"EXISTS":       "EXISTS key - report 1 if the key is present, 0 otherwise",
+	"INCR":         "INCR key - add 1 to the integer value, starting from 0 if the key is missing",
+	"INCREX":       "INCREX key seconds - INCR the key, expiring it after seconds if INCREX created it",
+	"DECR":         "DECR key - subtract 1 from the integer value, starting from 0 if the key is missing",
+	"MSET":         "MSET key value [key value ...] - store several values",
+	"MGET":         "MGET key [key ...] - retrieve several values, one line per key, (nil) for a missing one",
+	"EXPIRE":       "EXPIRE key seconds - delete the key once seconds have passed",
+	"TTL":          "TTL key - report the seconds left before the key expires, -1 if it never does, -2 if it is missing",
+	"DELIF":        "DELIF key expected - delete the key only if its value equals expected",
+	"DIFF":         "DIFF key key - report whether two values are equal and the first differing byte offset",
+	"ROTATE":       "ROTATE key value seconds - store a value that expires after seconds and return the one it replaced",
+	"EXPLAIN":      "EXPLAIN command [argument ...] - describe how a query parses without executing it",
+	"APPENDSEP":    "APPENDSEP key value - append a value after a separator and report the new length",
+	"FINDVALUE":    "FINDVALUE pattern - list the keys whose values match a glob pattern, one per line",
+	"NOREPLY":      "NOREPLY ON|OFF - leave successful SETs and DELs on this connection unanswered",
+	"STATUSLINE":   "STATUSLINE ON|OFF - prefix answers on this connection with +OK so values stand apart from errors",
+	"DEFAULTTTL":   "DEFAULTTTL seconds - expire later SETs on this connection after seconds, 0 disables",
+	"ECHO":         "ECHO message - return message unchanged; time it on the client to measure round-trip latency",
+	"KEYS":         "KEYS pattern - list the keys matching a glob pattern, one per line",
+	"FLUSH":        "FLUSH - delete every key, immutable ones included",
+	"DBSIZE":       "DBSIZE - report the number of keys",
+	"INDEXGET":     "INDEXGET value - list the indexed keys holding value, one per line",
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"maps"
+	"strconv"
 )
 
 var (
@@ -11,14 +13,94 @@ var (
 	ErrEmptyQuery       = errors.New("empty query")
 	ErrUnknownCommand   = errors.New("unknown command")
 	ErrInvalidArguments = errors.New("invalid arguments")
+	ErrKeyTooLong       = errors.New("key too long")
+	ErrValueTooLong     = errors.New("value too long")
+	ErrCommandExists    = errors.New("command already registered")
+
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+	ErrInvalidEscape     = errors.New("invalid escape")
+	ErrInvalidCharacter  = errors.New("invalid character")
 )
 
+// ParseError is what Parse returns when a query names an unknown command or gives a known
+// one arguments it does not accept. It unwraps to an error wrapping Kind, so errors.Is keeps
+// matching the sentinel errors.
+type ParseError struct {
+	// Kind is ErrUnknownCommand or ErrInvalidArguments.
+	Kind error
+	// Command is the command the query named, upper-cased.
+	Command string
+	// Args is the number of arguments given after the command.
+	Args int
+
+	err error
+}
+
+func (e *ParseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.err
+}
+
+// newParseError wraps err in a ParseError for the query in fields, unless err is of another
+// kind or already holds one, as the errors of a query nested in EXPLAIN do.
+func newParseError(fields [][]byte, err error) error {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		return err
+	}
+
+	var kind error
+	switch {
+	case errors.Is(err, ErrUnknownCommand):
+		kind = ErrUnknownCommand
+	case errors.Is(err, ErrInvalidArguments):
+		kind = ErrInvalidArguments
+	default:
+		return err
+	}
+
+	return &ParseError{
+		Kind:    kind,
+		Command: string(bytes.ToUpper(fields[0])),
+		Args:    len(fields) - 1,
+		err:     err,
+	}
+}
+
 type Compute struct {
-	maxLen int
+	maxLen      int
+	maxKeyLen   int
+	maxValueLen int
+	strict      bool
+	argLimits   map[string]ArgLimits
+	commands    map[string]command
 }
 
-func NewCompute(maxLen int) *Compute {
-	return &Compute{maxLen: maxLen}
+type Option func(c *Compute)
+
+// WithStrict makes Parse reject queries with characters the grammar in the CLI help does not
+// allow, such as control bytes, with ErrInvalidCharacter. Queries are not checked by default.
+func WithStrict(strict bool) Option {
+	return func(c *Compute) {
+		c.strict = strict
+	}
+}
+
+func NewCompute(maxLen int, opts ...Option) *Compute {
+	c := &Compute{
+		maxLen:   maxLen,
+		commands: maps.Clone(builtinCommands),
+	}
+	c.commands[commandExplain] = command{parse: c.parseExplain}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 func (c *Compute) Parse(query []byte) (Query, error) {
@@ -27,56 +109,339 @@ func (c *Compute) Parse(query []byte) (Query, error) {
 		return nil, err
 	}
 
+	q, err := c.parse(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkArgLens(fields[0], q); err != nil {
+		return nil, newParseError(fields, err)
+	}
+
+	if err := c.checkArgLimits(fields[0], q); err != nil {
+		return nil, newParseError(fields, err)
+	}
+
+	return q, nil
+}
+
+// ParseMulti parses a line of queries separated by the semicolons outside quoted arguments,
+// skipping empty ones. It fails on the first query Parse rejects, and with ErrEmptyQuery when
+// there is none.
+func (c *Compute) ParseMulti(query []byte) ([]Query, error) {
+	segments := SplitQueries(query)
+	if len(segments) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	queries := make([]Query, 0, len(segments))
+	for _, segment := range segments {
+		q, err := c.Parse(segment)
+		if err != nil {
+			return nil, err
+		}
+
+		queries = append(queries, q)
+	}
+
+	return queries, nil
+}
+
+func (c *Compute) parse(fields [][]byte) (Query, error) {
 	upperCommand := bytes.ToUpper(fields[0])
 
+	cmd, ok := c.commands[string(upperCommand)]
+	if !ok {
+		return nil, newParseError(fields, fmt.Errorf("%w: %q", ErrUnknownCommand, string(fields[0])))
+	}
+
+	if l := len(fields); cmd.argsLen > 0 && l != cmd.argsLen {
+		return nil, newParseError(fields,
+			fmt.Errorf("%w: %s expects %d arguments, got %d", ErrInvalidArguments, bytes.ToLower(upperCommand), cmd.argsLen, l))
+	}
+
+	q, err := cmd.parse(fields)
+	if err != nil {
+		return nil, newParseError(fields, err)
+	}
+
+	return q, nil
+}
+
+func parseSet(fields [][]byte) (Query, error) {
+	const (
+		argsLen      = 3
+		argsLenEX    = 5
+		keyIndex     = 1
+		valueIndex   = 2
+		optionIndex  = 3
+		secondsIndex = 4
+	)
+
+	l := len(fields)
+	if l != argsLen && l != argsLenEX {
+		return nil, fmt.Errorf("%w: set expects %d or %d arguments, got %d", ErrInvalidArguments, argsLen, argsLenEX, l)
+	}
+
+	q := &SetQuery{
+		Key:   fields[keyIndex],
+		Value: fields[valueIndex],
+	}
+
+	if l == argsLenEX {
+		if !bytes.Equal(bytes.ToUpper(fields[optionIndex]), upperOptionEX) {
+			return nil, fmt.Errorf("%w: set expects EX, got %q", ErrInvalidArguments, fields[optionIndex])
+		}
+
+		seconds, err := strconv.ParseInt(string(fields[secondsIndex]), 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("%w: set expects a positive number of seconds, got %q", ErrInvalidArguments, fields[secondsIndex])
+		}
+
+		q.Seconds = seconds
+	}
+
+	return q, nil
+}
+
+func parseDebug(fields [][]byte) (Query, error) {
+	const subcommandIndex = 1
+
+	upperSubcommand := bytes.ToUpper(fields[subcommandIndex])
+
 	switch {
-	case bytes.Equal(upperCommand, upperCommandSet):
+	case bytes.Equal(upperSubcommand, upperSubcommandJMap):
+		return &DebugJMapQuery{}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unknown debug subcommand %q", ErrInvalidArguments, string(fields[subcommandIndex]))
+	}
+}
+
+func parseStats(fields [][]byte) (Query, error) {
+	const subcommandIndex = 1
+
+	upperSubcommand := bytes.ToUpper(fields[subcommandIndex])
+
+	switch {
+	case bytes.Equal(upperSubcommand, upperSubcommandParse):
+		return &StatsParseQuery{}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unknown stats subcommand %q", ErrInvalidArguments, string(fields[subcommandIndex]))
+	}
+}
+
+// parseMode parses NOREPLY and STATUSLINE, which switch a connection mode ON or OFF.
+func parseMode(command string, build func(enabled bool) Query) func(fields [][]byte) (Query, error) {
+	return func(fields [][]byte) (Query, error) {
+		const modeIndex = 1
+
+		upperMode := bytes.ToUpper(fields[modeIndex])
+
+		switch {
+		case bytes.Equal(upperMode, upperOn):
+			return build(true), nil
+		case bytes.Equal(upperMode, upperOff):
+			return build(false), nil
+		default:
+			return nil, fmt.Errorf("%w: %s expects ON or OFF, got %q", ErrInvalidArguments, command, string(fields[modeIndex]))
+		}
+	}
+}
+
+// parseBound parses SETMAX and SETMIN, which differ only in the query they build.
+func parseBound(build func(key []byte, value int64) Query) func(fields [][]byte) (Query, error) {
+	return func(fields [][]byte) (Query, error) {
 		const (
-			argsLen    = 3
 			keyIndex   = 1
 			valueIndex = 2
 		)
 
-		if l := len(fields); l != argsLen {
-			return nil, fmt.Errorf("%w: set expects %d arguments, got %d", ErrInvalidArguments, argsLen, l)
+		value, err := strconv.ParseInt(string(fields[valueIndex]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s expects an integer, got %q",
+				ErrInvalidArguments, bytes.ToLower(fields[0]), fields[valueIndex])
 		}
 
-		return &SetQuery{
-			Key:   fields[keyIndex],
-			Value: fields[valueIndex],
-		}, nil
+		return build(fields[keyIndex], value), nil
+	}
+}
 
-	case bytes.Equal(upperCommand, upperCommandGet):
-		const (
-			argsLen  = 2
-			keyIndex = 1
-		)
+func parseMSet(fields [][]byte) (Query, error) {
+	const minArgsLen = 3
 
-		if l := len(fields); l != argsLen {
-			return nil, fmt.Errorf("%w: get expects %d arguments, got %d", ErrInvalidArguments, argsLen, l)
-		}
+	l := len(fields)
+	if l < minArgsLen {
+		return nil, fmt.Errorf("%w: mset expects at least %d arguments, got %d", ErrInvalidArguments, minArgsLen, l)
+	}
 
-		return &GetQuery{
-			Key: fields[keyIndex],
-		}, nil
+	if (l-1)%2 != 0 {
+		return nil, fmt.Errorf("%w: mset expects key value pairs, got %d arguments", ErrInvalidArguments, l-1)
+	}
 
-	case bytes.Equal(upperCommand, upperCommandDel):
-		const (
-			argsLen  = 2
-			keyIndex = 1
-		)
+	pairs := make([]Pair, 0, (l-1)/2)
+	for i := 1; i < l; i += 2 {
+		pairs = append(pairs, Pair{Key: fields[i], Value: fields[i+1]})
+	}
 
-		if l := len(fields); l != argsLen {
-			return nil, fmt.Errorf("%w: del expects %d arguments, got %d", ErrInvalidArguments, argsLen, l)
+	return &MSetQuery{
+		Pairs: pairs,
+	}, nil
+}
+
+func parseMGet(fields [][]byte) (Query, error) {
+	const minArgsLen = 2
+
+	if l := len(fields); l < minArgsLen {
+		return nil, fmt.Errorf("%w: mget expects at least %d arguments, got %d", ErrInvalidArguments, minArgsLen, l)
+	}
+
+	return &MGetQuery{
+		Keys: fields[1:],
+	}, nil
+}
+
+func parseGetRange(fields [][]byte) (Query, error) {
+	const (
+		keyIndex   = 1
+		startIndex = 2
+		endIndex   = 3
+	)
+
+	start, err := strconv.ParseInt(string(fields[startIndex]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: getrange expects an integer start, got %q", ErrInvalidArguments, fields[startIndex])
+	}
+
+	end, err := strconv.ParseInt(string(fields[endIndex]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: getrange expects an integer end, got %q", ErrInvalidArguments, fields[endIndex])
+	}
+
+	return &GetRangeQuery{
+		Key:   fields[keyIndex],
+		Start: start,
+		End:   end,
+	}, nil
+}
+
+func parseExpire(fields [][]byte) (Query, error) {
+	const (
+		keyIndex     = 1
+		secondsIndex = 2
+	)
+
+	seconds, err := strconv.ParseInt(string(fields[secondsIndex]), 10, 64)
+	if err != nil || seconds <= 0 {
+		return nil, fmt.Errorf("%w: expire expects a positive number of seconds, got %q", ErrInvalidArguments, fields[secondsIndex])
+	}
+
+	return &ExpireQuery{
+		Key:     fields[keyIndex],
+		Seconds: seconds,
+	}, nil
+}
+
+func parseIncrEx(fields [][]byte) (Query, error) {
+	const (
+		keyIndex     = 1
+		secondsIndex = 2
+	)
+
+	seconds, err := strconv.ParseInt(string(fields[secondsIndex]), 10, 64)
+	if err != nil || seconds <= 0 {
+		return nil, fmt.Errorf("%w: increx expects a positive number of seconds, got %q", ErrInvalidArguments, fields[secondsIndex])
+	}
+
+	return &IncrExQuery{
+		Key:     fields[keyIndex],
+		Seconds: seconds,
+	}, nil
+}
+
+func parseRotate(fields [][]byte) (Query, error) {
+	const (
+		keyIndex     = 1
+		valueIndex   = 2
+		secondsIndex = 3
+	)
+
+	seconds, err := strconv.ParseInt(string(fields[secondsIndex]), 10, 64)
+	if err != nil || seconds <= 0 {
+		return nil, fmt.Errorf("%w: rotate expects a positive number of seconds, got %q", ErrInvalidArguments, fields[secondsIndex])
+	}
+
+	return &RotateQuery{
+		Key:     fields[keyIndex],
+		Value:   fields[valueIndex],
+		Seconds: seconds,
+	}, nil
+}
+
+// parsePattern parses FINDVALUE and KEYS, whose only argument is a glob pattern.
+func parsePattern(build func(pattern []byte) Query) func(fields [][]byte) (Query, error) {
+	return func(fields [][]byte) (Query, error) {
+		const patternIndex = 1
+
+		if !validGlob(fields[patternIndex]) {
+			return nil, fmt.Errorf("%w: %s: malformed pattern %q",
+				ErrInvalidArguments, bytes.ToLower(fields[0]), fields[patternIndex])
 		}
 
-		return &DelQuery{
-			Key: fields[keyIndex],
-		}, nil
+		return build(fields[patternIndex]), nil
+	}
+}
 
-	default:
-		return nil, fmt.Errorf("%w: %q", ErrUnknownCommand, string(fields[0]))
+func parseDefaultTTL(fields [][]byte) (Query, error) {
+	const secondsIndex = 1
+
+	seconds, err := strconv.ParseInt(string(fields[secondsIndex]), 10, 64)
+	if err != nil || seconds < 0 {
+		return nil, fmt.Errorf(
+			"%w: defaultttl expects a non-negative number of seconds, got %q", ErrInvalidArguments, fields[secondsIndex])
+	}
+
+	return &DefaultTTLQuery{
+		Seconds: seconds,
+	}, nil
+}
+
+func parseHelp(fields [][]byte) (Query, error) {
+	const commandIndex = 1
+
+	usage, ok := commandUsages[string(bytes.ToUpper(fields[commandIndex]))]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCommand, string(fields[commandIndex]))
 	}
+
+	return &HelpQuery{
+		Usage: usage,
+	}, nil
+}
+
+func (c *Compute) parseExplain(fields [][]byte) (Query, error) {
+	const (
+		minArgsLen   = 2
+		commandIndex = 1
+	)
+
+	if l := len(fields); l < minArgsLen {
+		return nil, fmt.Errorf("%w: explain expects at least %d arguments, got %d", ErrInvalidArguments, minArgsLen, l)
+	}
+
+	if bytes.EqualFold(fields[commandIndex], []byte(commandExplain)) {
+		return nil, fmt.Errorf("%w: explain cannot be nested", ErrInvalidArguments)
+	}
+
+	query, err := c.parse(fields[commandIndex:])
+	if err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+
+	return &ExplainQuery{
+		Query: query,
+	}, nil
 }
 
 func (c *Compute) parseFields(query []byte) ([][]byte, error) {
@@ -90,7 +455,16 @@ func (c *Compute) parseFields(query []byte) ([][]byte, error) {
 		return nil, fmt.Errorf("%w: expected from 0 to %d, got %d", ErrInvalidLen, c.maxLen, l)
 	}
 
-	fields := bytes.Fields(query)
+	if c.strict {
+		if err := checkCharacters(query); err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := splitFields(query)
+	if err != nil {
+		return nil, err
+	}
 
 	if l := len(fields); l == 0 {
 		return nil, ErrEmptyQuery
@@ -2,6 +2,8 @@ package compute_test
 
 import (
 	"bytes"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,6 +30,15 @@ func TestCompute_Parse(t *testing.T) {
 				Value: []byte("bar"),
 			},
 		},
+		{
+			name:  "valid SET with EX",
+			input: []byte("SET foo bar ex 30"),
+			want: &compute.SetQuery{
+				Key:     []byte("foo"),
+				Value:   []byte("bar"),
+				Seconds: 30,
+			},
+		},
 		{
 			name:  "valid GET",
 			input: []byte("GET foo"),
@@ -35,6 +46,11 @@ func TestCompute_Parse(t *testing.T) {
 				Key: []byte("foo"),
 			},
 		},
+		{
+			name:  "valid GETRANGE",
+			input: []byte("getrange foo -5 -1"),
+			want:  &compute.GetRangeQuery{Key: []byte("foo"), Start: -5, End: -1},
+		},
 		{
 			name:  "valid DEL",
 			input: []byte("DEL foo"),
@@ -42,6 +58,234 @@ func TestCompute_Parse(t *testing.T) {
 				Key: []byte("foo"),
 			},
 		},
+		{
+			name:  "valid GETDEFAULT",
+			input: []byte("GETDEFAULT foo bar"),
+			want: &compute.GetDefaultQuery{
+				Key:     []byte("foo"),
+				Default: []byte("bar"),
+			},
+		},
+		{
+			name:  "valid SETIMMUTABLE",
+			input: []byte("SETIMMUTABLE foo bar"),
+			want: &compute.SetImmutableQuery{
+				Key:   []byte("foo"),
+				Value: []byte("bar"),
+			},
+		},
+		{
+			name:  "valid UNLOCK",
+			input: []byte("UNLOCK foo"),
+			want: &compute.UnlockQuery{
+				Key: []byte("foo"),
+			},
+		},
+		{
+			name:  "valid DEBUG JMAP",
+			input: []byte("debug jmap"),
+			want:  &compute.DebugJMapQuery{},
+		},
+		{
+			name:  "valid LATENCY",
+			input: []byte("LATENCY"),
+			want:  &compute.LatencyQuery{},
+		},
+		{
+			name:  "valid STATS PARSE",
+			input: []byte("STATS PARSE"),
+			want:  &compute.StatsParseQuery{},
+		},
+		{
+			name:  "valid SETMAX",
+			input: []byte("SETMAX foo 42"),
+			want:  &compute.SetMaxQuery{Key: []byte("foo"), Value: 42},
+		},
+		{
+			name:  "valid SETMIN",
+			input: []byte("SETMIN foo -7"),
+			want:  &compute.SetMinQuery{Key: []byte("foo"), Value: -7},
+		},
+		{
+			name:  "valid GETPREFIX",
+			input: []byte("GETPREFIX user:"),
+			want:  &compute.GetPrefixQuery{Prefix: []byte("user:")},
+		},
+		{
+			name:  "valid EXISTS",
+			input: []byte("EXISTS foo"),
+			want:  &compute.ExistsQuery{Key: []byte("foo")},
+		},
+		{
+			name:  "valid INCR",
+			input: []byte("INCR counter"),
+			want:  &compute.IncrQuery{Key: []byte("counter")},
+		},
+		{
+			name:  "valid INCREX",
+			input: []byte("increx counter 60"),
+			want:  &compute.IncrExQuery{Key: []byte("counter"), Seconds: 60},
+		},
+		{
+			name:  "valid DECR",
+			input: []byte("decr counter"),
+			want:  &compute.DecrQuery{Key: []byte("counter")},
+		},
+		{
+			name:  "valid MSET",
+			input: []byte("MSET a 1 b 2"),
+			want: &compute.MSetQuery{
+				Pairs: []compute.Pair{
+					{Key: []byte("a"), Value: []byte("1")},
+					{Key: []byte("b"), Value: []byte("2")},
+				},
+			},
+		},
+		{
+			name:  "valid MGET",
+			input: []byte("MGET a b c"),
+			want:  &compute.MGetQuery{Keys: [][]byte{[]byte("a"), []byte("b"), []byte("c")}},
+		},
+		{
+			name:  "valid EXPIRE",
+			input: []byte("EXPIRE foo 10"),
+			want:  &compute.ExpireQuery{Key: []byte("foo"), Seconds: 10},
+		},
+		{
+			name:  "valid TTL",
+			input: []byte("TTL foo"),
+			want:  &compute.TTLQuery{Key: []byte("foo")},
+		},
+		{
+			name:  "valid DELIF",
+			input: []byte("DELIF foo bar"),
+			want:  &compute.DelIfQuery{Key: []byte("foo"), Expected: []byte("bar")},
+		},
+		{
+			name:  "valid DIFF",
+			input: []byte("DIFF a b"),
+			want:  &compute.DiffQuery{Key1: []byte("a"), Key2: []byte("b")},
+		},
+		{
+			name:  "valid ROTATE",
+			input: []byte("ROTATE token t2 30"),
+			want:  &compute.RotateQuery{Key: []byte("token"), Value: []byte("t2"), Seconds: 30},
+		},
+		{
+			name:  "valid APPENDSEP",
+			input: []byte("APPENDSEP list item"),
+			want:  &compute.AppendSepQuery{Key: []byte("list"), Value: []byte("item")},
+		},
+		{
+			name:  "valid FINDVALUE",
+			input: []byte("FINDVALUE user:*"),
+			want:  &compute.FindValueQuery{Pattern: []byte("user:*")},
+		},
+		{
+			name:  "valid DEFAULTTTL",
+			input: []byte("DEFAULTTTL 60"),
+			want:  &compute.DefaultTTLQuery{Seconds: 60},
+		},
+		{
+			name:  "DEFAULTTTL disabling the default",
+			input: []byte("defaultttl 0"),
+			want:  &compute.DefaultTTLQuery{Seconds: 0},
+		},
+		{
+			name:  "valid NOREPLY",
+			input: []byte("noreply on"),
+			want:  &compute.NoReplyQuery{Enabled: true},
+		},
+		{
+			name:  "NOREPLY turned off",
+			input: []byte("NOREPLY Off"),
+			want:  &compute.NoReplyQuery{Enabled: false},
+		},
+		{
+			name:  "valid STATUSLINE",
+			input: []byte("statusline ON"),
+			want:  &compute.StatusLineQuery{Enabled: true},
+		},
+		{
+			name:  "valid ECHO",
+			input: []byte(`ECHO "hello world\t\"x\"\\"`),
+			want:  &compute.EchoQuery{Message: []byte("hello world\t\"x\"\\")},
+		},
+		{
+			name:  "valid FLUSH",
+			input: []byte("flush"),
+			want:  &compute.FlushQuery{},
+		},
+		{
+			name:  "valid DBSIZE",
+			input: []byte("dbsize"),
+			want:  &compute.DBSizeQuery{},
+		},
+		{
+			name:  "valid INDEXGET",
+			input: []byte("indexget admin"),
+			want:  &compute.IndexGetQuery{Field: []byte("admin")},
+		},
+		{
+			name:  "valid KEYS",
+			input: []byte("keys user:?"),
+			want:  &compute.KeysQuery{Pattern: []byte("user:?")},
+		},
+		{
+			name:  "valid EXPLAIN",
+			input: []byte(`explain SET greeting "hello world"`),
+			want: &compute.ExplainQuery{
+				Query: &compute.SetQuery{Key: []byte("greeting"), Value: []byte("hello world")},
+			},
+		},
+		{
+			name:  "quoted value with spaces",
+			input: []byte(`SET greeting "hello world"`),
+			want: &compute.SetQuery{
+				Key:   []byte("greeting"),
+				Value: []byte("hello world"),
+			},
+		},
+		{
+			name:  "quoted key and empty quoted value",
+			input: []byte(`SET "my key"   ""`),
+			want: &compute.SetQuery{
+				Key:   []byte("my key"),
+				Value: []byte{},
+			},
+		},
+		{
+			name:  "quote inside unquoted token is literal",
+			input: []byte(`SET foo ba"r`),
+			want: &compute.SetQuery{
+				Key:   []byte("foo"),
+				Value: []byte(`ba"r`),
+			},
+		},
+		{
+			name:  "escaped quotes inside quoted value",
+			input: []byte(`SET k "say \"hi\" now"`),
+			want: &compute.SetQuery{
+				Key:   []byte("k"),
+				Value: []byte(`say "hi" now`),
+			},
+		},
+		{
+			name:  "escapes in unquoted value",
+			input: []byte(`SET k a\nb\tc\\d`),
+			want: &compute.SetQuery{
+				Key:   []byte("k"),
+				Value: []byte("a\nb\tc\\d"),
+			},
+		},
+		{
+			name:  "escaped backslash before closing quote",
+			input: []byte(`SET k "dir\\"`),
+			want: &compute.SetQuery{
+				Key:   []byte("k"),
+				Value: []byte(`dir\`),
+			},
+		},
 		{
 			name:  "lowercase command",
 			input: []byte("set foo bar"),
@@ -117,14 +361,151 @@ func TestCompute_Parse(t *testing.T) {
 				require.True(t, ok, "expected SetQuery, got %T", got)
 				assert.Equal(t, expected.Key, actual.Key)
 				assert.Equal(t, expected.Value, actual.Value)
+				assert.Equal(t, expected.Seconds, actual.Seconds)
 			case *compute.GetQuery:
 				actual, ok := got.(*compute.GetQuery)
 				require.True(t, ok, "expected GetQuery, got %T", got)
 				assert.Equal(t, expected.Key, actual.Key)
+			case *compute.GetRangeQuery:
+				actual, ok := got.(*compute.GetRangeQuery)
+				require.True(t, ok, "expected GetRangeQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Start, actual.Start)
+				assert.Equal(t, expected.End, actual.End)
 			case *compute.DelQuery:
 				actual, ok := got.(*compute.DelQuery)
 				require.True(t, ok, "expected DelQuery, got %T", got)
 				assert.Equal(t, expected.Key, actual.Key)
+			case *compute.GetDefaultQuery:
+				actual, ok := got.(*compute.GetDefaultQuery)
+				require.True(t, ok, "expected GetDefaultQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Default, actual.Default)
+			case *compute.SetImmutableQuery:
+				actual, ok := got.(*compute.SetImmutableQuery)
+				require.True(t, ok, "expected SetImmutableQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Value, actual.Value)
+			case *compute.UnlockQuery:
+				actual, ok := got.(*compute.UnlockQuery)
+				require.True(t, ok, "expected UnlockQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+			case *compute.DebugJMapQuery:
+				_, ok := got.(*compute.DebugJMapQuery)
+				require.True(t, ok, "expected DebugJMapQuery, got %T", got)
+			case *compute.LatencyQuery:
+				_, ok := got.(*compute.LatencyQuery)
+				require.True(t, ok, "expected LatencyQuery, got %T", got)
+			case *compute.StatsParseQuery:
+				_, ok := got.(*compute.StatsParseQuery)
+				require.True(t, ok, "expected StatsParseQuery, got %T", got)
+			case *compute.SetMaxQuery:
+				actual, ok := got.(*compute.SetMaxQuery)
+				require.True(t, ok, "expected SetMaxQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Value, actual.Value)
+			case *compute.SetMinQuery:
+				actual, ok := got.(*compute.SetMinQuery)
+				require.True(t, ok, "expected SetMinQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Value, actual.Value)
+			case *compute.ExistsQuery:
+				actual, ok := got.(*compute.ExistsQuery)
+				require.True(t, ok, "expected ExistsQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+			case *compute.IncrQuery:
+				actual, ok := got.(*compute.IncrQuery)
+				require.True(t, ok, "expected IncrQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+			case *compute.DecrQuery:
+				actual, ok := got.(*compute.DecrQuery)
+				require.True(t, ok, "expected DecrQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+			case *compute.MSetQuery:
+				actual, ok := got.(*compute.MSetQuery)
+				require.True(t, ok, "expected MSetQuery, got %T", got)
+				assert.Equal(t, expected.Pairs, actual.Pairs)
+			case *compute.MGetQuery:
+				actual, ok := got.(*compute.MGetQuery)
+				require.True(t, ok, "expected MGetQuery, got %T", got)
+				assert.Equal(t, expected.Keys, actual.Keys)
+			case *compute.ExpireQuery:
+				actual, ok := got.(*compute.ExpireQuery)
+				require.True(t, ok, "expected ExpireQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Seconds, actual.Seconds)
+			case *compute.IncrExQuery:
+				actual, ok := got.(*compute.IncrExQuery)
+				require.True(t, ok, "expected IncrExQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Seconds, actual.Seconds)
+			case *compute.TTLQuery:
+				actual, ok := got.(*compute.TTLQuery)
+				require.True(t, ok, "expected TTLQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+			case *compute.DelIfQuery:
+				actual, ok := got.(*compute.DelIfQuery)
+				require.True(t, ok, "expected DelIfQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Expected, actual.Expected)
+			case *compute.DiffQuery:
+				actual, ok := got.(*compute.DiffQuery)
+				require.True(t, ok, "expected DiffQuery, got %T", got)
+				assert.Equal(t, expected.Key1, actual.Key1)
+				assert.Equal(t, expected.Key2, actual.Key2)
+			case *compute.RotateQuery:
+				actual, ok := got.(*compute.RotateQuery)
+				require.True(t, ok, "expected RotateQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Value, actual.Value)
+				assert.Equal(t, expected.Seconds, actual.Seconds)
+			case *compute.AppendSepQuery:
+				actual, ok := got.(*compute.AppendSepQuery)
+				require.True(t, ok, "expected AppendSepQuery, got %T", got)
+				assert.Equal(t, expected.Key, actual.Key)
+				assert.Equal(t, expected.Value, actual.Value)
+			case *compute.FindValueQuery:
+				actual, ok := got.(*compute.FindValueQuery)
+				require.True(t, ok, "expected FindValueQuery, got %T", got)
+				assert.Equal(t, expected.Pattern, actual.Pattern)
+			case *compute.FlushQuery:
+				_, ok := got.(*compute.FlushQuery)
+				require.True(t, ok, "expected FlushQuery, got %T", got)
+			case *compute.DBSizeQuery:
+				_, ok := got.(*compute.DBSizeQuery)
+				require.True(t, ok, "expected DBSizeQuery, got %T", got)
+			case *compute.IndexGetQuery:
+				actual, ok := got.(*compute.IndexGetQuery)
+				require.True(t, ok, "expected IndexGetQuery, got %T", got)
+				assert.Equal(t, expected.Field, actual.Field)
+			case *compute.KeysQuery:
+				actual, ok := got.(*compute.KeysQuery)
+				require.True(t, ok, "expected KeysQuery, got %T", got)
+				assert.Equal(t, expected.Pattern, actual.Pattern)
+			case *compute.DefaultTTLQuery:
+				actual, ok := got.(*compute.DefaultTTLQuery)
+				require.True(t, ok, "expected DefaultTTLQuery, got %T", got)
+				assert.Equal(t, expected.Seconds, actual.Seconds)
+			case *compute.NoReplyQuery:
+				actual, ok := got.(*compute.NoReplyQuery)
+				require.True(t, ok, "expected NoReplyQuery, got %T", got)
+				assert.Equal(t, expected.Enabled, actual.Enabled)
+			case *compute.StatusLineQuery:
+				actual, ok := got.(*compute.StatusLineQuery)
+				require.True(t, ok, "expected StatusLineQuery, got %T", got)
+				assert.Equal(t, expected.Enabled, actual.Enabled)
+			case *compute.EchoQuery:
+				actual, ok := got.(*compute.EchoQuery)
+				require.True(t, ok, "expected EchoQuery, got %T", got)
+				assert.Equal(t, expected.Message, actual.Message)
+			case *compute.ExplainQuery:
+				actual, ok := got.(*compute.ExplainQuery)
+				require.True(t, ok, "expected ExplainQuery, got %T", got)
+				assert.Equal(t, expected.Query, actual.Query)
+			case *compute.GetPrefixQuery:
+				actual, ok := got.(*compute.GetPrefixQuery)
+				require.True(t, ok, "expected GetPrefixQuery, got %T", got)
+				assert.Equal(t, expected.Prefix, actual.Prefix)
 			default:
 				require.Fail(t, "unexpected query type", "got %T", got)
 			}
@@ -167,6 +548,21 @@ func TestCompute_ParseInvalid(t *testing.T) {
 			input:   []byte("SET foo"),
 			wantErr: compute.ErrInvalidArguments,
 		},
+		{
+			name:    "SET with an unknown option",
+			input:   []byte("SET foo bar PX 30"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "SET with zero EX",
+			input:   []byte("SET foo bar EX 0"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "SET with EX but no seconds",
+			input:   []byte("SET foo bar EX"),
+			wantErr: compute.ErrInvalidArguments,
+		},
 		{
 			name:    "GET with too many args",
 			input:   []byte("GET foo bar"),
@@ -177,6 +573,251 @@ func TestCompute_ParseInvalid(t *testing.T) {
 			input:   []byte("DEL foo bar"),
 			wantErr: compute.ErrInvalidArguments,
 		},
+		{
+			name:    "GETDEFAULT without default",
+			input:   []byte("GETDEFAULT foo"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "SETIMMUTABLE without value",
+			input:   []byte("SETIMMUTABLE foo"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "UNLOCK with too many args",
+			input:   []byte("UNLOCK foo bar"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "DEBUG without subcommand",
+			input:   []byte("DEBUG"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "DEBUG with unknown subcommand",
+			input:   []byte("DEBUG FOO"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "LATENCY with args",
+			input:   []byte("LATENCY foo"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "STATS with unknown subcommand",
+			input:   []byte("STATS FOO"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "SETMAX with non-integer",
+			input:   []byte("SETMAX foo 1.5"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "SETMIN without value",
+			input:   []byte("SETMIN foo"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "EXISTS with extra argument",
+			input:   []byte("EXISTS foo bar"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "INCR without key",
+			input:   []byte("INCR"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "DECR with extra argument",
+			input:   []byte("DECR counter 2"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "MSET without pairs",
+			input:   []byte("MSET"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "MSET with odd number of arguments",
+			input:   []byte("MSET a 1 b"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "MGET without keys",
+			input:   []byte("MGET"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "EXPIRE with zero seconds",
+			input:   []byte("EXPIRE foo 0"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "EXPIRE with non-integer seconds",
+			input:   []byte("EXPIRE foo soon"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "INCREX without seconds",
+			input:   []byte("INCREX counter"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "INCREX with negative seconds",
+			input:   []byte("INCREX counter -1"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "TTL without key",
+			input:   []byte("TTL"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "DELIF without expected value",
+			input:   []byte("DELIF foo"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "DIFF with one key",
+			input:   []byte("DIFF a"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "ROTATE without seconds",
+			input:   []byte("ROTATE token t2"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "ROTATE with zero seconds",
+			input:   []byte("ROTATE token t2 0"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "APPENDSEP without value",
+			input:   []byte("APPENDSEP list"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "FINDVALUE with unterminated class",
+			input:   []byte("FINDVALUE a[bc"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "FINDVALUE with trailing backslash",
+			input:   []byte(`FINDVALUE "a\\"`),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "FLUSH with args",
+			input:   []byte("FLUSH all"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "DBSIZE with args",
+			input:   []byte("DBSIZE k"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "INDEXGET without value",
+			input:   []byte("INDEXGET"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "KEYS without pattern",
+			input:   []byte("KEYS"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "KEYS with unterminated class",
+			input:   []byte("KEYS user:[12"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "DEFAULTTTL with negative seconds",
+			input:   []byte("DEFAULTTTL -1"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "NOREPLY with unknown mode",
+			input:   []byte("NOREPLY maybe"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "STATUSLINE with unknown mode",
+			input:   []byte("STATUSLINE 1"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "DEFAULTTTL without seconds",
+			input:   []byte("DEFAULTTTL"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "ECHO with unquoted spaces",
+			input:   []byte("ECHO hello world"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "EXPLAIN without command",
+			input:   []byte("EXPLAIN"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "EXPLAIN of unknown command",
+			input:   []byte("EXPLAIN PING"),
+			wantErr: compute.ErrUnknownCommand,
+		},
+		{
+			name:    "EXPLAIN of invalid command",
+			input:   []byte(`EXPLAIN SET "unterminated`),
+			wantErr: compute.ErrUnterminatedQuote,
+		},
+		{
+			name:    "nested EXPLAIN",
+			input:   []byte("EXPLAIN explain GET a"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "GETPREFIX without prefix",
+			input:   []byte("GETPREFIX"),
+			wantErr: compute.ErrInvalidArguments,
+		},
+		{
+			name:    "quoted value counts quotes towards maxLen",
+			input:   []byte(`SET k "` + strings.Repeat("a", 93) + `"`),
+			wantErr: compute.ErrInvalidLen,
+		},
+		{
+			name:    "unterminated quote",
+			input:   []byte(`SET greeting "hello world`),
+			wantErr: compute.ErrUnterminatedQuote,
+		},
+		{
+			name:    "unknown escape",
+			input:   []byte(`SET k a\xb`),
+			wantErr: compute.ErrInvalidEscape,
+		},
+		{
+			name:    "trailing lone backslash",
+			input:   []byte(`SET k abc\`),
+			wantErr: compute.ErrInvalidEscape,
+		},
+		{
+			name:    "trailing lone backslash inside quotes",
+			input:   []byte(`SET k "abc\`),
+			wantErr: compute.ErrInvalidEscape,
+		},
+		{
+			name:    "escaped closing quote leaves quote unterminated",
+			input:   []byte(`SET k "abc\"`),
+			wantErr: compute.ErrUnterminatedQuote,
+		},
+		{
+			name:    "closing quote followed by text",
+			input:   []byte(`SET greeting "hello"world`),
+			wantErr: compute.ErrInvalidArguments,
+		},
 		{
 			name:    "SET without args",
 			input:   []byte("SET"),
@@ -187,6 +828,11 @@ func TestCompute_ParseInvalid(t *testing.T) {
 			input:   []byte("GET"),
 			wantErr: compute.ErrInvalidArguments,
 		},
+		{
+			name:    "GETRANGE with a non-integer offset",
+			input:   []byte("GETRANGE foo 0 end"),
+			wantErr: compute.ErrInvalidArguments,
+		},
 		{
 			name:    "DEL without args",
 			input:   []byte("DEL"),
@@ -203,6 +849,476 @@ func TestCompute_ParseInvalid(t *testing.T) {
 	}
 }
 
+func TestCompute_ParseArgLimits(t *testing.T) {
+	c := compute.NewCompute(4096,
+		compute.WithArgLimits("set", compute.ArgLimits{MaxKeyLen: 8, MaxValueLen: 1024}),
+		compute.WithArgLimits("MSET", compute.ArgLimits{MaxKeyLen: 8}),
+		compute.WithArgLimits("GET", compute.ArgLimits{MaxKeyLen: 4}),
+	)
+
+	longKey := strings.Repeat("k", 9)
+	largeValue := strings.Repeat("v", 1024)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "large value under its limit", input: "SET key " + largeValue},
+		{name: "over-long key", input: "SET " + longKey + " v", wantErr: compute.ErrInvalidArguments},
+		{name: "over-long value", input: "SET key " + largeValue + "v", wantErr: compute.ErrInvalidArguments},
+		{name: "lowercase command", input: "set " + longKey + " v", wantErr: compute.ErrInvalidArguments},
+		{name: "any pair of MSET", input: "MSET a 1 " + longKey + " 2", wantErr: compute.ErrInvalidArguments},
+		{name: "MSET value unbounded", input: "MSET a " + largeValue + "v"},
+		{name: "limit per command", input: "GET " + longKey[:5], wantErr: compute.ErrInvalidArguments},
+		{name: "command without limits", input: "DEL " + longKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := c.Parse([]byte(tt.input))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, query)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotNil(t, query)
+		})
+	}
+
+	_, err := c.Parse([]byte("SET " + longKey + " v"))
+	require.ErrorIs(t, err, compute.ErrKeyTooLong)
+	assert.EqualError(t, err, "invalid arguments: key too long: set key of 9 bytes exceeds the limit of 8 bytes")
+
+	_, err = c.Parse([]byte("SET key " + largeValue + "v"))
+	require.ErrorIs(t, err, compute.ErrValueTooLong)
+}
+
+func TestIsCommand(t *testing.T) {
+	assert.True(t, compute.IsCommand("SET"))
+	assert.True(t, compute.IsCommand("getprefix"))
+	assert.True(t, compute.IsCommand("EXPLAIN"))
+	assert.False(t, compute.IsCommand("FETCH"))
+	assert.False(t, compute.IsCommand(""))
+}
+
+func TestCompute_ParseMaxArgLens(t *testing.T) {
+	c := compute.NewCompute(4096, compute.WithMaxArgLens(4, 8))
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "key at the limit", input: "SET abcd 12345678"},
+		{name: "key over the limit", input: "SET abcde 1", wantErr: compute.ErrKeyTooLong},
+		{name: "value at the limit", input: "SET k 12345678"},
+		{name: "value over the limit", input: "SET k 123456789", wantErr: compute.ErrValueTooLong},
+		{name: "every key of a command", input: "MGET a abcde", wantErr: compute.ErrKeyTooLong},
+		{name: "second key", input: "DIFF abcd abcde", wantErr: compute.ErrKeyTooLong},
+		{name: "compared value", input: "DELIF k 123456789", wantErr: compute.ErrValueTooLong},
+		{name: "key prefix", input: "GETPREFIX abcde", wantErr: compute.ErrKeyTooLong},
+		{name: "key pattern", input: "KEYS abcd*", wantErr: compute.ErrKeyTooLong},
+		{name: "value pattern", input: "FINDVALUE 12345678*", wantErr: compute.ErrValueTooLong},
+		{name: "arguments that are neither", input: "ECHO 123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := c.Parse([]byte(tt.input))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				require.ErrorIs(t, err, compute.ErrInvalidArguments)
+				assert.Nil(t, query)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotNil(t, query)
+		})
+	}
+
+	_, err := c.Parse([]byte("SET abcde v"))
+	assert.EqualError(t, err, "invalid arguments: key too long: set key of 5 bytes exceeds the limit of 4 bytes")
+
+	_, err = compute.NewCompute(4096).Parse([]byte("SET " + strings.Repeat("k", 1024) + " " + strings.Repeat("v", 2048)))
+	require.NoError(t, err, "unlimited by default")
+}
+
+func TestCompute_ParseStrict(t *testing.T) {
+	c := compute.NewCompute(128, compute.WithStrict(true))
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "punctuation", input: "SET user:1/a_b *-?.,!@#$%^&()[]{}<>=+~|;'`"},
+		{name: "quoted spaces and escapes", input: `SET k "a b\tc\n\"d\""`},
+		{name: "tab and carriage return between fields", input: "GET\tk\r"},
+		{name: "NUL byte", input: "SET k a\x00b", wantErr: compute.ErrInvalidCharacter},
+		{name: "escape byte", input: "GET \x1bk", wantErr: compute.ErrInvalidCharacter},
+		{name: "DEL byte", input: "GET k\x7f", wantErr: compute.ErrInvalidCharacter},
+		{name: "tab inside quotes", input: "SET k \"a\tb\"", wantErr: compute.ErrInvalidCharacter},
+		{name: "non-ASCII", input: "SET k \u00e9", wantErr: compute.ErrInvalidCharacter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := c.Parse([]byte(tt.input))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, query)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotNil(t, query)
+		})
+	}
+
+	_, err := c.Parse([]byte("SET k a\x00b"))
+	assert.EqualError(t, err, "invalid character: byte 0x00 at offset 7")
+
+	query, err := compute.NewCompute(128).Parse([]byte("SET k a\x00b"))
+	require.NoError(t, err, "not strict by default")
+	assert.Equal(t, &compute.SetQuery{Key: []byte("k"), Value: []byte("a\x00b")}, query)
+}
+
+func TestCompute_ParseMulti(t *testing.T) {
+	c := compute.NewCompute(128)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []compute.Query
+		wantErr error
+	}{
+		{
+			name:  "several queries",
+			input: "SET a 1; SET b 2; GET a",
+			want: []compute.Query{
+				&compute.SetQuery{Key: []byte("a"), Value: []byte("1")},
+				&compute.SetQuery{Key: []byte("b"), Value: []byte("2")},
+				&compute.GetQuery{Key: []byte("a")},
+			},
+		},
+		{
+			name:  "trailing semicolon",
+			input: "GET a;",
+			want:  []compute.Query{&compute.GetQuery{Key: []byte("a")}},
+		},
+		{
+			name:  "empty segments",
+			input: ";; GET a ; ;GET b;",
+			want:  []compute.Query{&compute.GetQuery{Key: []byte("a")}, &compute.GetQuery{Key: []byte("b")}},
+		},
+		{
+			name:  "quoted semicolon",
+			input: `SET a "x; y";GET a`,
+			want: []compute.Query{
+				&compute.SetQuery{Key: []byte("a"), Value: []byte("x; y")},
+				&compute.GetQuery{Key: []byte("a")},
+			},
+		},
+		{
+			name:  "escaped quote inside quotes",
+			input: `SET a "\";";GET a`,
+			want: []compute.Query{
+				&compute.SetQuery{Key: []byte("a"), Value: []byte(`";`)},
+				&compute.GetQuery{Key: []byte("a")},
+			},
+		},
+		{name: "only separators", input: " ; ;", wantErr: compute.ErrEmptyQuery},
+		{name: "invalid query", input: "GET a; FETCH b", wantErr: compute.ErrUnknownCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ParseMulti([]byte(tt.input))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, got)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCompute_RegisterCommand(t *testing.T) {
+	c := compute.NewCompute(128)
+	err := c.RegisterCommand("shout", 1, func(args [][]byte) compute.Query {
+		return &compute.EchoQuery{Message: bytes.ToUpper(args[0])}
+	})
+	require.NoError(t, err)
+
+	got, err := c.Parse([]byte("SHOUT hello"))
+	require.NoError(t, err)
+	assert.Equal(t, &compute.EchoQuery{Message: []byte("HELLO")}, got)
+
+	got, err = c.Parse([]byte("EXPLAIN shout hi"))
+	require.NoError(t, err)
+	assert.Equal(t, &compute.ExplainQuery{Query: &compute.EchoQuery{Message: []byte("HI")}}, got)
+
+	_, err = c.Parse([]byte("shout"))
+	require.ErrorIs(t, err, compute.ErrInvalidArguments)
+	assert.EqualError(t, err, "invalid arguments: shout expects 2 arguments, got 1")
+
+	_, err = compute.NewCompute(128).Parse([]byte("SHOUT hello"))
+	require.ErrorIs(t, err, compute.ErrUnknownCommand, "commands are registered per Compute")
+
+	err = c.RegisterCommand("Get", 1, func([][]byte) compute.Query { return &compute.LatencyQuery{} })
+	require.ErrorIs(t, err, compute.ErrCommandExists, "built-in names are taken")
+	assert.EqualError(t, err, `command already registered: "GET"`)
+
+	err = c.RegisterCommand("SHOUT", 1, func([][]byte) compute.Query { return &compute.LatencyQuery{} })
+	require.ErrorIs(t, err, compute.ErrCommandExists, "registered names are taken")
+
+	got, err = c.Parse([]byte("GET k"))
+	require.NoError(t, err)
+	assert.Equal(t, &compute.GetQuery{Key: []byte("k")}, got, "a refused command leaves the existing one in place")
+}
+
+func TestCompute_ParseError(t *testing.T) {
+	c := compute.NewCompute(128, compute.WithArgLimits("SET", compute.ArgLimits{MaxKeyLen: 2}))
+
+	tests := []struct {
+		name    string
+		input   string
+		want    compute.ParseError
+		wantMsg string
+	}{
+		{
+			name:    "unknown command",
+			input:   "ping a b",
+			want:    compute.ParseError{Kind: compute.ErrUnknownCommand, Command: "PING", Args: 2},
+			wantMsg: `unknown command: "ping"`,
+		},
+		{
+			name:    "argument count",
+			input:   "get a b",
+			want:    compute.ParseError{Kind: compute.ErrInvalidArguments, Command: "GET", Args: 2},
+			wantMsg: "invalid arguments: get expects 2 arguments, got 3",
+		},
+		{
+			name:    "argument value",
+			input:   "EXPIRE a soon",
+			want:    compute.ParseError{Kind: compute.ErrInvalidArguments, Command: "EXPIRE", Args: 2},
+			wantMsg: `invalid arguments: expire expects a positive number of seconds, got "soon"`,
+		},
+		{
+			name:    "argument limit",
+			input:   "SET key v",
+			want:    compute.ParseError{Kind: compute.ErrInvalidArguments, Command: "SET", Args: 2},
+			wantMsg: "invalid arguments: key too long: set key of 3 bytes exceeds the limit of 2 bytes",
+		},
+		{
+			name:    "unknown command nested in EXPLAIN",
+			input:   "EXPLAIN ping",
+			want:    compute.ParseError{Kind: compute.ErrUnknownCommand, Command: "PING", Args: 0},
+			wantMsg: `explain: unknown command: "ping"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.Parse([]byte(tt.input))
+			require.ErrorIs(t, err, tt.want.Kind)
+			assert.EqualError(t, err, tt.wantMsg)
+
+			var pe *compute.ParseError
+			require.ErrorAs(t, err, &pe)
+			assert.Equal(t, tt.want.Kind, pe.Kind)
+			assert.Equal(t, tt.want.Command, pe.Command)
+			assert.Equal(t, tt.want.Args, pe.Args)
+		})
+	}
+
+	t.Run("other errors", func(t *testing.T) {
+		_, err := c.Parse([]byte(`GET "a`))
+		require.ErrorIs(t, err, compute.ErrUnterminatedQuote)
+
+		var pe *compute.ParseError
+		assert.False(t, errors.As(err, &pe))
+	})
+}
+
+func TestCompute_ParseHelp(t *testing.T) {
+	c := compute.NewCompute(100)
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "SET", want: "SET key value [EX seconds] - store a value, expiring after seconds if given"},
+		{command: "GET", want: "GET key - retrieve a value"},
+		{command: "GETRANGE", want: "GETRANGE key start end - retrieve the bytes of a value from start to end, negative offsets count from its end"},
+		{command: "DEL", want: "DEL key - delete a key"},
+		{command: "GETDEFAULT", want: "GETDEFAULT key default - retrieve a value, storing default if the key is missing"},
+		{command: "SETIMMUTABLE", want: "SETIMMUTABLE key value - store a value that rejects further SET and DEL"},
+		{command: "UNLOCK", want: "UNLOCK key - make an immutable key writable again"},
+		{command: "DEBUG", want: "DEBUG JMAP - report engine map statistics"},
+		{command: "HELP", want: "HELP command - describe a command"},
+		{command: "LATENCY", want: "LATENCY - report p50/p95/p99 query latency"},
+		{command: "STATS", want: "STATS PARSE - report parse error counters"},
+		{command: "SETMAX", want: "SETMAX key number - store number if it is greater than the current value"},
+		{command: "SETMIN", want: "SETMIN key number - store number if it is less than the current value"},
+		{command: "GETPREFIX", want: "GETPREFIX prefix - retrieve every key and value whose key starts with prefix"},
+		{command: "EXISTS", want: "EXISTS key - report 1 if the key is present, 0 otherwise"},
+		{command: "INCR", want: "INCR key - add 1 to the integer value, starting from 0 if the key is missing"},
+		{command: "INCREX", want: "INCREX key seconds - INCR the key, expiring it after seconds if INCREX created it"},
+		{command: "DECR", want: "DECR key - subtract 1 from the integer value, starting from 0 if the key is missing"},
+		{command: "MSET", want: "MSET key value [key value ...] - store several values"},
+		{command: "MGET", want: "MGET key [key ...] - retrieve several values, one line per key, (nil) for a missing one"},
+		{command: "EXPIRE", want: "EXPIRE key seconds - delete the key once seconds have passed"},
+		{command: "TTL", want: "TTL key - report the seconds left before the key expires, -1 if it never does, -2 if it is missing"},
+		{command: "DELIF", want: "DELIF key expected - delete the key only if its value equals expected"},
+		{command: "DIFF", want: "DIFF key key - report whether two values are equal and the first differing byte offset"},
+		{command: "ROTATE", want: "ROTATE key value seconds - store a value that expires after seconds and return the one it replaced"},
+		{command: "EXPLAIN", want: "EXPLAIN command [argument ...] - describe how a query parses without executing it"},
+		{command: "APPENDSEP", want: "APPENDSEP key value - append a value after a separator and report the new length"},
+		{command: "FINDVALUE", want: "FINDVALUE pattern - list the keys whose values match a glob pattern, one per line"},
+		{command: "DEFAULTTTL", want: "DEFAULTTTL seconds - expire later SETs on this connection after seconds, 0 disables"},
+		{command: "NOREPLY", want: "NOREPLY ON|OFF - leave successful SETs and DELs on this connection unanswered"},
+		{command: "STATUSLINE", want: "STATUSLINE ON|OFF - prefix answers on this connection with +OK so values stand apart from errors"},
+		{command: "ECHO", want: "ECHO message - return message unchanged; time it on the client to measure round-trip latency"},
+		{command: "KEYS", want: "KEYS pattern - list the keys matching a glob pattern, one per line"},
+		{command: "FLUSH", want: "FLUSH - delete every key, immutable ones included"},
+		{command: "DBSIZE", want: "DBSIZE - report the number of keys"},
+		{command: "INDEXGET", want: "INDEXGET value - list the indexed keys holding value, one per line"},
+		{command: "get", want: "GET key - retrieve a value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := c.Parse([]byte("HELP " + tt.command))
+			require.NoError(t, err)
+
+			actual, ok := got.(*compute.HelpQuery)
+			require.True(t, ok, "expected HelpQuery, got %T", got)
+			assert.Equal(t, tt.want, actual.Usage)
+		})
+	}
+
+	t.Run("unknown command", func(t *testing.T) {
+		got, err := c.Parse([]byte("HELP PING"))
+		require.ErrorIs(t, err, compute.ErrUnknownCommand)
+		assert.Nil(t, got)
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		got, err := c.Parse([]byte("HELP"))
+		require.ErrorIs(t, err, compute.ErrInvalidArguments)
+		assert.Nil(t, got)
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	c := compute.NewCompute(100)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "SET foo bar", want: "SET key=foo value=bar"},
+		{query: `SET "my key" ""`, want: `SET key="my key" value=""`},
+		{query: `SET foo "a\"b\\c\td"`, want: `SET key=foo value="a\"b\\c\td"`},
+		{query: "SET foo bar EX 30", want: "SET key=foo value=bar seconds=30"},
+		{query: "getdefault k d", want: "GETDEFAULT key=k default=d"},
+		{query: "SETMAX k -5", want: "SETMAX key=k value=-5"},
+		{query: "MSET a 1 b 2", want: "MSET pairs=[{key=a value=1} {key=b value=2}]"},
+		{query: "MGET a b", want: "MGET keys=[a b]"},
+		{query: "DEBUG JMAP", want: "DEBUG JMAP"},
+		{query: "STATS PARSE", want: "STATS PARSE"},
+		{query: "LATENCY", want: "LATENCY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := c.Parse([]byte(tt.query))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, compute.Describe(q))
+		})
+	}
+}
+
+func TestDescribe_RoundTrip(t *testing.T) {
+	c := compute.NewCompute(100)
+
+	for _, value := range []string{"a\x01b", "line\nbreak", "tab\t\"quoted\" back\\slash", "\x7f"} {
+		described := compute.Describe(&compute.GetDefaultQuery{Key: []byte("k"), Default: []byte(value)})
+		argument, ok := strings.CutPrefix(described, "GETDEFAULT key=k default=")
+		require.True(t, ok, described)
+
+		q, err := c.Parse([]byte("GETDEFAULT k " + argument))
+		require.NoError(t, err, "described as %s", argument)
+		assert.Equal(t, &compute.GetDefaultQuery{Key: []byte("k"), Default: []byte(value)}, q, "described as %s", argument)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{pattern: "", s: "", want: true},
+		{pattern: "", s: "a", want: false},
+		{pattern: "*", s: "", want: true},
+		{pattern: "*", s: "a/b\nc", want: true},
+		{pattern: "abc", s: "abc", want: true},
+		{pattern: "abc", s: "abcd", want: false},
+		{pattern: "a?c", s: "abc", want: true},
+		{pattern: "a?c", s: "ac", want: false},
+		{pattern: "a*c", s: "abbbc", want: true},
+		{pattern: "a*c", s: "abbbd", want: false},
+		{pattern: "*b*b*", s: "abcbd", want: true},
+		{pattern: "*.json", s: "a.json.bak", want: false},
+		{pattern: "[abc]x", s: "bx", want: true},
+		{pattern: "[abc]x", s: "dx", want: false},
+		{pattern: "[a-c]*", s: "cat", want: true},
+		{pattern: "[^a-c]*", s: "cat", want: false},
+		{pattern: "[!a-c]*", s: "dog", want: true},
+		{pattern: "[]]", s: "]", want: true},
+		{pattern: `\*`, s: "*", want: true},
+		{pattern: `\*`, s: "a", want: false},
+		{pattern: `[\]]`, s: "]", want: true},
+		{pattern: "\x00*", s: "\x00\xff", want: true},
+		{pattern: "?", s: "\xff", want: true},
+		{pattern: "[", s: "[", want: false},
+		{pattern: "a[b", s: "a[b", want: false},
+		{pattern: "*[", s: "", want: false},
+		{pattern: `a\`, s: `a\`, want: false},
+		{pattern: `*\`, s: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.s, func(t *testing.T) {
+			assert.Equal(t, tt.want, compute.MatchGlob([]byte(tt.pattern), []byte(tt.s)))
+		})
+	}
+}
+
+func FuzzMatchGlob(f *testing.F) {
+	f.Add([]byte("[a-c]*"), []byte("cat"))
+	f.Add([]byte("["), []byte("["))
+	f.Add([]byte(`\`), []byte(""))
+
+	f.Fuzz(func(t *testing.T, pattern, s []byte) {
+		_ = compute.MatchGlob(pattern, s)
+	})
+}
+
 func FuzzComputeParse(f *testing.F) {
 	f.Add(10, []byte("SET foo bar"))
 	f.Add(15, []byte("GET key"))
@@ -210,6 +1326,10 @@ func FuzzComputeParse(f *testing.F) {
 	f.Add(30, []byte(""))
 	f.Add(0, []byte(""))
 	f.Add(50, []byte("UNKNOWN command"))
+	f.Add(30, []byte(`SET foo "bar baz"`))
+	f.Add(30, []byte(`SET foo "bar`))
+	f.Add(30, []byte(`SET foo "a\"b\\c\n"`))
+	f.Add(30, []byte(`SET foo bar\`))
 
 	f.Fuzz(func(t *testing.T, maxLen int, input []byte) {
 		if maxLen < 0 {
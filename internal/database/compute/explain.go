@@ -0,0 +1,106 @@
+package compute
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// quoteEscapes is the inverse of escapes.
+var quoteEscapes = map[byte]byte{
+	'"':  '"',
+	'\\': '\\',
+	'\n': 'n',
+	'\t': 't',
+}
+
+// commandNames covers the queries whose command is not their type name without the Query suffix.
+var commandNames = map[string]string{
+	"DebugJMapQuery":  "DEBUG JMAP",
+	"StatsParseQuery": "STATS PARSE",
+}
+
+// Describe renders q as its command followed by name=value for every argument, quoting values
+// the way they would have to be written in a query, e.g. SET key=foo value="hello world".
+// Quoting uses only the escapes the parser decodes; other bytes, control bytes included, are
+// written as they are, so a value pasted back parses to the same bytes unless the Compute is
+// strict. Optional arguments, tagged describe:"omitempty", are left out when unset.
+func Describe(q Query) string {
+	v := reflect.Indirect(reflect.ValueOf(q))
+
+	name, ok := commandNames[v.Type().Name()]
+	if !ok {
+		name = strings.ToUpper(strings.TrimSuffix(v.Type().Name(), "Query"))
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+
+	for _, field := range describeFields(v) {
+		b.WriteByte(' ')
+		b.WriteString(field)
+	}
+
+	return b.String()
+}
+
+func describeFields(v reflect.Value) []string {
+	var fields []string
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		if field.Anonymous || field.Tag.Get("describe") == "omitempty" && v.Field(i).IsZero() {
+			continue
+		}
+
+		fields = append(fields, strings.ToLower(field.Name)+"="+describeValue(v.Field(i)))
+	}
+
+	return fields
+}
+
+func describeValue(v reflect.Value) string {
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return describeArgument(string(v.Bytes()))
+	case v.Kind() == reflect.String:
+		return describeArgument(v.String())
+	case v.Kind() == reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case v.Kind() == reflect.Slice:
+		elems := make([]string, v.Len())
+		for i := range v.Len() {
+			elems[i] = describeValue(v.Index(i))
+		}
+
+		return "[" + strings.Join(elems, " ") + "]"
+	case v.Kind() == reflect.Struct:
+		return "{" + strings.Join(describeFields(v), " ") + "}"
+	default:
+		return v.String()
+	}
+}
+
+func describeArgument(arg string) string {
+	if arg != "" && !strings.ContainsFunc(arg, func(r rune) bool {
+		return unicode.IsSpace(r) || !unicode.IsPrint(r) || r == quote || r == escape
+	}) {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte(quote)
+
+	for i := range len(arg) {
+		if e, ok := quoteEscapes[arg[i]]; ok {
+			b.WriteByte(escape)
+			b.WriteByte(e)
+		} else {
+			b.WriteByte(arg[i])
+		}
+	}
+
+	b.WriteByte(quote)
+
+	return b.String()
+}
@@ -0,0 +1,190 @@
+package compute
+
+import (
+	"bytes"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	quote     = '"'
+	escape    = '\\'
+	separator = ';'
+)
+
+var escapes = map[byte]byte{
+	'"':  '"',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+}
+
+// splitFields splits query around whitespace like bytes.Fields, except that a token starting
+// with a double quote runs up to the next unescaped double quote and is returned without the
+// quotes. Backslash escapes are decoded in both quoted and unquoted tokens.
+func splitFields(query []byte) ([][]byte, error) {
+	var fields [][]byte
+
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRune(query[i:])
+		if unicode.IsSpace(r) {
+			i += size
+
+			continue
+		}
+
+		quoted := query[i] == quote
+		if quoted {
+			i++
+		}
+
+		field, next, err := readField(query, i, quoted)
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, field)
+		i = next
+	}
+
+	return fields, nil
+}
+
+// SplitQueries splits a line of queries around the semicolons outside quoted arguments, as
+// ParseMulti does, dropping segments that are only whitespace. Segments alias query.
+func SplitQueries(query []byte) [][]byte {
+	var (
+		segments [][]byte
+		quoted   bool
+		start    int
+	)
+
+	appendSegment := func(end int) {
+		if segment := query[start:end:end]; len(bytes.TrimSpace(segment)) > 0 {
+			segments = append(segments, segment)
+		}
+
+		start = end + 1
+	}
+
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == escape:
+			i++
+		case c == quote && quoted:
+			quoted = false
+		case c == quote && (i == start || unicode.IsSpace(rune(query[i-1]))):
+			quoted = true
+		case c == separator && !quoted:
+			appendSegment(i)
+		}
+	}
+
+	appendSegment(len(query))
+
+	return segments
+}
+
+// readField returns the field starting at start and the offset right after it. The field
+// aliases query unless it contains escapes, in which case it is decoded into a new slice.
+func readField(query []byte, start int, quoted bool) ([]byte, int, error) {
+	var decoded []byte
+
+	i := start
+	for i < len(query) {
+		c := query[i]
+
+		if quoted && c == quote {
+			if err := checkAfterQuote(query, i); err != nil {
+				return nil, 0, err
+			}
+
+			return fieldBytes(query, start, i, decoded), i + 1, nil
+		}
+
+		r, size := utf8.DecodeRune(query[i:])
+		if !quoted && unicode.IsSpace(r) {
+			break
+		}
+
+		if c == escape {
+			if decoded == nil {
+				decoded = append(make([]byte, 0, len(query)-start), query[start:i]...)
+			}
+
+			if i+1 == len(query) {
+				return nil, 0, fmt.Errorf("%w: trailing backslash", ErrInvalidEscape)
+			}
+
+			b, ok := escapes[query[i+1]]
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: \\%c at offset %d", ErrInvalidEscape, query[i+1], i)
+			}
+
+			decoded = append(decoded, b)
+			i += 2
+
+			continue
+		}
+
+		if decoded != nil {
+			decoded = append(decoded, query[i:i+size]...)
+		}
+
+		i += size
+	}
+
+	if quoted {
+		return nil, 0, fmt.Errorf("%w: quote opened at offset %d", ErrUnterminatedQuote, start-1)
+	}
+
+	return fieldBytes(query, start, i, decoded), i, nil
+}
+
+// checkCharacters reports the first byte of query that is neither printable ASCII nor
+// whitespace separating fields; inside quotes only spaces are allowed. The byte after a
+// backslash is left to splitFields, which accepts only the escapes it knows.
+func checkCharacters(query []byte) error {
+	quoted := false
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		space := c < utf8.RuneSelf && unicode.IsSpace(rune(c))
+
+		switch {
+		case c == ' ' || (space && !quoted):
+		case space || c < ' ' || c >= 0x7f:
+			return fmt.Errorf("%w: byte 0x%02x at offset %d", ErrInvalidCharacter, c, i)
+		case c == escape:
+			i++
+		case c == quote && quoted:
+			quoted = false
+		case c == quote && (i == 0 || unicode.IsSpace(rune(query[i-1]))):
+			quoted = true
+		}
+	}
+
+	return nil
+}
+
+func checkAfterQuote(query []byte, i int) error {
+	next := i + 1
+	if next == len(query) {
+		return nil
+	}
+
+	if r, _ := utf8.DecodeRune(query[next:]); !unicode.IsSpace(r) {
+		return fmt.Errorf("%w: closing quote at offset %d must be followed by a space", ErrInvalidArguments, i)
+	}
+
+	return nil
+}
+
+func fieldBytes(query []byte, start, end int, decoded []byte) []byte {
+	if decoded != nil {
+		return decoded
+	}
+
+	return query[start:end:end]
+}
@@ -0,0 +1,153 @@
+package compute
+
+// MatchGlob reports whether s matches pattern, byte by byte: * matches any run of bytes, ?
+// any single byte, [abc], [a-z] and [^a-z] (or [!a-z]) a byte from or outside a set, and a
+// backslash makes the next byte literal. A malformed pattern, one validGlob rejects, matches
+// nothing.
+func MatchGlob(pattern, s []byte) bool {
+	px, sx := 0, 0
+	starPx, starSx := -1, 0
+
+	for px < len(pattern) || sx < len(s) {
+		if px < len(pattern) {
+			switch c := pattern[px]; c {
+			case '*':
+				starPx, starSx = px, sx
+				px++
+
+				continue
+			case '?':
+				if sx < len(s) {
+					px++
+					sx++
+
+					continue
+				}
+			case '[':
+				end := classEnd(pattern, px)
+				if end < 0 {
+					return false
+				}
+
+				if sx < len(s) {
+					if matchClass(pattern[px+1:end-1], s[sx]) {
+						px = end
+						sx++
+
+						continue
+					}
+				}
+			case escape:
+				if px+1 == len(pattern) {
+					return false
+				}
+
+				if sx < len(s) && pattern[px+1] == s[sx] {
+					px += 2
+					sx++
+
+					continue
+				}
+			default:
+				if sx < len(s) && s[sx] == c {
+					px++
+					sx++
+
+					continue
+				}
+			}
+		}
+
+		// Let the last * swallow one more byte and retry from there.
+		if starPx >= 0 && starSx < len(s) {
+			starSx++
+			px, sx = starPx+1, starSx
+
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// validGlob reports whether every [ in pattern is closed and no backslash ends it.
+func validGlob(pattern []byte) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case escape:
+			if i+1 == len(pattern) {
+				return false
+			}
+
+			i++
+		case '[':
+			end := classEnd(pattern, i)
+			if end < 0 {
+				return false
+			}
+
+			i = end - 1
+		}
+	}
+
+	return true
+}
+
+// classEnd returns the index just past the ] closing the class that opens at pattern[start],
+// or -1. A ] right after the opening [ (or its negation) is part of the set.
+func classEnd(pattern []byte, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '^' || pattern[i] == '!') {
+		i++
+	}
+
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case escape:
+			i++
+		case ']':
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// matchClass matches b against the inside of a class, without the brackets.
+func matchClass(class []byte, b byte) bool {
+	negate := len(class) > 0 && (class[0] == '^' || class[0] == '!')
+	if negate {
+		class = class[1:]
+	}
+
+	for i := 0; i < len(class); i++ {
+		lo := class[i]
+		if lo == escape && i+1 < len(class) {
+			i++
+			lo = class[i]
+		}
+
+		hi := lo
+		if i+2 < len(class) && class[i+1] == '-' {
+			hi = class[i+2]
+			if hi == escape && i+3 < len(class) {
+				i++
+				hi = class[i+2]
+			}
+
+			i += 2
+		}
+
+		if lo <= b && b <= hi {
+			return !negate
+		}
+	}
+
+	return negate
+}
@@ -0,0 +1,154 @@
+package compute
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ArgLimits bounds the keys and values a command accepts, in bytes; 0 leaves that length
+// unbounded. They apply on top of the length limit for the whole query.
+type ArgLimits struct {
+	MaxKeyLen   int
+	MaxValueLen int
+}
+
+// WithMaxArgLens bounds the keys and values of every command, in bytes; 0 leaves that
+// length unbounded, which is the default. Violations wrap ErrKeyTooLong or ErrValueTooLong
+// as well as ErrInvalidArguments.
+func WithMaxArgLens(maxKeyLen, maxValueLen int) Option {
+	return func(c *Compute) {
+		c.maxKeyLen = maxKeyLen
+		c.maxValueLen = maxValueLen
+	}
+}
+
+// WithArgLimits sets the argument limits of command, matched case-insensitively. Violations
+// wrap ErrKeyTooLong or ErrValueTooLong as well as ErrInvalidArguments.
+func WithArgLimits(command string, limits ArgLimits) Option {
+	return func(c *Compute) {
+		if c.argLimits == nil {
+			c.argLimits = make(map[string]ArgLimits)
+		}
+
+		c.argLimits[string(bytes.ToUpper([]byte(command)))] = limits
+	}
+}
+
+// IsCommand reports whether name, matched case-insensitively, is a built-in command.
+func IsCommand(name string) bool {
+	upperName := strings.ToUpper(name)
+	_, ok := builtinCommands[upperName]
+
+	return ok || upperName == commandExplain
+}
+
+func (c *Compute) checkArgLens(command []byte, q Query) error {
+	if c.maxKeyLen <= 0 && c.maxValueLen <= 0 {
+		return nil
+	}
+
+	return checkLens(command, q, ArgLimits{MaxKeyLen: c.maxKeyLen, MaxValueLen: c.maxValueLen})
+}
+
+func (c *Compute) checkArgLimits(command []byte, q Query) error {
+	if len(c.argLimits) == 0 {
+		return nil
+	}
+
+	limits, ok := c.argLimits[string(bytes.ToUpper(command))]
+	if !ok {
+		return nil
+	}
+
+	return checkLens(command, q, limits)
+}
+
+// checkLens checks the keys and values of q against limits, wrapping ErrKeyTooLong or
+// ErrValueTooLong as well as ErrInvalidArguments.
+func checkLens(command []byte, q Query, limits ArgLimits) error {
+	keys, values := queryArgs(q)
+
+	for _, key := range keys {
+		if limits.MaxKeyLen > 0 && len(key) > limits.MaxKeyLen {
+			return fmt.Errorf("%w: %w: %s key of %d bytes exceeds the limit of %d bytes",
+				ErrInvalidArguments, ErrKeyTooLong, bytes.ToLower(command), len(key), limits.MaxKeyLen)
+		}
+	}
+
+	for _, value := range values {
+		if limits.MaxValueLen > 0 && len(value) > limits.MaxValueLen {
+			return fmt.Errorf("%w: %w: %s value of %d bytes exceeds the limit of %d bytes",
+				ErrInvalidArguments, ErrValueTooLong, bytes.ToLower(command), len(value), limits.MaxValueLen)
+		}
+	}
+
+	return nil
+}
+
+// queryArgs returns the keys and the stored or compared values of q; queries without either
+// return neither. Prefixes and patterns matched against keys count as keys, and patterns
+// matched against values as values.
+func queryArgs(q Query) (keys, values [][]byte) {
+	switch q := q.(type) {
+	case *SetQuery:
+		return [][]byte{q.Key}, [][]byte{q.Value}
+	case *GetQuery:
+		return [][]byte{q.Key}, nil
+	case *GetRangeQuery:
+		return [][]byte{q.Key}, nil
+	case *DelQuery:
+		return [][]byte{q.Key}, nil
+	case *GetDefaultQuery:
+		return [][]byte{q.Key}, [][]byte{q.Default}
+	case *SetImmutableQuery:
+		return [][]byte{q.Key}, [][]byte{q.Value}
+	case *UnlockQuery:
+		return [][]byte{q.Key}, nil
+	case *SetMaxQuery:
+		return [][]byte{q.Key}, nil
+	case *SetMinQuery:
+		return [][]byte{q.Key}, nil
+	case *ExistsQuery:
+		return [][]byte{q.Key}, nil
+	case *IncrQuery:
+		return [][]byte{q.Key}, nil
+	case *IncrExQuery:
+		return [][]byte{q.Key}, nil
+	case *DecrQuery:
+		return [][]byte{q.Key}, nil
+	case *MSetQuery:
+		keys = make([][]byte, 0, len(q.Pairs))
+		values = make([][]byte, 0, len(q.Pairs))
+		for _, pair := range q.Pairs {
+			keys = append(keys, pair.Key)
+			values = append(values, pair.Value)
+		}
+
+		return keys, values
+	case *MGetQuery:
+		return q.Keys, nil
+	case *ExpireQuery:
+		return [][]byte{q.Key}, nil
+	case *TTLQuery:
+		return [][]byte{q.Key}, nil
+	case *DelIfQuery:
+		return [][]byte{q.Key}, [][]byte{q.Expected}
+	case *DiffQuery:
+		return [][]byte{q.Key1, q.Key2}, nil
+	case *RotateQuery:
+		return [][]byte{q.Key}, [][]byte{q.Value}
+	case *AppendSepQuery:
+		return [][]byte{q.Key}, [][]byte{q.Value}
+	case *IndexGetQuery:
+		return nil, [][]byte{q.Field}
+	case *GetPrefixQuery:
+		return [][]byte{q.Prefix}, nil
+	case *KeysQuery:
+		return [][]byte{q.Pattern}, nil
+	case *FindValueQuery:
+		return nil, [][]byte{q.Pattern}
+	default:
+		return nil, nil
+	}
+}
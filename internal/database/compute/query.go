@@ -14,6 +14,8 @@ type SetQuery struct {
 
 	Key   []byte
 	Value []byte
+	// Seconds is the EX expiry, 0 when the query sets none.
+	Seconds int64 `describe:"omitempty"`
 }
 
 type GetQuery struct {
@@ -27,3 +29,215 @@ type DelQuery struct {
 
 	Key []byte
 }
+
+type GetDefaultQuery struct {
+	baseQuery
+
+	Key     []byte
+	Default []byte
+}
+
+type SetImmutableQuery struct {
+	baseQuery
+
+	Key   []byte
+	Value []byte
+}
+
+type UnlockQuery struct {
+	baseQuery
+
+	Key []byte
+}
+
+type DebugJMapQuery struct {
+	baseQuery
+}
+
+type HelpQuery struct {
+	baseQuery
+
+	Usage string
+}
+
+type LatencyQuery struct {
+	baseQuery
+}
+
+type StatsParseQuery struct {
+	baseQuery
+}
+
+type SetMaxQuery struct {
+	baseQuery
+
+	Key   []byte
+	Value int64
+}
+
+type SetMinQuery struct {
+	baseQuery
+
+	Key   []byte
+	Value int64
+}
+
+type ExistsQuery struct {
+	baseQuery
+
+	Key []byte
+}
+
+type IncrQuery struct {
+	baseQuery
+
+	Key []byte
+}
+
+// IncrExQuery increments Key and, when that creates it, makes it expire after Seconds.
+type IncrExQuery struct {
+	baseQuery
+
+	Key     []byte
+	Seconds int64
+}
+
+type DecrQuery struct {
+	baseQuery
+
+	Key []byte
+}
+
+type Pair struct {
+	Key   []byte
+	Value []byte
+}
+
+type MSetQuery struct {
+	baseQuery
+
+	Pairs []Pair
+}
+
+// GetRangeQuery reads the bytes of a value from Start to End, both included; negative offsets
+// count back from the end of the value.
+type GetRangeQuery struct {
+	baseQuery
+
+	Key   []byte
+	Start int64
+	End   int64
+}
+
+type MGetQuery struct {
+	baseQuery
+
+	Keys [][]byte
+}
+
+type ExpireQuery struct {
+	baseQuery
+
+	Key     []byte
+	Seconds int64
+}
+
+type TTLQuery struct {
+	baseQuery
+
+	Key []byte
+}
+
+type DelIfQuery struct {
+	baseQuery
+
+	Key      []byte
+	Expected []byte
+}
+
+type DiffQuery struct {
+	baseQuery
+
+	Key1 []byte
+	Key2 []byte
+}
+
+type RotateQuery struct {
+	baseQuery
+
+	Key     []byte
+	Value   []byte
+	Seconds int64
+}
+
+type AppendSepQuery struct {
+	baseQuery
+
+	Key   []byte
+	Value []byte
+}
+
+type ExplainQuery struct {
+	baseQuery
+
+	Query Query
+}
+
+type FindValueQuery struct {
+	baseQuery
+
+	Pattern []byte
+}
+
+type KeysQuery struct {
+	baseQuery
+
+	Pattern []byte
+}
+
+type FlushQuery struct {
+	baseQuery
+}
+
+type DBSizeQuery struct {
+	baseQuery
+}
+
+// IndexGetQuery looks up the indexed keys whose value is Field.
+type IndexGetQuery struct {
+	baseQuery
+
+	Field []byte
+}
+
+type GetPrefixQuery struct {
+	baseQuery
+
+	Prefix []byte
+}
+
+type DefaultTTLQuery struct {
+	baseQuery
+
+	Seconds int64
+}
+
+// NoReplyQuery turns no-reply mode of the connection on or off.
+type NoReplyQuery struct {
+	baseQuery
+
+	Enabled bool
+}
+
+// StatusLineQuery turns status lines of the connection on or off.
+type StatusLineQuery struct {
+	baseQuery
+
+	Enabled bool
+}
+
+type EchoQuery struct {
+	baseQuery
+
+	Message []byte
+}
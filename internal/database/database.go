@@ -1,43 +1,200 @@
 package database
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/maxm86545/concurrency_go/internal/database/compute"
 	"github.com/maxm86545/concurrency_go/internal/database/storage"
+	"github.com/maxm86545/concurrency_go/internal/eventbus"
 )
 
 const loggerName = "database"
 
+var (
+	// missingValue stands in for a missing key among MGET values; unlike NOT_FOUND, it is not
+	// an answer any other query gives.
+	missingValue           = []byte("(nil)")
+	defaultAppendSeparator = []byte(",")
+)
+
+var (
+	ErrResponseTooLarge = errors.New("response too large")
+	ErrBusy             = errors.New("busy")
+	ErrCommandDisabled  = errors.New("command disabled")
+)
+
 type iCompute interface {
 	Parse(query []byte) (compute.Query, error)
+	ParseMulti(query []byte) ([]compute.Query, error)
 }
 
 type iStorage interface {
 	Set(ctx context.Context, key []byte, value []byte) error
+	SetIfChanged(ctx context.Context, key []byte, value []byte) (bool, error)
 	Get(ctx context.Context, key []byte) ([]byte, error)
-	Del(ctx context.Context, key []byte) error
+	GetMany(ctx context.Context, keys [][]byte) ([][]byte, []bool, error)
+	SetMany(ctx context.Context, pairs []storage.KeyValue) error
+	Del(ctx context.Context, key []byte) (bool, error)
+	DelIf(ctx context.Context, key []byte, expected []byte) (bool, error)
+	GetOrSet(ctx context.Context, key []byte, value []byte) ([]byte, bool, error)
+	SetImmutable(ctx context.Context, key []byte, value []byte) error
+	Unlock(ctx context.Context, key []byte) (bool, error)
+	MapStats(ctx context.Context) (storage.MapStats, error)
+	SetMax(ctx context.Context, key []byte, value int64) (int64, bool, error)
+	SetMin(ctx context.Context, key []byte, value int64) (int64, bool, error)
+	Incr(ctx context.Context, key []byte, delta int64) (int64, error)
+	IncrEx(ctx context.Context, key []byte, delta int64, ttl time.Duration) (int64, error)
+	AppendSep(ctx context.Context, key []byte, value []byte, sep []byte) ([]byte, error)
+	Expire(ctx context.Context, key []byte, ttl time.Duration) (bool, error)
+	Rotate(ctx context.Context, key []byte, value []byte, ttl time.Duration) ([]byte, bool, error)
+	TTL(ctx context.Context, key []byte) (time.Duration, error)
+	GetPrefix(ctx context.Context, prefix []byte) ([]storage.KeyValue, error)
+	Keys(ctx context.Context, match func(key []byte) bool) ([][]byte, error)
+	Flush(ctx context.Context) error
+	Len(ctx context.Context) (int, error)
+	IndexGet(ctx context.Context, field []byte) ([][]byte, error)
+}
+
+type iPublisher interface {
+	Publish(event eventbus.Event)
 }
 
 type Database struct {
-	compute iCompute
-	storage iStorage
-	logger  *zap.Logger
+	compute   iCompute
+	storage   iStorage
+	publisher iPublisher
+	// writeMu is held across a change and the events it publishes; it is nil without a
+	// publisher, as there is nothing to order then.
+	writeMu   *sync.Mutex
+	latency   *latencyWindow
+	parseErrs *parseErrorStats
+	queryLog  *queryLog
+	expensive *queryLimiter
+	logger    *zap.Logger
+
+	delCount         bool
+	skipIdenticalSet bool
+	maxResponseSize  int
+	appendSeparator  []byte
+	findValue        bool
+	keyEncoding      KeyEncoding
+}
+
+type Option func(d *Database)
+
+func NewDatabase(l *zap.Logger, c iCompute, s iStorage, opts ...Option) *Database {
+	d := &Database{
+		compute:   c,
+		storage:   s,
+		publisher: nopPublisher{},
+		latency:   newLatencyWindow(defaultLatencyWindow),
+		parseErrs: &parseErrorStats{},
+		logger:    l.Named(loggerName),
+
+		appendSeparator: defaultAppendSeparator,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+func WithDelCount(delCount bool) Option {
+	return func(d *Database) {
+		d.delCount = delCount
+	}
+}
+
+func WithSkipIdenticalSet(skip bool) Option {
+	return func(d *Database) {
+		d.skipIdenticalSet = skip
+	}
+}
+
+// WithLatencyWindow sets how many of the latest queries LATENCY reports on; a size of 0 or less
+// stops tracking latency, and LATENCY is then rejected with ErrCommandDisabled.
+func WithLatencyWindow(size int) Option {
+	return func(d *Database) {
+		if size > 0 {
+			d.latency = newLatencyWindow(size)
+		} else {
+			d.latency = nil
+		}
+	}
+}
+
+func WithQueryLog(w io.Writer) Option {
+	return func(d *Database) {
+		d.queryLog = newQueryLog(w)
+	}
+}
+
+func WithMaxResponseSize(maxResponseSize int) Option {
+	return func(d *Database) {
+		d.maxResponseSize = maxResponseSize
+	}
+}
+
+func WithExpensiveQueryLimit(limit int) Option {
+	return func(d *Database) {
+		if limit > 0 {
+			d.expensive = newQueryLimiter(limit)
+		} else {
+			d.expensive = nil
+		}
+	}
+}
+
+// WithAppendSeparator sets what APPENDSEP inserts between values, a comma by default.
+func WithAppendSeparator(sep []byte) Option {
+	return func(d *Database) {
+		d.appendSeparator = sep
+	}
+}
+
+// WithFindValue enables FINDVALUE, which scans every value; it is rejected with
+// ErrCommandDisabled otherwise.
+func WithFindValue(enabled bool) Option {
+	return func(d *Database) {
+		d.findValue = enabled
+	}
 }
 
-func NewDatabase(l *zap.Logger, c iCompute, s iStorage) *Database {
-	return &Database{
-		compute: c,
-		storage: s,
-		logger:  l.Named(loggerName),
+// WithKeyEncoding sets how GETPREFIX and FINDVALUE write keys that are not printable.
+func WithKeyEncoding(encoding KeyEncoding) Option {
+	return func(d *Database) {
+		d.keyEncoding = encoding
+	}
+}
+
+// WithPublisher sends the changes queries make to p. Each change is published before the next
+// one is made, so a publisher numbering events, as eventbus.Bus does, numbers them in order;
+// writes that publish are serialized for it.
+func WithPublisher(p iPublisher) Option {
+	return func(d *Database) {
+		d.publisher = p
+		d.writeMu = &sync.Mutex{}
 	}
 }
 
 func (d *Database) Exec(ctx context.Context, rawQuery []byte) ExecResult {
+	start := time.Now()
+	defer func() {
+		d.latency.Record(time.Since(start))
+	}()
+
 	if err := ctx.Err(); err != nil {
 		d.logger.Warn("context error", zap.Error(err))
 
@@ -46,60 +203,931 @@ func (d *Database) Exec(ctx context.Context, rawQuery []byte) ExecResult {
 
 	d.logger.Debug("parsing query", zap.ByteString("rawQuery", rawQuery))
 	query, err := d.compute.Parse(rawQuery)
+	d.logQuery(start, rawQuery, query)
 	if err != nil {
 		d.logger.Warn("failed to parse query", zap.Error(err))
+		d.parseErrs.Record(err)
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("parse query: %w", err)}
+	}
+
+	return d.execQuery(ctx, query)
+}
+
+// ExecMulti runs a line of queries separated by semicolons, as parsed by
+// compute.ParseMulti, and returns a result per query in order. The line is parsed as a whole,
+// so if any query in it is invalid none runs and the single result is the parse error; a
+// query that fails once running does not stop the ones after it. Each query goes to the query
+// log on its own line.
+func (d *Database) ExecMulti(ctx context.Context, rawQuery []byte) []ExecResult {
+	start := time.Now()
+
+	if err := ctx.Err(); err != nil {
+		d.logger.Warn("context error", zap.Error(err))
+
+		return []ExecResult{{Status: StatusErr, Err: err}}
+	}
+
+	d.logger.Debug("parsing queries", zap.ByteString("rawQuery", rawQuery))
+	queries, err := d.compute.ParseMulti(rawQuery)
+	if err != nil {
+		d.logQuery(start, rawQuery, nil)
+		d.logger.Warn("failed to parse queries", zap.Error(err))
+		d.parseErrs.Record(err)
+		d.latency.Record(time.Since(start))
+
+		return []ExecResult{{Status: StatusErr, Err: fmt.Errorf("parse query: %w", err)}}
+	}
+
+	for i, segment := range compute.SplitQueries(rawQuery) {
+		d.logQuery(start, bytes.TrimSpace(segment), queries[i])
+	}
+
+	results := make([]ExecResult, 0, len(queries))
+	for _, query := range queries {
+		results = append(results, d.execQuery(ctx, query))
+		d.latency.Record(time.Since(start))
+
+		start = time.Now()
+	}
+
+	return results
+}
+
+func (d *Database) execQuery(ctx context.Context, query compute.Query) ExecResult {
+	if d.expensive != nil && isExpensive(query) {
+		if !d.expensive.TryAcquire() {
+			d.logger.Warn("expensive query rejected", zap.String("type", fmt.Sprintf("%T", query)))
 
-		return ExecResult{Status: StatusErr, Err: fmt.Errorf("parse query: %v", err)}
+			return ExecResult{Status: StatusErr, Err: ErrBusy}
+		}
+		defer d.expensive.Release()
 	}
 
 	switch q := query.(type) {
 	case *compute.SetQuery:
-		d.logger.Debug("executing SET query", zap.ByteString("key", q.Key), zap.ByteString("value", q.Value))
-		err := d.storage.Set(ctx, q.Key, q.Value)
-		if err != nil {
-			d.logger.Error("failed to execute SET", zap.ByteString("key", q.Key), zap.Error(err))
+		return d.execSet(ctx, q)
+	case *compute.GetQuery:
+		return d.execGet(ctx, q)
+	case *compute.GetRangeQuery:
+		return d.execGetRange(ctx, q)
+	case *compute.DelQuery:
+		return d.execDel(ctx, q)
+	case *compute.DelIfQuery:
+		return d.execDelIf(ctx, q)
+	case *compute.GetDefaultQuery:
+		return d.execGetDefault(ctx, q)
+	case *compute.SetImmutableQuery:
+		return d.execSetImmutable(ctx, q)
+	case *compute.UnlockQuery:
+		return d.execUnlock(ctx, q)
+	case *compute.DebugJMapQuery:
+		return d.execDebugJMap(ctx)
+	case *compute.SetMaxQuery:
+		return d.execSetBound(ctx, "SETMAX", q.Key, q.Value, d.storage.SetMax)
+	case *compute.SetMinQuery:
+		return d.execSetBound(ctx, "SETMIN", q.Key, q.Value, d.storage.SetMin)
+	case *compute.IncrQuery:
+		return d.execIncr(ctx, "INCR", q.Key, 1)
+	case *compute.IncrExQuery:
+		return d.execIncrEx(ctx, q)
+	case *compute.DecrQuery:
+		return d.execIncr(ctx, "DECR", q.Key, -1)
+	case *compute.MSetQuery:
+		return d.execMSet(ctx, q)
+	case *compute.MGetQuery:
+		return d.execMGet(ctx, q)
+	case *compute.ExpireQuery:
+		return d.execExpire(ctx, q)
+	case *compute.TTLQuery:
+		return d.execTTL(ctx, q)
+	case *compute.ExistsQuery:
+		return d.execExists(ctx, q)
+	case *compute.DiffQuery:
+		return d.execDiff(ctx, q)
+	case *compute.RotateQuery:
+		return d.execRotate(ctx, q)
+	case *compute.AppendSepQuery:
+		return d.execAppendSep(ctx, q)
+	case *compute.GetPrefixQuery:
+		return d.execGetPrefix(ctx, q)
+	case *compute.FindValueQuery:
+		return d.execFindValue(ctx, q)
+	case *compute.KeysQuery:
+		return d.execKeys(ctx, q)
+	case *compute.FlushQuery:
+		return d.execFlush(ctx)
+	case *compute.DBSizeQuery:
+		return d.execDBSize(ctx)
+	case *compute.IndexGetQuery:
+		return d.execIndexGet(ctx, q)
+	case *compute.NoReplyQuery:
+		return d.execNoReply(ctx, q)
+	case *compute.StatusLineQuery:
+		return d.execStatusLine(ctx, q)
+	case *compute.DefaultTTLQuery:
+		return d.execDefaultTTL(ctx, q)
+	case *compute.LatencyQuery:
+		return d.execLatency()
+	case *compute.StatsParseQuery:
+		return ExecResult{Status: StatusOK, Data: d.parseErrs.Text()}
+	case *compute.HelpQuery:
+		return ExecResult{Status: StatusOK, Data: []byte(q.Usage)}
+	case *compute.EchoQuery:
+		return ExecResult{Status: StatusOK, Data: q.Message}
+	case *compute.ExplainQuery:
+		return ExecResult{Status: StatusOK, Data: []byte(compute.Describe(q.Query))}
+	}
+
+	d.logger.Warn("unknown query type", zap.String("type", fmt.Sprintf("%T", query)))
+
+	return ExecResult{Status: StatusUnsupported, Err: fmt.Errorf("unknown query type: %T", query)}
+}
+
+func (d *Database) execSet(ctx context.Context, q *compute.SetQuery) ExecResult {
+	ttl := time.Duration(q.Seconds) * time.Second
+	if ttl == 0 {
+		ttl = sessionFrom(ctx).DefaultTTL()
+	}
 
-			return ExecResult{Status: StatusErr, Err: fmt.Errorf("set query: %v", err)}
+	d.logger.Debug("executing SET query", zap.ByteString("key", q.Key), zap.ByteString("value", q.Value), zap.Duration("ttl", ttl))
+	unlock := d.lockWrites()
+	stored, err := d.set(ctx, q.Key, q.Value, ttl)
+	if err == nil && stored {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: q.Key, Value: q.Value, TTL: ttl})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute SET", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("set query: %v", err)}
+	}
+
+	noReply := sessionFrom(ctx).NoReply()
+
+	if !stored {
+		d.logger.Info("SET query skipped: value unchanged", zap.ByteString("key", q.Key))
+
+		return ExecResult{Status: StatusOkNoData, NoReply: noReply}
+	}
+
+	d.logger.Info("SET query executed successfully", zap.ByteString("key", q.Key))
+
+	return ExecResult{Status: StatusOkNoData, NoReply: noReply}
+}
+
+func (d *Database) execGet(ctx context.Context, q *compute.GetQuery) ExecResult {
+	d.logger.Debug("executing GET query", zap.ByteString("key", q.Key))
+	result, err := d.storage.Get(ctx, q.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			d.logger.Info("GET query: key not found", zap.ByteString("key", q.Key))
+
+			return ExecResult{Status: StatusNotFound}
 		}
 
-		d.logger.Info("SET query executed successfully", zap.ByteString("key", q.Key))
+		d.logger.Error("failed to execute GET", zap.ByteString("key", q.Key), zap.Error(err))
 
-		return ExecResult{Status: StatusOkNoData}
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("get query: %v", err)}
+	}
 
-	case *compute.GetQuery:
-		d.logger.Debug("executing GET query", zap.ByteString("key", q.Key))
-		result, err := d.storage.Get(ctx, q.Key)
-		if err != nil {
-			if errors.Is(err, storage.ErrNotFound) {
-				d.logger.Info("GET query: key not found", zap.ByteString("key", q.Key))
+	if d.maxResponseSize > 0 && len(result) > d.maxResponseSize {
+		d.logger.Warn("GET query: response too large", zap.ByteString("key", q.Key), zap.Int("size", len(result)))
 
-				return ExecResult{Status: StatusNotFound}
-			}
+		return ExecResult{
+			Status: StatusErr,
+			Err: fmt.Errorf("get query: %w: value of %d bytes exceeds the limit of %d bytes, read it in pieces with GETRANGE",
+				ErrResponseTooLarge, len(result), d.maxResponseSize),
+		}
+	}
 
-			d.logger.Error("failed to execute GET", zap.ByteString("key", q.Key), zap.Error(err))
+	d.logger.Info("GET query executed successfully", zap.ByteString("key", q.Key), zap.ByteString("value", result))
 
-			return ExecResult{Status: StatusErr, Err: fmt.Errorf("get query: %v", err)}
+	return ExecResult{Status: StatusOK, Data: result}
+}
+
+func (d *Database) execGetRange(ctx context.Context, q *compute.GetRangeQuery) ExecResult {
+	d.logger.Debug("executing GETRANGE query", zap.ByteString("key", q.Key), zap.Int64("start", q.Start), zap.Int64("end", q.End))
+	value, err := d.storage.Get(ctx, q.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			d.logger.Info("GETRANGE query: key not found", zap.ByteString("key", q.Key))
+
+			return ExecResult{Status: StatusNotFound}
 		}
 
-		d.logger.Info("GET query executed successfully", zap.ByteString("key", q.Key), zap.ByteString("value", result))
+		d.logger.Error("failed to execute GETRANGE", zap.ByteString("key", q.Key), zap.Error(err))
 
-		return ExecResult{Status: StatusOK, Data: result}
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("getrange query: %v", err)}
+	}
 
-	case *compute.DelQuery:
-		d.logger.Debug("executing DEL query", zap.ByteString("key", q.Key))
-		err := d.storage.Del(ctx, q.Key)
-		if err != nil {
-			d.logger.Error("failed to execute DEL", zap.ByteString("key", q.Key), zap.Error(err))
+	result := valueRange(value, q.Start, q.End)
+
+	if d.maxResponseSize > 0 && len(result) > d.maxResponseSize {
+		d.logger.Warn("GETRANGE query: response too large", zap.ByteString("key", q.Key), zap.Int("size", len(result)))
 
-			return ExecResult{Status: StatusErr, Err: fmt.Errorf("del query: %v", err)}
+		return ExecResult{
+			Status: StatusErr,
+			Err: fmt.Errorf("getrange query: %w: range of %d bytes exceeds the limit of %d bytes, ask for a shorter one",
+				ErrResponseTooLarge, len(result), d.maxResponseSize),
 		}
+	}
+
+	d.logger.Info("GETRANGE query executed successfully", zap.ByteString("key", q.Key), zap.Int("size", len(result)))
+
+	return ExecResult{Status: StatusOK, Data: result}
+}
 
-		d.logger.Info("DEL query executed successfully", zap.ByteString("key", q.Key))
+// valueRange returns value[start:end+1], counting negative offsets back from the end and
+// clamping both to the value; it is empty when start comes after end.
+func valueRange(value []byte, start, end int64) []byte {
+	n := int64(len(value))
 
-		return ExecResult{Status: StatusOkNoData}
+	if start < 0 {
+		start += n
 	}
 
-	d.logger.Warn("unknown query type", zap.String("type", fmt.Sprintf("%T", query)))
+	if end < 0 {
+		end += n
+	}
 
-	return ExecResult{Status: StatusUnsupported, Err: fmt.Errorf("unknown query type: %T", query)}
+	start = max(start, 0)
+	end = min(end, n-1)
+
+	if start > end {
+		return []byte{}
+	}
+
+	return value[start : end+1]
+}
+
+func (d *Database) execDel(ctx context.Context, q *compute.DelQuery) ExecResult {
+	d.logger.Debug("executing DEL query", zap.ByteString("key", q.Key))
+	unlock := d.lockWrites()
+	deleted, err := d.storage.Del(ctx, q.Key)
+	if err == nil && deleted {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandDel, Key: q.Key})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute DEL", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("del query: %v", err)}
+	}
+
+	d.logger.Info("DEL query executed successfully", zap.ByteString("key", q.Key))
+
+	noReply := sessionFrom(ctx).NoReply()
+
+	if d.delCount {
+		return ExecResult{Status: StatusOK, Data: boolData(deleted), NoReply: noReply}
+	}
+
+	return ExecResult{Status: StatusOkNoData, NoReply: noReply}
+}
+
+func (d *Database) execDelIf(ctx context.Context, q *compute.DelIfQuery) ExecResult {
+	d.logger.Debug("executing DELIF query", zap.ByteString("key", q.Key))
+	unlock := d.lockWrites()
+	deleted, err := d.storage.DelIf(ctx, q.Key, q.Expected)
+	if err == nil && deleted {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandDel, Key: q.Key})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute DELIF", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("delif query: %v", err)}
+	}
+
+	d.logger.Info("DELIF query executed successfully", zap.ByteString("key", q.Key), zap.Bool("deleted", deleted))
+
+	return ExecResult{Status: StatusOK, Data: boolData(deleted)}
+}
+
+func (d *Database) execGetDefault(ctx context.Context, q *compute.GetDefaultQuery) ExecResult {
+	d.logger.Debug("executing GETDEFAULT query", zap.ByteString("key", q.Key), zap.ByteString("default", q.Default))
+	unlock := d.lockWrites()
+	result, loaded, err := d.storage.GetOrSet(ctx, q.Key, q.Default)
+	if err == nil && !loaded {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: q.Key, Value: result})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute GETDEFAULT", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("getdefault query: %v", err)}
+	}
+
+	d.logger.Info("GETDEFAULT query executed successfully", zap.ByteString("key", q.Key), zap.Bool("loaded", loaded))
+
+	return ExecResult{Status: StatusOK, Data: result}
+}
+
+func (d *Database) execSetImmutable(ctx context.Context, q *compute.SetImmutableQuery) ExecResult {
+	d.logger.Debug("executing SETIMMUTABLE query", zap.ByteString("key", q.Key), zap.ByteString("value", q.Value))
+	unlock := d.lockWrites()
+	err := d.storage.SetImmutable(ctx, q.Key, q.Value)
+	if err == nil {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: q.Key, Value: q.Value})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute SETIMMUTABLE", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("setimmutable query: %v", err)}
+	}
+
+	d.logger.Info("SETIMMUTABLE query executed successfully", zap.ByteString("key", q.Key))
+
+	return ExecResult{Status: StatusOkNoData}
+}
+
+func (d *Database) execUnlock(ctx context.Context, q *compute.UnlockQuery) ExecResult {
+	d.logger.Debug("executing UNLOCK query", zap.ByteString("key", q.Key))
+	unlocked, err := d.storage.Unlock(ctx, q.Key)
+	if err != nil {
+		d.logger.Error("failed to execute UNLOCK", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("unlock query: %v", err)}
+	}
+
+	d.logger.Info("UNLOCK query executed successfully", zap.ByteString("key", q.Key), zap.Bool("unlocked", unlocked))
+
+	return ExecResult{Status: StatusOkNoData}
+}
+
+func (d *Database) execDebugJMap(ctx context.Context) ExecResult {
+	d.logger.Debug("executing DEBUG JMAP query")
+	stats, err := d.storage.MapStats(ctx)
+	if err != nil {
+		d.logger.Error("failed to execute DEBUG JMAP", zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("debug jmap query: %v", err)}
+	}
+
+	d.logger.Info("DEBUG JMAP query executed successfully", zap.Int("len", stats.Len))
+
+	load := 0.0
+	if stats.Capacity > 0 {
+		load = float64(stats.Len) / float64(stats.Capacity)
+	}
+
+	return ExecResult{
+		Status: StatusOK,
+		Data: fmt.Appendf(nil, "len=%d\nimmutable=%d\ncapacity=%d\nload=%.2f",
+			stats.Len, stats.Immutable, stats.Capacity, load),
+	}
+}
+
+func (d *Database) execSetBound(
+	ctx context.Context,
+	command string,
+	key []byte,
+	value int64,
+	set func(ctx context.Context, key []byte, value int64) (int64, bool, error),
+) ExecResult {
+	d.logger.Debug("executing "+command+" query", zap.ByteString("key", key), zap.Int64("value", value))
+	unlock := d.lockWrites()
+	result, stored, err := set(ctx, key, value)
+	data := strconv.AppendInt(nil, result, 10)
+	if err == nil && stored {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: key, Value: data})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute "+command, zap.ByteString("key", key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("%s query: %v", strings.ToLower(command), err)}
+	}
+
+	d.logger.Info(command+" query executed successfully", zap.ByteString("key", key), zap.Bool("stored", stored))
+
+	return ExecResult{Status: StatusOK, Data: data}
+}
+
+func (d *Database) execIncr(ctx context.Context, command string, key []byte, delta int64) ExecResult {
+	d.logger.Debug("executing "+command+" query", zap.ByteString("key", key))
+	unlock := d.lockWrites()
+	result, err := d.storage.Incr(ctx, key, delta)
+	data := strconv.AppendInt(nil, result, 10)
+	if err == nil {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: key, Value: data})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute "+command, zap.ByteString("key", key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("%s query: %v", strings.ToLower(command), err)}
+	}
+
+	d.logger.Info(command+" query executed successfully", zap.ByteString("key", key), zap.Int64("value", result))
+
+	return ExecResult{Status: StatusOK, Data: data}
+}
+
+func (d *Database) execIncrEx(ctx context.Context, q *compute.IncrExQuery) ExecResult {
+	d.logger.Debug("executing INCREX query", zap.ByteString("key", q.Key), zap.Int64("seconds", q.Seconds))
+	unlock := d.lockWrites()
+	result, err := d.storage.IncrEx(ctx, q.Key, 1, time.Duration(q.Seconds)*time.Second)
+	data := strconv.AppendInt(nil, result, 10)
+	if err == nil {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: q.Key, Value: data})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute INCREX", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("increx query: %v", err)}
+	}
+
+	d.logger.Info("INCREX query executed successfully", zap.ByteString("key", q.Key), zap.Int64("value", result))
+
+	return ExecResult{Status: StatusOK, Data: data}
+}
+
+func (d *Database) execAppendSep(ctx context.Context, q *compute.AppendSepQuery) ExecResult {
+	d.logger.Debug("executing APPENDSEP query", zap.ByteString("key", q.Key), zap.ByteString("value", q.Value))
+	unlock := d.lockWrites()
+	result, err := d.storage.AppendSep(ctx, q.Key, q.Value, d.appendSeparator)
+	if err == nil {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: q.Key, Value: result})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute APPENDSEP", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("appendsep query: %v", err)}
+	}
+
+	d.logger.Info("APPENDSEP query executed successfully", zap.ByteString("key", q.Key), zap.Int("length", len(result)))
+
+	return ExecResult{Status: StatusOK, Data: strconv.AppendInt(nil, int64(len(result)), 10)}
+}
+
+func (d *Database) execMSet(ctx context.Context, q *compute.MSetQuery) ExecResult {
+	d.logger.Debug("executing MSET query", zap.Int("pairs", len(q.Pairs)))
+	pairs := make([]storage.KeyValue, 0, len(q.Pairs))
+	for _, pair := range q.Pairs {
+		pairs = append(pairs, storage.KeyValue{Key: pair.Key, Value: pair.Value})
+	}
+
+	unlock := d.lockWrites()
+	err := d.storage.SetMany(ctx, pairs)
+	if err == nil {
+		for _, pair := range q.Pairs {
+			d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: pair.Key, Value: pair.Value})
+		}
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute MSET", zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("mset query: %v", err)}
+	}
+
+	d.logger.Info("MSET query executed successfully", zap.Int("pairs", len(q.Pairs)))
+
+	return ExecResult{Status: StatusOkNoData}
+}
+
+func (d *Database) execMGet(ctx context.Context, q *compute.MGetQuery) ExecResult {
+	d.logger.Debug("executing MGET query", zap.Int("keys", len(q.Keys)))
+	values, found, err := d.storage.GetMany(ctx, q.Keys)
+	if err != nil {
+		d.logger.Error("failed to execute MGET", zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("mget query: %v", err)}
+	}
+
+	for i := range values {
+		if !found[i] {
+			values[i] = missingValue
+		}
+	}
+
+	data := bytes.Join(values, []byte("\n"))
+
+	if d.maxResponseSize > 0 && len(data) > d.maxResponseSize {
+		d.logger.Warn("MGET query: response too large", zap.Int("size", len(data)))
+
+		return ExecResult{
+			Status: StatusErr,
+			Err: fmt.Errorf("mget query: %w: response of %d bytes exceeds the limit of %d bytes, "+
+				"ask for fewer keys or read large values in pieces with GETRANGE",
+				ErrResponseTooLarge, len(data), d.maxResponseSize),
+		}
+	}
+
+	d.logger.Info("MGET query executed successfully", zap.Int("keys", len(q.Keys)))
+
+	return ExecResult{Status: StatusOK, Data: data}
+}
+
+func (d *Database) execExpire(ctx context.Context, q *compute.ExpireQuery) ExecResult {
+	d.logger.Debug("executing EXPIRE query", zap.ByteString("key", q.Key), zap.Int64("seconds", q.Seconds))
+	ttl := time.Duration(q.Seconds) * time.Second
+	unlock := d.lockWrites()
+	ok, err := d.storage.Expire(ctx, q.Key, ttl)
+	if err == nil && ok {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandExpire, Key: q.Key, TTL: ttl})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute EXPIRE", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("expire query: %v", err)}
+	}
+
+	d.logger.Info("EXPIRE query executed successfully", zap.ByteString("key", q.Key), zap.Bool("exists", ok))
+
+	return ExecResult{Status: StatusOK, Data: boolData(ok)}
+}
+
+func (d *Database) execTTL(ctx context.Context, q *compute.TTLQuery) ExecResult {
+	d.logger.Debug("executing TTL query", zap.ByteString("key", q.Key))
+	ttl, err := d.storage.TTL(ctx, q.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			d.logger.Info("TTL query: key not found", zap.ByteString("key", q.Key))
+
+			return ExecResult{Status: StatusOK, Data: []byte("-2")}
+		}
+
+		d.logger.Error("failed to execute TTL", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("ttl query: %v", err)}
+	}
+
+	seconds := int64(-1)
+	if ttl != storage.NoExpiry {
+		seconds = int64((ttl + time.Second - 1) / time.Second)
+	}
+
+	d.logger.Info("TTL query executed successfully", zap.ByteString("key", q.Key), zap.Int64("seconds", seconds))
+
+	return ExecResult{Status: StatusOK, Data: strconv.AppendInt(nil, seconds, 10)}
+}
+
+func (d *Database) execExists(ctx context.Context, q *compute.ExistsQuery) ExecResult {
+	d.logger.Debug("executing EXISTS query", zap.ByteString("key", q.Key))
+	_, err := d.storage.Get(ctx, q.Key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		d.logger.Error("failed to execute EXISTS", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("exists query: %v", err)}
+	}
+
+	exists := err == nil
+	d.logger.Info("EXISTS query executed successfully", zap.ByteString("key", q.Key), zap.Bool("exists", exists))
+
+	return ExecResult{Status: StatusOK, Data: boolData(exists)}
+}
+
+func (d *Database) execDiff(ctx context.Context, q *compute.DiffQuery) ExecResult {
+	d.logger.Debug("executing DIFF query", zap.ByteString("key1", q.Key1), zap.ByteString("key2", q.Key2))
+	keys := [][]byte{q.Key1, q.Key2}
+	values, found, err := d.storage.GetMany(ctx, keys)
+	if err != nil {
+		d.logger.Error("failed to execute DIFF", zap.ByteString("key1", q.Key1), zap.ByteString("key2", q.Key2), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("diff query: %v", err)}
+	}
+
+	d.logger.Info("DIFF query executed successfully", zap.ByteString("key1", q.Key1), zap.ByteString("key2", q.Key2))
+
+	return ExecResult{Status: StatusOK, Data: diffData(keys, values, found)}
+}
+
+func (d *Database) execRotate(ctx context.Context, q *compute.RotateQuery) ExecResult {
+	d.logger.Debug("executing ROTATE query", zap.ByteString("key", q.Key), zap.Int64("seconds", q.Seconds))
+	ttl := time.Duration(q.Seconds) * time.Second
+
+	unlock := d.lockWrites()
+	old, existed, err := d.storage.Rotate(ctx, q.Key, q.Value, ttl)
+	if err == nil {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: q.Key, Value: q.Value, TTL: ttl})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute ROTATE", zap.ByteString("key", q.Key), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("rotate query: %v", err)}
+	}
+
+	d.logger.Info("ROTATE query executed successfully", zap.ByteString("key", q.Key), zap.Bool("existed", existed))
+
+	if !existed {
+		return ExecResult{Status: StatusNotFound}
+	}
+
+	return ExecResult{Status: StatusOK, Data: old}
+}
+
+func (d *Database) execGetPrefix(ctx context.Context, q *compute.GetPrefixQuery) ExecResult {
+	d.logger.Debug("executing GETPREFIX query", zap.ByteString("prefix", q.Prefix))
+	pairs, err := d.storage.GetPrefix(ctx, q.Prefix)
+	if err != nil {
+		d.logger.Error("failed to execute GETPREFIX", zap.ByteString("prefix", q.Prefix), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("getprefix query: %v", err)}
+	}
+
+	lines := make([][]byte, 0, 2*len(pairs))
+	for _, pair := range pairs {
+		lines = append(lines, d.keyEncoding.encode(pair.Key), pair.Value)
+	}
+
+	data := bytes.Join(lines, []byte("\n"))
+
+	if d.maxResponseSize > 0 && len(data) > d.maxResponseSize {
+		d.logger.Warn("GETPREFIX query: response too large", zap.ByteString("prefix", q.Prefix), zap.Int("size", len(data)))
+
+		return ExecResult{
+			Status: StatusErr,
+			Err: fmt.Errorf("getprefix query: %w: response of %d bytes exceeds the limit of %d bytes",
+				ErrResponseTooLarge, len(data), d.maxResponseSize),
+		}
+	}
+
+	d.logger.Info("GETPREFIX query executed successfully", zap.ByteString("prefix", q.Prefix), zap.Int("matches", len(pairs)))
+
+	return ExecResult{Status: StatusOK, Data: data}
+}
+
+func (d *Database) execLatency() ExecResult {
+	if d.latency == nil {
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("latency query: %w", ErrCommandDisabled)}
+	}
+
+	p := d.latency.Percentiles()
+
+	return ExecResult{Status: StatusOK, Data: fmt.Appendf(nil, "p50=%s\np95=%s\np99=%s", p.P50, p.P95, p.P99)}
 }
+
+func (d *Database) execFindValue(ctx context.Context, q *compute.FindValueQuery) ExecResult {
+	if !d.findValue {
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("findvalue query: %w", ErrCommandDisabled)}
+	}
+
+	d.logger.Debug("executing FINDVALUE query", zap.ByteString("pattern", q.Pattern))
+	pairs, err := d.storage.GetPrefix(ctx, nil)
+	if err != nil {
+		d.logger.Error("failed to execute FINDVALUE", zap.ByteString("pattern", q.Pattern), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("findvalue query: %v", err)}
+	}
+
+	// The scan holds the engine lock only while collecting; matching happens here.
+	var keys [][]byte
+	for _, pair := range pairs {
+		if compute.MatchGlob(q.Pattern, pair.Value) {
+			keys = append(keys, d.keyEncoding.encode(pair.Key))
+		}
+	}
+
+	data := bytes.Join(keys, []byte("\n"))
+
+	if d.maxResponseSize > 0 && len(data) > d.maxResponseSize {
+		d.logger.Warn("FINDVALUE query: response too large", zap.ByteString("pattern", q.Pattern), zap.Int("size", len(data)))
+
+		return ExecResult{
+			Status: StatusErr,
+			Err: fmt.Errorf("findvalue query: %w: response of %d bytes exceeds the limit of %d bytes",
+				ErrResponseTooLarge, len(data), d.maxResponseSize),
+		}
+	}
+
+	d.logger.Info("FINDVALUE query executed successfully", zap.ByteString("pattern", q.Pattern), zap.Int("matches", len(keys)))
+
+	return ExecResult{Status: StatusOK, Data: data}
+}
+
+func (d *Database) execKeys(ctx context.Context, q *compute.KeysQuery) ExecResult {
+	d.logger.Debug("executing KEYS query", zap.ByteString("pattern", q.Pattern))
+	// The matcher runs under the engine lock, unlike FINDVALUE's, so no values are copied out.
+	keys, err := d.storage.Keys(ctx, func(key []byte) bool {
+		return compute.MatchGlob(q.Pattern, key)
+	})
+	if err != nil {
+		d.logger.Error("failed to execute KEYS", zap.ByteString("pattern", q.Pattern), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("keys query: %v", err)}
+	}
+
+	for i, key := range keys {
+		keys[i] = d.keyEncoding.encode(key)
+	}
+
+	data := bytes.Join(keys, []byte("\n"))
+
+	if d.maxResponseSize > 0 && len(data) > d.maxResponseSize {
+		d.logger.Warn("KEYS query: response too large", zap.ByteString("pattern", q.Pattern), zap.Int("size", len(data)))
+
+		return ExecResult{
+			Status: StatusErr,
+			Err: fmt.Errorf("keys query: %w: response of %d bytes exceeds the limit of %d bytes",
+				ErrResponseTooLarge, len(data), d.maxResponseSize),
+		}
+	}
+
+	d.logger.Info("KEYS query executed successfully", zap.ByteString("pattern", q.Pattern), zap.Int("matches", len(keys)))
+
+	return ExecResult{Status: StatusOK, Data: data}
+}
+
+func (d *Database) execFlush(ctx context.Context) ExecResult {
+	d.logger.Debug("executing FLUSH query")
+	unlock := d.lockWrites()
+	err := d.storage.Flush(ctx)
+	if err == nil {
+		d.publisher.Publish(eventbus.Event{Command: eventbus.CommandFlush})
+	}
+	unlock()
+
+	if err != nil {
+		d.logger.Error("failed to execute FLUSH", zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("flush query: %v", err)}
+	}
+
+	d.logger.Info("FLUSH query executed successfully")
+
+	return ExecResult{Status: StatusOkNoData}
+}
+
+func (d *Database) execDBSize(ctx context.Context) ExecResult {
+	d.logger.Debug("executing DBSIZE query")
+	n, err := d.storage.Len(ctx)
+	if err != nil {
+		d.logger.Error("failed to execute DBSIZE", zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("dbsize query: %v", err)}
+	}
+
+	d.logger.Info("DBSIZE query executed successfully", zap.Int("len", n))
+
+	return ExecResult{Status: StatusOK, Data: strconv.AppendInt(nil, int64(n), 10)}
+}
+
+func (d *Database) execIndexGet(ctx context.Context, q *compute.IndexGetQuery) ExecResult {
+	d.logger.Debug("executing INDEXGET query", zap.ByteString("field", q.Field))
+	keys, err := d.storage.IndexGet(ctx, q.Field)
+	if err != nil {
+		d.logger.Error("failed to execute INDEXGET", zap.ByteString("field", q.Field), zap.Error(err))
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("indexget query: %v", err)}
+	}
+
+	for i, key := range keys {
+		keys[i] = d.keyEncoding.encode(key)
+	}
+
+	data := bytes.Join(keys, []byte("\n"))
+
+	if d.maxResponseSize > 0 && len(data) > d.maxResponseSize {
+		d.logger.Warn("INDEXGET query: response too large", zap.ByteString("field", q.Field), zap.Int("size", len(data)))
+
+		return ExecResult{
+			Status: StatusErr,
+			Err: fmt.Errorf("indexget query: %w: response of %d bytes exceeds the limit of %d bytes",
+				ErrResponseTooLarge, len(data), d.maxResponseSize),
+		}
+	}
+
+	d.logger.Info("INDEXGET query executed successfully", zap.ByteString("field", q.Field), zap.Int("matches", len(keys)))
+
+	return ExecResult{Status: StatusOK, Data: data}
+}
+
+func (d *Database) execNoReply(ctx context.Context, q *compute.NoReplyQuery) ExecResult {
+	if err := SetNoReply(ctx, q.Enabled); err != nil {
+		d.logger.Warn("NOREPLY query outside a session")
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("noreply query: %w", err)}
+	}
+
+	d.logger.Info("NOREPLY query executed successfully", zap.Bool("enabled", q.Enabled))
+
+	return ExecResult{Status: StatusOkNoData}
+}
+
+func (d *Database) execStatusLine(ctx context.Context, q *compute.StatusLineQuery) ExecResult {
+	if err := SetStatusLine(ctx, q.Enabled); err != nil {
+		d.logger.Warn("STATUSLINE query outside a session")
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("statusline query: %w", err)}
+	}
+
+	d.logger.Info("STATUSLINE query executed successfully", zap.Bool("enabled", q.Enabled))
+
+	return ExecResult{Status: StatusOkNoData}
+}
+
+func (d *Database) execDefaultTTL(ctx context.Context, q *compute.DefaultTTLQuery) ExecResult {
+	s := sessionFrom(ctx)
+	if s == nil {
+		d.logger.Warn("DEFAULTTTL query outside a session")
+
+		return ExecResult{Status: StatusErr, Err: fmt.Errorf("defaultttl query: %w", ErrNoSession)}
+	}
+
+	s.SetDefaultTTL(time.Duration(q.Seconds) * time.Second)
+	d.logger.Info("DEFAULTTTL query executed successfully", zap.Int64("seconds", q.Seconds))
+
+	return ExecResult{Status: StatusOkNoData}
+}
+
+func (d *Database) set(ctx context.Context, key []byte, value []byte, ttl time.Duration) (bool, error) {
+	if ttl > 0 {
+		// An unchanged value is still stored so its expiry is renewed.
+		if _, _, err := d.storage.Rotate(ctx, key, value, ttl); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	if d.skipIdenticalSet {
+		return d.storage.SetIfChanged(ctx, key, value)
+	}
+
+	if err := d.storage.Set(ctx, key, value); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func diffData(keys [][]byte, values [][]byte, found []bool) []byte {
+	var data []byte
+	for i, key := range keys {
+		if !found[i] {
+			data = fmt.Appendf(data, "missing=%s\n", key)
+		}
+	}
+
+	if data != nil {
+		return append([]byte("equal=0\n"), bytes.TrimSuffix(data, []byte("\n"))...)
+	}
+
+	a, b := values[0], values[1]
+	if bytes.Equal(a, b) {
+		return []byte("equal=1")
+	}
+
+	offset := min(len(a), len(b))
+	for i := range offset {
+		if a[i] != b[i] {
+			offset = i
+
+			break
+		}
+	}
+
+	return fmt.Appendf(nil, "equal=0\noffset=%d", offset)
+}
+
+func boolData(b bool) []byte {
+	if b {
+		return []byte("1")
+	}
+
+	return []byte("0")
+}
+
+// PublishExpired returns a storage.WithExpiredHook function that publishes every expired key
+// to p, so subscribers see keys leave when their TTL passes and not only on DEL.
+func PublishExpired(p iPublisher) func(key []byte) {
+	return func(key []byte) {
+		p.Publish(eventbus.Event{Command: eventbus.CommandExpired, Key: key})
+	}
+}
+
+// lockWrites holds writeMu, if there is one, until unlock is called. Callers hold it across a
+// storage change and publishing it, so events are published in the order changes are made.
+func (d *Database) lockWrites() (unlock func()) {
+	if d.writeMu == nil {
+		return func() {}
+	}
+
+	d.writeMu.Lock()
+
+	return d.writeMu.Unlock
+}
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(eventbus.Event) {}
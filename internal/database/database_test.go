@@ -1,9 +1,20 @@
 package database_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -12,9 +23,11 @@ import (
 	"go.uber.org/zap/zaptest"
 	"go.uber.org/zap/zaptest/observer"
 
+	"github.com/maxm86545/concurrency_go/internal/cli"
 	"github.com/maxm86545/concurrency_go/internal/database"
 	"github.com/maxm86545/concurrency_go/internal/database/compute"
 	"github.com/maxm86545/concurrency_go/internal/database/storage"
+	"github.com/maxm86545/concurrency_go/internal/eventbus"
 )
 
 func TestDatabase_Exec(t *testing.T) {
@@ -123,9 +136,9 @@ func TestDatabase_Exec(t *testing.T) {
 				},
 			},
 			storage: &mockStorage{
-				delFunc: func(_ context.Context, key []byte) error {
+				delFunc: func(_ context.Context, key []byte) (bool, error) {
 					assert.Equal(t, []byte("k"), key)
-					return nil
+					return true, nil
 				},
 			},
 			wantStatus: database.StatusOkNoData,
@@ -135,6 +148,50 @@ func TestDatabase_Exec(t *testing.T) {
 				{Message: "DEL query executed successfully", Level: zapcore.InfoLevel},
 			},
 		},
+		{
+			name:     "getdefault query existing key",
+			rawQuery: []byte("getdefault"),
+			compute: &mockCompute{
+				parseFn: func(_ []byte) (compute.Query, error) {
+					return &compute.GetDefaultQuery{Key: []byte("k"), Default: []byte("d")}, nil
+				},
+			},
+			storage: &mockStorage{
+				getOrSetFunc: func(_ context.Context, key, val []byte) ([]byte, bool, error) {
+					assert.Equal(t, []byte("k"), key)
+					assert.Equal(t, []byte("d"), val)
+					return []byte("value"), true, nil
+				},
+			},
+			wantStatus: database.StatusOK,
+			wantData:   []byte("value"),
+			expectedLogs: []expectedLog{
+				{Message: "parsing query", Level: zapcore.DebugLevel},
+				{Message: "executing GETDEFAULT query", Level: zapcore.DebugLevel},
+				{Message: "GETDEFAULT query executed successfully", Level: zapcore.InfoLevel},
+			},
+		},
+		{
+			name:     "getdefault query missing key",
+			rawQuery: []byte("getdefault"),
+			compute: &mockCompute{
+				parseFn: func(_ []byte) (compute.Query, error) {
+					return &compute.GetDefaultQuery{Key: []byte("k"), Default: []byte("d")}, nil
+				},
+			},
+			storage: &mockStorage{
+				getOrSetFunc: func(_ context.Context, _, val []byte) ([]byte, bool, error) {
+					return val, false, nil
+				},
+			},
+			wantStatus: database.StatusOK,
+			wantData:   []byte("d"),
+			expectedLogs: []expectedLog{
+				{Message: "parsing query", Level: zapcore.DebugLevel},
+				{Message: "executing GETDEFAULT query", Level: zapcore.DebugLevel},
+				{Message: "GETDEFAULT query executed successfully", Level: zapcore.InfoLevel},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -239,8 +296,8 @@ func TestDatabase_ExecInvalid(t *testing.T) {
 				},
 			},
 			storage: &mockStorage{
-				delFunc: func(_ context.Context, _ []byte) error {
-					return errors.New("del failed")
+				delFunc: func(_ context.Context, _ []byte) (bool, error) {
+					return false, errors.New("del failed")
 				},
 			},
 			wantStatus: database.StatusErr,
@@ -251,6 +308,27 @@ func TestDatabase_ExecInvalid(t *testing.T) {
 				{Message: "failed to execute DEL", Level: zapcore.ErrorLevel},
 			},
 		},
+		{
+			name:     "storage error on getdefault",
+			rawQuery: []byte("getdefault"),
+			compute: &mockCompute{
+				parseFn: func(_ []byte) (compute.Query, error) {
+					return &compute.GetDefaultQuery{Key: []byte("fail"), Default: []byte("d")}, nil
+				},
+			},
+			storage: &mockStorage{
+				getOrSetFunc: func(_ context.Context, _, _ []byte) ([]byte, bool, error) {
+					return nil, false, errors.New("getdefault failed")
+				},
+			},
+			wantStatus: database.StatusErr,
+			wantErr:    "getdefault query: getdefault failed",
+			expectedLogs: []expectedLog{
+				{Message: "parsing query", Level: zapcore.DebugLevel},
+				{Message: "executing GETDEFAULT query", Level: zapcore.DebugLevel},
+				{Message: "failed to execute GETDEFAULT", Level: zapcore.ErrorLevel},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -278,6 +356,82 @@ func TestDatabase_ExecInvalid(t *testing.T) {
 	}
 }
 
+func TestDatabase_ExecHandlesAllQueryTypes(t *testing.T) {
+	samples := map[string]string{
+		"SetQuery":          "SET k v",
+		"GetQuery":          "GET k",
+		"GetRangeQuery":     "GETRANGE k 0 1",
+		"DelQuery":          "DEL k",
+		"GetDefaultQuery":   "GETDEFAULT k v",
+		"SetImmutableQuery": "SETIMMUTABLE k v",
+		"UnlockQuery":       "UNLOCK k",
+		"DebugJMapQuery":    "DEBUG JMAP",
+		"HelpQuery":         "HELP GET",
+		"LatencyQuery":      "LATENCY",
+		"StatsParseQuery":   "STATS PARSE",
+		"SetMaxQuery":       "SETMAX n 1",
+		"SetMinQuery":       "SETMIN n 1",
+		"GetPrefixQuery":    "GETPREFIX k",
+		"ExistsQuery":       "EXISTS k",
+		"IncrQuery":         "INCR n",
+		"IncrExQuery":       "INCREX n 10",
+		"DecrQuery":         "DECR n",
+		"MSetQuery":         "MSET a 1 b 2",
+		"MGetQuery":         "MGET a b",
+		"ExpireQuery":       "EXPIRE a 10",
+		"TTLQuery":          "TTL a",
+		"DelIfQuery":        "DELIF a 1",
+		"DiffQuery":         "DIFF a b",
+		"RotateQuery":       "ROTATE a 2 10",
+		"ExplainQuery":      "EXPLAIN GET a",
+		"AppendSepQuery":    "APPENDSEP a 2",
+		"FindValueQuery":    "FINDVALUE *",
+		"DefaultTTLQuery":   "DEFAULTTTL 0",
+		"EchoQuery":         "ECHO hi",
+		"KeysQuery":         "KEYS *",
+		"FlushQuery":        "FLUSH",
+		"DBSizeQuery":       "DBSIZE",
+		"IndexGetQuery":     "INDEXGET v",
+		"NoReplyQuery":      "NOREPLY OFF",
+		"StatusLineQuery":   "STATUSLINE OFF",
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), filepath.Join("compute", "query.go"), nil, 0)
+	require.NoError(t, err)
+
+	var queryTypes []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok || !spec.Name.IsExported() {
+			return true
+		}
+
+		if st, ok := spec.Type.(*ast.StructType); ok && embedsBaseQuery(st) {
+			queryTypes = append(queryTypes, spec.Name.Name)
+		}
+
+		return true
+	})
+	require.Len(t, queryTypes, len(samples), "every query type needs a sample query here")
+
+	c := compute.NewCompute(128)
+	db := database.NewDatabase(zaptest.NewLogger(t), c, storage.NewStorage())
+
+	for _, name := range queryTypes {
+		t.Run(name, func(t *testing.T) {
+			sample, ok := samples[name]
+			require.True(t, ok, "no sample query for %s", name)
+
+			query, err := c.Parse([]byte(sample))
+			require.NoError(t, err)
+			require.Equal(t, "*compute."+name, fmt.Sprintf("%T", query), "sample parses to another query type")
+
+			result := db.Exec(context.Background(), []byte(sample))
+			assert.NotEqual(t, database.StatusUnsupported, result.Status, "query type is not handled by Exec")
+		})
+	}
+}
+
 func TestDatabase_ExecCanceledContext(t *testing.T) {
 	db := database.NewDatabase(
 		zaptest.NewLogger(t),
@@ -299,46 +453,1917 @@ func TestDatabase_ExecCanceledContext(t *testing.T) {
 	assert.ErrorIs(t, result.Err, context.Canceled)
 }
 
-type mockCompute struct {
-	parseFn func([]byte) (compute.Query, error)
+func TestDatabase_ExecDelCount(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []database.Option
+		deleted    bool
+		wantStatus database.ExecStatus
+		wantData   []byte
+	}{
+		{
+			name:       "legacy existing key",
+			opts:       nil,
+			deleted:    true,
+			wantStatus: database.StatusOkNoData,
+		},
+		{
+			name:       "legacy missing key",
+			opts:       []database.Option{database.WithDelCount(false)},
+			deleted:    false,
+			wantStatus: database.StatusOkNoData,
+		},
+		{
+			name:       "count existing key",
+			opts:       []database.Option{database.WithDelCount(true)},
+			deleted:    true,
+			wantStatus: database.StatusOK,
+			wantData:   []byte("1"),
+		},
+		{
+			name:       "count missing key",
+			opts:       []database.Option{database.WithDelCount(true)},
+			deleted:    false,
+			wantStatus: database.StatusOK,
+			wantData:   []byte("0"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewDatabase(
+				zaptest.NewLogger(t),
+				&mockCompute{
+					parseFn: func(_ []byte) (compute.Query, error) {
+						return &compute.DelQuery{Key: []byte("k")}, nil
+					},
+				},
+				&mockStorage{
+					delFunc: func(_ context.Context, _ []byte) (bool, error) {
+						return tt.deleted, nil
+					},
+				},
+				tt.opts...,
+			)
+
+			result := db.Exec(context.Background(), []byte("DEL k"))
+
+			require.NoError(t, result.Err)
+			assert.Equal(t, tt.wantStatus, result.Status)
+			assert.Equal(t, tt.wantData, result.Data)
+		})
+	}
 }
 
-func (m *mockCompute) Parse(q []byte) (compute.Query, error) {
-	return m.parseFn(q)
+func TestDatabase_ExecPublishesMutations(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     compute.Query
+		wantEvent []eventbus.Event
+	}{
+		{
+			name:      "set query",
+			query:     &compute.SetQuery{Key: []byte("k"), Value: []byte("v")},
+			wantEvent: []eventbus.Event{{Command: eventbus.CommandSet, Key: []byte("k"), Value: []byte("v")}},
+		},
+		{
+			name:      "del missing key",
+			query:     &compute.DelQuery{Key: []byte("k")},
+			wantEvent: nil,
+		},
+		{
+			name:      "get query",
+			query:     &compute.GetQuery{Key: []byte("k")},
+			wantEvent: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockPublisher{}
+
+			db := database.NewDatabase(
+				zaptest.NewLogger(t),
+				&mockCompute{
+					parseFn: func(_ []byte) (compute.Query, error) {
+						return tt.query, nil
+					},
+				},
+				storage.NewStorage(),
+				database.WithPublisher(publisher),
+			)
+
+			db.Exec(context.Background(), []byte("any"))
+
+			assert.Equal(t, tt.wantEvent, publisher.events)
+		})
+	}
 }
 
-type mockStorage struct {
-	setFunc func(context.Context, []byte, []byte) error
-	getFunc func(context.Context, []byte) ([]byte, error)
-	delFunc func(context.Context, []byte) error
+func TestDatabase_ExecDelPublishesDeleted(t *testing.T) {
+	publisher := &mockPublisher{}
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithPublisher(publisher),
+	)
+
+	for _, query := range []string{"SET k v", "DEL k", "DEL k"} {
+		result := db.Exec(context.Background(), []byte(query))
+		require.NoError(t, result.Err, query)
+	}
+
+	assert.Equal(t, []eventbus.Event{
+		{Command: eventbus.CommandSet, Key: []byte("k"), Value: []byte("v")},
+		{Command: eventbus.CommandDel, Key: []byte("k")},
+	}, publisher.events)
 }
 
-func (m *mockStorage) Set(ctx context.Context, key, val []byte) error {
-	if m.setFunc == nil {
-		panic("setFunc is nil")
+func TestDatabase_ExecPublishesInOrder(t *testing.T) {
+	const writers, incrs = 8, 50
+
+	bus := eventbus.NewBus(writers * incrs)
+	sub := bus.Subscribe(eventbus.OverflowDropNewest)
+	defer sub.Close()
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t, zaptest.Level(zapcore.WarnLevel)),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithPublisher(bus),
+	)
+
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range incrs {
+				result := db.Exec(context.Background(), []byte("INCR k"))
+				assert.NoError(t, result.Err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var version uint64
+	for i := 1; i <= writers*incrs; i++ {
+		event := <-sub.Events()
+		require.Greater(t, event.Version, version)
+		require.Equal(t, strconv.Itoa(i), string(event.Value), "version %d", event.Version)
+		version = event.Version
 	}
-	return m.setFunc(ctx, key, val)
 }
 
-func (m *mockStorage) Get(ctx context.Context, key []byte) ([]byte, error) {
-	if m.getFunc == nil {
-		panic("getFunc is nil")
+func TestDatabase_ExecWritesUnorderedWithoutPublisher(t *testing.T) {
+	release := make(chan struct{})
+	blocked := make(chan struct{})
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		&mockStorage{
+			setFunc: func(_ context.Context, key, _ []byte) error {
+				if string(key) == "slow" {
+					close(blocked)
+					<-release
+				}
+
+				return nil
+			},
+		},
+	)
+
+	done := make(chan database.ExecResult, 1)
+	go func() {
+		done <- db.Exec(context.Background(), []byte("SET slow v"))
+	}()
+	<-blocked
+
+	result := db.Exec(context.Background(), []byte("SET fast v"))
+	require.NoError(t, result.Err, "a write does not wait for another when nothing is published")
+
+	close(release)
+	require.NoError(t, (<-done).Err)
+}
+
+func TestDatabase_ExecRegisteredCommand(t *testing.T) {
+	c := compute.NewCompute(128)
+	err := c.RegisterCommand("PUT", 2, func(args [][]byte) compute.Query {
+		return &compute.SetQuery{Key: args[0], Value: args[1]}
+	})
+	require.NoError(t, err)
+
+	db := database.NewDatabase(zaptest.NewLogger(t), c, storage.NewStorage())
+
+	result := db.Exec(context.Background(), []byte("PUT k v"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOkNoData, result.Status)
+
+	result = db.Exec(context.Background(), []byte("GET k"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("v"), result.Data)
+}
+
+func TestDatabase_ExecFailedMutationNotPublished(t *testing.T) {
+	publisher := &mockPublisher{}
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		&mockCompute{
+			parseFn: func(_ []byte) (compute.Query, error) {
+				return &compute.SetQuery{Key: []byte("k"), Value: []byte("v")}, nil
+			},
+		},
+		&mockStorage{
+			setFunc: func(_ context.Context, _, _ []byte) error {
+				return errors.New("set failed")
+			},
+		},
+		database.WithPublisher(publisher),
+	)
+
+	result := db.Exec(context.Background(), []byte("any"))
+
+	require.Error(t, result.Err)
+	assert.Empty(t, publisher.events)
+}
+
+func TestDatabase_ExecSkipIdenticalSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []database.Option
+		wantEvents int
+	}{
+		{
+			name:       "disabled publishes every set",
+			opts:       nil,
+			wantEvents: 3,
+		},
+		{
+			name:       "enabled skips identical set",
+			opts:       []database.Option{database.WithSkipIdenticalSet(true)},
+			wantEvents: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockPublisher{}
+			opts := append([]database.Option{database.WithPublisher(publisher)}, tt.opts...)
+
+			db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage(), opts...)
+
+			for _, query := range []string{"SET k a", "SET k a", "SET k b"} {
+				result := db.Exec(context.Background(), []byte(query))
+				require.NoError(t, result.Err, query)
+				assert.Equal(t, database.StatusOkNoData, result.Status, query)
+			}
+
+			require.Len(t, publisher.events, tt.wantEvents)
+			assert.Equal(t, []byte("b"), publisher.events[len(publisher.events)-1].Value)
+
+			result := db.Exec(context.Background(), []byte("GET k"))
+			require.NoError(t, result.Err)
+			assert.Equal(t, []byte("b"), result.Data)
+
+			for _, query := range []string{"SET e x EX 100", "SET e y", "SET f x EX 100", "SET f x"} {
+				result = db.Exec(context.Background(), []byte(query))
+				require.NoError(t, result.Err, query)
+			}
+
+			for _, key := range []string{"e", "f"} {
+				result = db.Exec(context.Background(), []byte("TTL "+key))
+				require.NoError(t, result.Err)
+				assert.Equal(t, []byte("-1"), result.Data, "SET without EX drops the expiry of %q", key)
+			}
+
+			result = db.Exec(context.Background(), []byte("SETIMMUTABLE i a"))
+			require.NoError(t, result.Err)
+
+			result = db.Exec(context.Background(), []byte("SET i a"))
+			require.EqualError(t, result.Err, "set query: storage: key is immutable", "an identical value still hits immutability")
+		})
 	}
-	return m.getFunc(ctx, key)
 }
 
-func (m *mockStorage) Del(ctx context.Context, key []byte) error {
-	if m.delFunc == nil {
-		panic("delFunc is nil")
+func TestDatabase_ExecImmutable(t *testing.T) {
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+	)
+	ctx := context.Background()
+
+	steps := []struct {
+		query      string
+		wantStatus database.ExecStatus
+		wantData   []byte
+		wantErr    string
+	}{
+		{query: "SETIMMUTABLE key locked", wantStatus: database.StatusOkNoData},
+		{query: "SET key other", wantStatus: database.StatusErr, wantErr: "set query: storage: key is immutable"},
+		{query: "DEL key", wantStatus: database.StatusErr, wantErr: "del query: storage: key is immutable"},
+		{query: "GET key", wantStatus: database.StatusOK, wantData: []byte("locked")},
+		{query: "UNLOCK key", wantStatus: database.StatusOkNoData},
+		{query: "SET key other", wantStatus: database.StatusOkNoData},
+		{query: "GET key", wantStatus: database.StatusOK, wantData: []byte("other")},
+	}
+
+	for _, step := range steps {
+		result := db.Exec(ctx, []byte(step.query))
+
+		assert.Equal(t, step.wantStatus, result.Status, step.query)
+		assert.Equal(t, step.wantData, result.Data, step.query)
+		if step.wantErr != "" {
+			require.EqualError(t, result.Err, step.wantErr, step.query)
+		} else {
+			require.NoError(t, result.Err, step.query)
+		}
 	}
-	return m.delFunc(ctx, key)
 }
 
-func newObservedLogger() (*zap.Logger, *observer.ObservedLogs) {
-	core, logs := observer.New(zapcore.DebugLevel)
-	logger := zap.New(core)
+func TestDatabase_ExecDebugJMap(t *testing.T) {
+	const keys = 5
 
-	return logger, logs
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+	)
+	ctx := context.Background()
+
+	for i := range keys {
+		result := db.Exec(ctx, fmt.Appendf(nil, "SET key%d value", i))
+		require.NoError(t, result.Err)
+	}
+
+	for _, query := range []string{"DEL key0", "DEL key1"} {
+		result := db.Exec(ctx, []byte(query))
+		require.NoError(t, result.Err)
+	}
+
+	result := db.Exec(ctx, []byte("DEBUG JMAP"))
+
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOK, result.Status)
+	assert.Equal(t, "len=3\nimmutable=0\ncapacity=5\nload=0.60", string(result.Data))
+}
+
+func TestDatabase_ExecHelp(t *testing.T) {
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		&mockStorage{},
+	)
+
+	result := db.Exec(context.Background(), []byte("HELP GET"))
+
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOK, result.Status)
+	assert.Equal(t, []byte("GET key - retrieve a value"), result.Data)
+
+	result = db.Exec(context.Background(), []byte("HELP PING"))
+
+	require.EqualError(t, result.Err, `parse query: unknown command: "PING"`)
+	assert.Equal(t, database.StatusErr, result.Status)
+
+	var pe *compute.ParseError
+	require.ErrorAs(t, result.Err, &pe, "parse errors stay inspectable through Exec")
+	assert.Equal(t, "HELP", pe.Command)
+}
+
+func TestDatabase_ExecLatency(t *testing.T) {
+	const (
+		fast      = time.Millisecond
+		slow      = 20 * time.Millisecond
+		fastCount = 90
+		slowCount = 10
+		tolerance = 5 * time.Millisecond
+	)
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t, zaptest.Level(zapcore.WarnLevel)),
+		compute.NewCompute(128),
+		&mockStorage{
+			getFunc: func(_ context.Context, key []byte) ([]byte, error) {
+				if bytes.Equal(key, []byte("slow")) {
+					time.Sleep(slow)
+				} else {
+					time.Sleep(fast)
+				}
+				return []byte("v"), nil
+			},
+		},
+		database.WithLatencyWindow(fastCount+slowCount),
+	)
+	ctx := context.Background()
+
+	for range fastCount {
+		db.Exec(ctx, []byte("GET fast"))
+	}
+	for range slowCount {
+		db.Exec(ctx, []byte("GET slow"))
+	}
+
+	result := db.Exec(ctx, []byte("LATENCY"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOK, result.Status)
+
+	got := parsePercentiles(t, result.Data)
+	assert.InDelta(t, fast, got["p50"], float64(tolerance))
+	assert.InDelta(t, slow, got["p95"], float64(tolerance))
+	assert.InDelta(t, slow, got["p99"], float64(tolerance))
+}
+
+func TestDatabase_ExecLatencyEmptyWindow(t *testing.T) {
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		&mockStorage{},
+	)
+
+	result := db.Exec(context.Background(), []byte("LATENCY"))
+
+	require.NoError(t, result.Err)
+	assert.Equal(t, "p50=0s\np95=0s\np99=0s", string(result.Data))
+}
+
+func TestDatabase_ExecLatencyDisabled(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		db := database.NewDatabase(
+			zaptest.NewLogger(t),
+			compute.NewCompute(128),
+			&mockStorage{},
+			database.WithLatencyWindow(size),
+		)
+
+		result := db.Exec(context.Background(), []byte("LATENCY"))
+		require.ErrorIs(t, result.Err, database.ErrCommandDisabled, "size %d", size)
+		assert.Equal(t, database.StatusErr, result.Status, "size %d", size)
+
+		results := db.ExecMulti(context.Background(), []byte("LATENCY; LATENCY"))
+		require.Len(t, results, 2)
+		require.ErrorIs(t, results[1].Err, database.ErrCommandDisabled, "size %d", size)
+	}
+}
+
+func TestDatabase_ExecStatsParse(t *testing.T) {
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(16),
+		&mockStorage{},
+	)
+	ctx := context.Background()
+
+	queries := []string{
+		"",
+		"   ",
+		"GET " + strings.Repeat("x", 16),
+		"PING",
+		"GET",
+		"SET key",
+		"DEL a b",
+	}
+	for _, query := range queries {
+		result := db.Exec(ctx, []byte(query))
+		require.Error(t, result.Err, query)
+	}
+
+	result := db.Exec(ctx, []byte("STATS PARSE"))
+
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOK, result.Status)
+	assert.Equal(t, "empty_query=2\ninvalid_len=1\nunknown_command=1\ninvalid_arguments=3\nother=0", string(result.Data))
+}
+
+func TestDatabase_ExecSetMaxSetMin(t *testing.T) {
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+	)
+	ctx := context.Background()
+
+	steps := []struct {
+		query    string
+		wantData []byte
+		wantErr  string
+	}{
+		{query: "SETMAX gauge 5", wantData: []byte("5")},
+		{query: "SETMAX gauge 3", wantData: []byte("5")},
+		{query: "SETMIN gauge 4", wantData: []byte("4")},
+		{query: "SET text abc"},
+		{query: "SETMAX text 1", wantErr: "setmax query: storage: value is not an integer"},
+		{query: "SETIMMUTABLE im 1"},
+		{query: "SETMAX im 0", wantErr: "setmax query: storage: key is immutable"},
+		{query: "SETMAX im 5", wantErr: "setmax query: storage: key is immutable"},
+		{query: "SETMIN im 5", wantErr: "setmin query: storage: key is immutable"},
+		{query: "SETMIN im 0", wantErr: "setmin query: storage: key is immutable"},
+	}
+
+	for _, step := range steps {
+		result := db.Exec(ctx, []byte(step.query))
+
+		if step.wantErr != "" {
+			require.EqualError(t, result.Err, step.wantErr, step.query)
+			continue
+		}
+
+		require.NoError(t, result.Err, step.query)
+		assert.Equal(t, step.wantData, result.Data, step.query)
+	}
+}
+
+func TestDatabase_ExecIncrDecr(t *testing.T) {
+	ctx := context.Background()
+	publisher := &mockPublisher{}
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithPublisher(publisher),
+	)
+
+	steps := []struct {
+		query    string
+		wantData []byte
+	}{
+		{query: "INCR counter", wantData: []byte("1")},
+		{query: "INCR counter", wantData: []byte("2")},
+		{query: "DECR counter", wantData: []byte("1")},
+		{query: "DECR fresh", wantData: []byte("-1")},
+	}
+
+	for _, step := range steps {
+		result := db.Exec(ctx, []byte(step.query))
+		require.NoError(t, result.Err, step.query)
+		assert.Equal(t, database.StatusOK, result.Status, step.query)
+		assert.Equal(t, step.wantData, result.Data, step.query)
+	}
+
+	assert.Len(t, publisher.events, len(steps))
+	assert.Equal(t, eventbus.Event{Command: eventbus.CommandSet, Key: []byte("fresh"), Value: []byte("-1")}, publisher.events[3])
+
+	require.NoError(t, db.Exec(ctx, []byte("SET text abc")).Err)
+
+	result := db.Exec(ctx, []byte("INCR text"))
+	assert.Equal(t, database.StatusErr, result.Status)
+	require.EqualError(t, result.Err, "incr query: storage: value is not an integer")
+}
+
+func TestDatabase_ExecMSetMGet(t *testing.T) {
+	ctx := context.Background()
+	publisher := &mockPublisher{}
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithPublisher(publisher),
+	)
+
+	result := db.Exec(ctx, []byte("MSET a 1 b 2 c 3"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOkNoData, result.Status)
+	assert.Len(t, publisher.events, 3)
+
+	result = db.Exec(ctx, []byte("MGET c missing a"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOK, result.Status)
+	assert.Equal(t, []byte("3\n(nil)\n1"), result.Data)
+
+	require.NoError(t, db.Exec(ctx, []byte("SETIMMUTABLE locked v")).Err)
+
+	result = db.Exec(ctx, []byte("MSET d 4 locked x e 5"))
+	assert.Equal(t, database.StatusErr, result.Status)
+	require.EqualError(t, result.Err, `mset query: key "locked": storage: key is immutable`)
+
+	result = db.Exec(ctx, []byte("MGET d e"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("(nil)\n(nil)"), result.Data, "no pair is stored when one fails")
+	assert.Len(t, publisher.events, 4, "nothing is published for a failed MSET")
+
+	require.NoError(t, db.Exec(ctx, []byte("SET nil NOT_FOUND")).Err)
+
+	result = db.Exec(ctx, []byte("MGET nil missing"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("NOT_FOUND\n(nil)"), result.Data, "a stored NOT_FOUND is not taken for a missing key")
+}
+
+func TestDatabase_ExecExpire(t *testing.T) {
+	var gotTTL time.Duration
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		&mockStorage{
+			expireFunc: func(_ context.Context, key []byte, ttl time.Duration) (bool, error) {
+				gotTTL = ttl
+				return string(key) == "present", nil
+			},
+		},
+	)
+
+	result := db.Exec(context.Background(), []byte("EXPIRE present 30"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("1"), result.Data)
+	assert.Equal(t, 30*time.Second, gotTTL)
+
+	result = db.Exec(context.Background(), []byte("EXPIRE missing 30"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("0"), result.Data)
+}
+
+func TestDatabase_ExecTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		err        error
+		wantStatus database.ExecStatus
+		wantData   []byte
+	}{
+		{name: "whole seconds", ttl: 10 * time.Second, wantStatus: database.StatusOK, wantData: []byte("10")},
+		{name: "rounds up", ttl: 9*time.Second + time.Millisecond, wantStatus: database.StatusOK, wantData: []byte("10")},
+		{name: "mid-countdown", ttl: 4*time.Second + 500*time.Millisecond, wantStatus: database.StatusOK, wantData: []byte("5")},
+		{name: "no expiry", ttl: storage.NoExpiry, wantStatus: database.StatusOK, wantData: []byte("-1")},
+		{name: "missing key", err: storage.ErrNotFound, wantStatus: database.StatusOK, wantData: []byte("-2")},
+		{name: "storage error", err: context.Canceled, wantStatus: database.StatusErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewDatabase(
+				zaptest.NewLogger(t),
+				compute.NewCompute(128),
+				&mockStorage{
+					ttlFunc: func(_ context.Context, _ []byte) (time.Duration, error) {
+						return tt.ttl, tt.err
+					},
+				},
+			)
+
+			result := db.Exec(context.Background(), []byte("TTL k"))
+
+			assert.Equal(t, tt.wantStatus, result.Status)
+			assert.Equal(t, tt.wantData, result.Data)
+		})
+	}
+}
+
+func TestDatabase_ExecTTLLifecycle(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	assert.Equal(t, []byte("-2"), db.Exec(ctx, []byte("TTL k")).Data, "missing")
+
+	require.NoError(t, db.Exec(ctx, []byte("SET k v")).Err)
+	assert.Equal(t, []byte("-1"), db.Exec(ctx, []byte("TTL k")).Data, "no expiry")
+
+	require.NoError(t, db.Exec(ctx, []byte("EXPIRE k 1")).Err)
+	assert.Equal(t, []byte("1"), db.Exec(ctx, []byte("TTL k")).Data, "counting down")
+
+	require.Eventually(t, func() bool {
+		return bytes.Equal([]byte("-2"), db.Exec(ctx, []byte("TTL k")).Data)
+	}, 3*time.Second, 50*time.Millisecond, "expired")
+}
+
+func TestDatabase_ExecIncrExWindow(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	result := db.Exec(ctx, []byte("INCREX hits 1"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("1"), result.Data, "first call creates the counter")
+	assert.Equal(t, []byte("1"), db.Exec(ctx, []byte("TTL hits")).Data, "first call sets the ttl")
+
+	result = db.Exec(ctx, []byte("INCREX hits 100"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("2"), result.Data)
+	assert.Equal(t, []byte("1"), db.Exec(ctx, []byte("TTL hits")).Data, "later calls keep the ttl")
+
+	require.Eventually(t, func() bool {
+		return bytes.Equal([]byte("-2"), db.Exec(ctx, []byte("TTL hits")).Data)
+	}, 3*time.Second, 50*time.Millisecond, "expired")
+
+	result = db.Exec(ctx, []byte("INCREX hits 1"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("1"), result.Data, "a new window starts over")
+}
+
+func TestDatabase_ExecDelIf(t *testing.T) {
+	ctx := context.Background()
+	publisher := &mockPublisher{}
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithPublisher(publisher),
+	)
+
+	require.NoError(t, db.Exec(ctx, []byte("SET k current")).Err)
+	publisher.events = nil
+
+	result := db.Exec(ctx, []byte("DELIF k stale"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("0"), result.Data)
+	assert.Empty(t, publisher.events, "no event without a delete")
+
+	result = db.Exec(ctx, []byte("DELIF k current"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, []byte("1"), result.Data)
+	assert.Equal(t, []eventbus.Event{{Command: eventbus.CommandDel, Key: []byte("k")}}, publisher.events)
+
+	assert.Equal(t, database.StatusNotFound, db.Exec(ctx, []byte("GET k")).Status)
+}
+
+func TestDatabase_ExecRotate(t *testing.T) {
+	ctx := context.Background()
+	publisher := &mockPublisher{}
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithPublisher(publisher),
+	)
+
+	result := db.Exec(ctx, []byte("ROTATE token t1 30"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusNotFound, result.Status)
+
+	result = db.Exec(ctx, []byte("ROTATE token t2 30"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOK, result.Status)
+	assert.Equal(t, []byte("t1"), result.Data)
+
+	assert.Equal(t, []byte("t2"), db.Exec(ctx, []byte("GET token")).Data)
+	assert.Equal(t, []byte("30"), db.Exec(ctx, []byte("TTL token")).Data)
+	assert.Equal(t, []eventbus.Event{
+		{Command: eventbus.CommandSet, Key: []byte("token"), Value: []byte("t1"), TTL: 30 * time.Second},
+		{Command: eventbus.CommandSet, Key: []byte("token"), Value: []byte("t2"), TTL: 30 * time.Second},
+	}, publisher.events)
+
+	require.NoError(t, db.Exec(ctx, []byte("SETIMMUTABLE locked v")).Err)
+	result = db.Exec(ctx, []byte("ROTATE locked v2 30"))
+	assert.Equal(t, database.StatusErr, result.Status)
+	require.ErrorContains(t, result.Err, "rotate query")
+}
+
+func TestDatabase_ExpiryEvents(t *testing.T) {
+	publisher := &mockPublisher{}
+	store := storage.NewStorage(storage.WithExpiredHook(database.PublishExpired(publisher)))
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), store, database.WithPublisher(publisher))
+	ctx := database.WithSession(context.Background())
+
+	require.NoError(t, db.Exec(ctx, []byte("SET plain v")).Err)
+	require.NoError(t, db.Exec(ctx, []byte("SET timed v EX 10")).Err)
+	require.NoError(t, db.Exec(ctx, []byte("EXPIRE plain 20")).Err)
+	require.NoError(t, db.Exec(ctx, []byte("EXPIRE missing 20")).Err)
+	require.NoError(t, db.Exec(ctx, []byte("DEFAULTTTL 30")).Err)
+	require.NoError(t, db.Exec(ctx, []byte("SET defaulted v")).Err)
+
+	assert.Equal(t, []eventbus.Event{
+		{Command: eventbus.CommandSet, Key: []byte("plain"), Value: []byte("v")},
+		{Command: eventbus.CommandSet, Key: []byte("timed"), Value: []byte("v"), TTL: 10 * time.Second},
+		{Command: eventbus.CommandExpire, Key: []byte("plain"), TTL: 20 * time.Second},
+		{Command: eventbus.CommandSet, Key: []byte("defaulted"), Value: []byte("v"), TTL: 30 * time.Second},
+	}, publisher.events, "EXPIRE on a missing key publishes nothing")
+
+	_, err := store.Expire(ctx, []byte("plain"), time.Millisecond)
+	require.NoError(t, err)
+	publisher.events = nil
+
+	require.Eventually(t, func() bool {
+		return db.Exec(ctx, []byte("GET plain")).Status == database.StatusNotFound
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []eventbus.Event{{Command: eventbus.CommandExpired, Key: []byte("plain")}}, publisher.events)
+}
+
+func TestDatabase_ExecDefaultTTL(t *testing.T) {
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+	ctx := database.WithSession(context.Background())
+
+	require.NoError(t, db.Exec(ctx, []byte("DEFAULTTTL 30")).Err)
+
+	require.NoError(t, db.Exec(ctx, []byte("SET plain v")).Err)
+	assert.Equal(t, []byte("30"), db.Exec(ctx, []byte("TTL plain")).Data, "a plain SET gets the default")
+
+	require.NoError(t, db.Exec(ctx, []byte("SET explicit v EX 100")).Err)
+	assert.Equal(t, []byte("100"), db.Exec(ctx, []byte("TTL explicit")).Data, "EX overrides the default")
+
+	other := database.WithSession(context.Background())
+	require.NoError(t, db.Exec(other, []byte("SET other v")).Err)
+	assert.Equal(t, []byte("-1"), db.Exec(other, []byte("TTL other")).Data, "the default is scoped to its session")
+
+	require.NoError(t, db.Exec(ctx, []byte("DEFAULTTTL 0")).Err)
+	require.NoError(t, db.Exec(ctx, []byte("SET plain v")).Err)
+	assert.Equal(t, []byte("-1"), db.Exec(ctx, []byte("TTL plain")).Data, "0 disables the default")
+
+	result := db.Exec(context.Background(), []byte("DEFAULTTTL 30"))
+	assert.Equal(t, database.StatusErr, result.Status)
+	require.ErrorIs(t, result.Err, database.ErrNoSession)
+}
+
+func TestDatabase_ExecNoReply(t *testing.T) {
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+	ctx := database.WithSession(context.Background())
+
+	assert.False(t, db.Exec(ctx, []byte("SET a 1")).NoReply, "off by default")
+
+	require.NoError(t, db.Exec(ctx, []byte("NOREPLY ON")).Err)
+
+	for _, query := range []string{"SET a 1", "SET a 1", "DEL a", "DEL a"} {
+		result := db.Exec(ctx, []byte(query))
+		require.NoError(t, result.Err, query)
+		assert.True(t, result.NoReply, query)
+	}
+
+	for _, query := range []string{"GET a", "FLUSH", "DEFAULTTTL 0", "SETIMMUTABLE im v", "UNLOCK im", "SET"} {
+		assert.False(t, db.Exec(ctx, []byte(query)).NoReply, "%s is still answered", query)
+	}
+
+	require.NoError(t, db.Exec(ctx, []byte("SETIMMUTABLE locked v")).Err)
+	assert.False(t, db.Exec(ctx, []byte("SET locked w")).NoReply, "failed writes are still answered")
+
+	other := database.WithSession(context.Background())
+	assert.False(t, db.Exec(other, []byte("SET b 1")).NoReply, "the mode is scoped to its session")
+
+	require.NoError(t, db.Exec(ctx, []byte("NOREPLY OFF")).Err)
+	assert.False(t, db.Exec(ctx, []byte("SET a 1")).NoReply)
+
+	result := db.Exec(context.Background(), []byte("NOREPLY ON"))
+	require.ErrorIs(t, result.Err, database.ErrNoSession)
+}
+
+func TestDatabase_ExecEcho(t *testing.T) {
+	// The empty mock panics on any storage call.
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), &mockStorage{})
+
+	tests := []struct {
+		query string
+		want  []byte
+	}{
+		{query: "ECHO ping", want: []byte("ping")},
+		{query: `ECHO "hello world"`, want: []byte("hello world")},
+		{query: `ECHO "a\tb\nc \"d\" \\"`, want: []byte("a\tb\nc \"d\" \\")},
+		{query: `ECHO ""`, want: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result := db.Exec(context.Background(), []byte(tt.query))
+			require.NoError(t, result.Err)
+			assert.Equal(t, database.StatusOK, result.Status)
+			assert.Equal(t, tt.want, result.Data)
+		})
+	}
+}
+
+func TestDatabase_ExecAppendSep(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []database.Option
+		queries []string
+		want    []string
+		value   string
+	}{
+		{
+			name:    "default separator",
+			queries: []string{"APPENDSEP list a", "APPENDSEP list bc", "APPENDSEP list d"},
+			want:    []string{"1", "4", "6"},
+			value:   "a,bc,d",
+		},
+		{
+			name:    "configured separator",
+			opts:    []database.Option{database.WithAppendSeparator([]byte(" | "))},
+			queries: []string{"APPENDSEP list a", "APPENDSEP list b"},
+			want:    []string{"1", "5"},
+			value:   "a | b",
+		},
+		{
+			name:    "empty value gets no separator",
+			queries: []string{`SET list ""`, "APPENDSEP list a"},
+			want:    []string{"", "1"},
+			value:   "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage(), tt.opts...)
+
+			for i, query := range tt.queries {
+				result := db.Exec(ctx, []byte(query))
+				require.NoError(t, result.Err, query)
+				assert.Equal(t, tt.want[i], string(result.Data), query)
+			}
+
+			assert.Equal(t, tt.value, string(db.Exec(ctx, []byte("GET list")).Data))
+		})
+	}
+}
+
+func TestDatabase_KeyEncoding(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	require.NoError(t, s.Set(ctx, []byte("k\x00\xff"), []byte("v")))
+	require.NoError(t, s.Set(ctx, []byte("k:é"), []byte("v")))
+	require.NoError(t, s.Set(ctx, []byte("k\nline"), []byte("v")))
+
+	tests := []struct {
+		name     string
+		encoding database.KeyEncoding
+		want     []string
+	}{
+		{name: "raw", encoding: database.KeyEncodingRaw, want: []string{"k\x00\xff", "k\nline", "k:é"}},
+		{name: "hex", encoding: database.KeyEncodingHex, want: []string{"hex:6b00ff", "hex:6b0a6c696e65", "k:é"}},
+		{name: "base64", encoding: database.KeyEncodingBase64, want: []string{"base64:awD/", "base64:awpsaW5l", "k:é"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewDatabase(
+				zaptest.NewLogger(t),
+				compute.NewCompute(128),
+				s,
+				database.WithKeyEncoding(tt.encoding),
+				database.WithFindValue(true),
+			)
+
+			result := db.Exec(ctx, []byte("FINDVALUE v"))
+			require.NoError(t, result.Err)
+			assert.Equal(t, strings.Join(tt.want, "\n"), string(result.Data))
+
+			result = db.Exec(ctx, []byte("GETPREFIX k"))
+			require.NoError(t, result.Err)
+			assert.Equal(t, strings.Join(tt.want, "\nv\n")+"\nv", string(result.Data))
+		})
+	}
+}
+
+func TestDatabase_ExecFindValue(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	for key, value := range map[string][]byte{
+		"fruit:1": []byte("apple"),
+		"fruit:2": []byte("apricot"),
+		"fruit:3": []byte("banana"),
+		"empty":   {},
+		"binary":  {0, 0xff},
+	} {
+		require.NoError(t, s.Set(ctx, []byte(key), value))
+	}
+
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), s, database.WithFindValue(true))
+
+	tests := []struct {
+		query    string
+		wantData string
+	}{
+		{query: "FINDVALUE ap*", wantData: "fruit:1\nfruit:2"},
+		{query: "FINDVALUE *an*", wantData: "fruit:3"},
+		{query: "FINDVALUE ??", wantData: "binary"},
+		{query: `FINDVALUE ""`, wantData: "empty"},
+		{query: "FINDVALUE *", wantData: "binary\nempty\nfruit:1\nfruit:2\nfruit:3"},
+		{query: "FINDVALUE cherry", wantData: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result := db.Exec(ctx, []byte(tt.query))
+
+			require.NoError(t, result.Err)
+			assert.Equal(t, database.StatusOK, result.Status)
+			assert.Equal(t, tt.wantData, string(result.Data))
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), &mockStorage{})
+
+		result := db.Exec(ctx, []byte("FINDVALUE *"))
+		assert.Equal(t, database.StatusErr, result.Status)
+		require.ErrorIs(t, result.Err, database.ErrCommandDisabled)
+	})
+}
+
+func TestDatabase_ExecKeys(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	for _, key := range []string{"user:1", "user:2", "user:10", "order:1"} {
+		require.NoError(t, s.Set(ctx, []byte(key), []byte("v")))
+	}
+
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), s)
+
+	tests := []struct {
+		query    string
+		wantData string
+	}{
+		{query: "KEYS user:*", wantData: "user:1\nuser:10\nuser:2"},
+		{query: "KEYS user:?", wantData: "user:1\nuser:2"},
+		{query: "KEYS *:1", wantData: "order:1\nuser:1"},
+		{query: "KEYS *", wantData: "order:1\nuser:1\nuser:10\nuser:2"},
+		{query: "KEYS session:*", wantData: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result := db.Exec(ctx, []byte(tt.query))
+
+			require.NoError(t, result.Err)
+			assert.Equal(t, database.StatusOK, result.Status)
+			assert.Equal(t, tt.wantData, string(result.Data))
+		})
+	}
+
+	t.Run("response too large", func(t *testing.T) {
+		db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), s, database.WithMaxResponseSize(10))
+
+		result := db.Exec(ctx, []byte("KEYS *"))
+		assert.Equal(t, database.StatusErr, result.Status)
+		require.ErrorIs(t, result.Err, database.ErrResponseTooLarge)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), &mockStorage{
+			keysFunc: func(context.Context, func([]byte) bool) ([][]byte, error) {
+				return nil, context.Canceled
+			},
+		})
+
+		result := db.Exec(ctx, []byte("KEYS *"))
+		assert.Equal(t, database.StatusErr, result.Status)
+		require.Error(t, result.Err)
+	})
+}
+
+func TestDatabase_ExecFlush(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+	publisher := &mockPublisher{}
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), s, database.WithPublisher(publisher))
+
+	keys := []string{"a", "b", "c"}
+	for _, key := range keys {
+		require.NoError(t, db.Exec(ctx, []byte("SET "+key+" v")).Err)
+	}
+	publisher.events = nil
+
+	result := db.Exec(ctx, []byte("FLUSH"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOkNoData, result.Status)
+	assert.Equal(t, []eventbus.Event{{Command: eventbus.CommandFlush}}, publisher.events)
+
+	for _, key := range keys {
+		_, err := s.Get(ctx, []byte(key))
+		require.ErrorIs(t, err, storage.ErrNotFound, "key %q", key)
+	}
+
+	t.Run("storage error", func(t *testing.T) {
+		publisher := &mockPublisher{}
+		db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), &mockStorage{
+			flushFunc: func(context.Context) error { return context.Canceled },
+		}, database.WithPublisher(publisher))
+
+		result := db.Exec(ctx, []byte("FLUSH"))
+		assert.Equal(t, database.StatusErr, result.Status)
+		require.Error(t, result.Err)
+		assert.Empty(t, publisher.events)
+	})
+}
+
+func TestDatabase_ExecDBSize(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	steps := []struct {
+		name     string
+		query    string
+		wantSize string
+	}{
+		{name: "empty", wantSize: "0"},
+		{name: "populated", query: "MSET a 1 b 2 c 3", wantSize: "3"},
+		{name: "overwrite", query: "SET a 4", wantSize: "3"},
+		{name: "after deletion", query: "DEL b", wantSize: "2"},
+	}
+
+	for _, step := range steps {
+		if step.query != "" {
+			require.NoError(t, db.Exec(ctx, []byte(step.query)).Err, step.name)
+		}
+
+		result := db.Exec(ctx, []byte("DBSIZE"))
+		require.NoError(t, result.Err, step.name)
+		assert.Equal(t, database.StatusOK, result.Status, step.name)
+		assert.Equal(t, step.wantSize, string(result.Data), step.name)
+	}
+}
+
+func TestDatabase_ExecIndexGet(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(storage.WithIndex([]byte("user:"))),
+	)
+
+	require.NoError(t, db.Exec(ctx, []byte("MSET user:1 admin user:2 guest user:3 admin other admin")).Err)
+
+	result := db.Exec(ctx, []byte("INDEXGET admin"))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOK, result.Status)
+	assert.Equal(t, "user:1\nuser:3", string(result.Data))
+
+	require.NoError(t, db.Exec(ctx, []byte("DEL user:1")).Err)
+	assert.Equal(t, "user:3", string(db.Exec(ctx, []byte("INDEXGET admin")).Data), "deletes leave the index")
+
+	require.NoError(t, db.Exec(ctx, []byte("SET user:3 guest")).Err)
+	assert.Empty(t, db.Exec(ctx, []byte("INDEXGET admin")).Data)
+	assert.Equal(t, "user:2\nuser:3", string(db.Exec(ctx, []byte("INDEXGET guest")).Data))
+
+	result = database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage()).
+		Exec(ctx, []byte("INDEXGET admin"))
+	assert.Equal(t, database.StatusErr, result.Status)
+	assert.EqualError(t, result.Err, "indexget query: storage: no index")
+}
+
+func TestDatabase_ExecMulti(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	results := db.ExecMulti(ctx, []byte("SET a 1; SET b 2; GET a;"))
+	require.Len(t, results, 3)
+	assert.Equal(t, database.StatusOkNoData, results[0].Status)
+	assert.Equal(t, database.StatusOkNoData, results[1].Status)
+	assert.Equal(t, database.StatusOK, results[2].Status)
+	assert.Equal(t, []byte("1"), results[2].Data)
+
+	results = db.ExecMulti(ctx, []byte(`SET c "x;y"; INCR c; GET c`))
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Err)
+	require.EqualError(t, results[1].Err, "incr query: storage: value is not an integer", "a failing query does not stop the rest")
+	assert.Equal(t, []byte("x;y"), results[2].Data)
+
+	results = db.ExecMulti(ctx, []byte("SET d 1; FETCH d"))
+	require.Len(t, results, 1)
+	require.ErrorIs(t, results[0].Err, compute.ErrUnknownCommand)
+	assert.Equal(t, database.StatusNotFound, db.Exec(ctx, []byte("GET d")).Status, "an invalid line runs nothing")
+
+	results = db.ExecMulti(ctx, []byte(" ; "))
+	require.Len(t, results, 1)
+	require.ErrorIs(t, results[0].Err, compute.ErrEmptyQuery)
+}
+
+func TestDatabase_ExecExplain(t *testing.T) {
+	// Storage has no funcs set, so any access panics.
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), &mockStorage{})
+
+	result := db.Exec(context.Background(), []byte(`EXPLAIN SET greeting "hello \"world\""`))
+	require.NoError(t, result.Err)
+	assert.Equal(t, database.StatusOK, result.Status)
+	assert.Equal(t, `SET key=greeting value="hello \"world\""`, string(result.Data))
+
+	result = db.Exec(context.Background(), []byte("EXPLAIN SET onlykey"))
+	assert.Equal(t, database.StatusErr, result.Status)
+	require.ErrorContains(t, result.Err, "parse query: explain: invalid arguments")
+}
+
+func TestDatabase_ExecDiff(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	for _, query := range []string{"SET a hello", "SET b hello", "SET c help", "SET d hell"} {
+		require.NoError(t, db.Exec(ctx, []byte(query)).Err, query)
+	}
+
+	tests := []struct {
+		query    string
+		wantData string
+	}{
+		{query: "DIFF a b", wantData: "equal=1"},
+		{query: "DIFF a a", wantData: "equal=1"},
+		{query: "DIFF a c", wantData: "equal=0\noffset=3"},
+		{query: "DIFF a d", wantData: "equal=0\noffset=4"},
+		{query: "DIFF a missing", wantData: "equal=0\nmissing=missing"},
+		{query: "DIFF x y", wantData: "equal=0\nmissing=x\nmissing=y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result := db.Exec(ctx, []byte(tt.query))
+
+			require.NoError(t, result.Err)
+			assert.Equal(t, database.StatusOK, result.Status)
+			assert.Equal(t, tt.wantData, string(result.Data))
+		})
+	}
+}
+
+func TestDatabase_ExecExists(t *testing.T) {
+	tests := []struct {
+		name       string
+		getErr     error
+		wantStatus database.ExecStatus
+		wantData   []byte
+	}{
+		{name: "present key", getErr: nil, wantStatus: database.StatusOK, wantData: []byte("1")},
+		{name: "missing key", getErr: storage.ErrNotFound, wantStatus: database.StatusOK, wantData: []byte("0")},
+		{name: "storage error", getErr: context.Canceled, wantStatus: database.StatusErr, wantData: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewDatabase(
+				zaptest.NewLogger(t),
+				compute.NewCompute(128),
+				&mockStorage{
+					getFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+						if tt.getErr != nil {
+							return nil, tt.getErr
+						}
+
+						return []byte("value"), nil
+					},
+				},
+			)
+
+			result := db.Exec(context.Background(), []byte("EXISTS k"))
+
+			assert.Equal(t, tt.wantStatus, result.Status)
+			assert.Equal(t, tt.wantData, result.Data)
+			if tt.wantStatus == database.StatusErr {
+				require.Error(t, result.Err)
+			} else {
+				require.NoError(t, result.Err)
+			}
+		})
+	}
+}
+
+func TestDatabase_ExecGetPrefix(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	for _, query := range []string{"SET user:2 bob", "SET user:1 alice", "SET order:1 book"} {
+		require.NoError(t, db.Exec(ctx, []byte(query)).Err, query)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantData []byte
+	}{
+		{name: "matching keys", query: "GETPREFIX user:", wantData: []byte("user:1\nalice\nuser:2\nbob")},
+		{name: "single match", query: "GETPREFIX order", wantData: []byte("order:1\nbook")},
+		{name: "no match", query: "GETPREFIX session:", wantData: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := db.Exec(ctx, []byte(tt.query))
+
+			require.NoError(t, result.Err)
+			assert.Equal(t, database.StatusOK, result.Status)
+			assert.Equal(t, tt.wantData, result.Data)
+		})
+	}
+
+	limited := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		&mockStorage{
+			getPrefixFunc: func(_ context.Context, _ []byte) ([]storage.KeyValue, error) {
+				return []storage.KeyValue{{Key: []byte("k"), Value: []byte("long value")}}, nil
+			},
+		},
+		database.WithMaxResponseSize(5),
+	)
+
+	result := limited.Exec(ctx, []byte("GETPREFIX k"))
+	assert.Equal(t, database.StatusErr, result.Status)
+	require.ErrorIs(t, result.Err, database.ErrResponseTooLarge)
+}
+
+func TestDatabase_Seed(t *testing.T) {
+	ctx := context.Background()
+	publisher := &mockPublisher{}
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithPublisher(publisher),
+	)
+
+	seed := "# exported\nSET a 1\n\nset b 2\n  SET a 3  \n"
+
+	loaded, err := db.Seed(ctx, strings.NewReader(seed))
+	require.NoError(t, err)
+	assert.Equal(t, 3, loaded)
+	assert.Len(t, publisher.events, 3, "seeded writes are published like regular SETs")
+
+	for key, want := range map[string]string{"a": "3", "b": "2"} {
+		result := db.Exec(ctx, []byte("GET "+key))
+		require.NoError(t, result.Err, key)
+		assert.Equal(t, []byte(want), result.Data, key)
+	}
+}
+
+func TestDatabase_SeedInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		seed       string
+		wantLoaded int
+		wantErr    string
+	}{
+		{
+			name:       "non-SET query",
+			seed:       "SET a 1\nDEL a\n",
+			wantLoaded: 1,
+			wantErr:    "seed line 2: seed query must be SET",
+		},
+		{
+			name:       "unparsable query",
+			seed:       "SET a\n",
+			wantLoaded: 0,
+			wantErr:    "seed line 1: parse query: invalid arguments: set expects 3 or 5 arguments, got 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+			loaded, err := db.Seed(context.Background(), strings.NewReader(tt.seed))
+			require.EqualError(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantLoaded, loaded)
+		})
+	}
+}
+
+func TestDatabase_ExecExpensiveQueryLimit(t *testing.T) {
+	const limit = 2
+
+	ctx := context.Background()
+	release := make(chan struct{})
+	started := make(chan struct{}, limit)
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		&mockStorage{
+			getPrefixFunc: func(_ context.Context, _ []byte) ([]storage.KeyValue, error) {
+				started <- struct{}{}
+				<-release
+
+				return nil, nil
+			},
+			getFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+				return []byte("v"), nil
+			},
+		},
+		database.WithExpensiveQueryLimit(limit),
+	)
+
+	var wg sync.WaitGroup
+	for range limit {
+		wg.Go(func() {
+			assert.NoError(t, db.Exec(ctx, []byte("GETPREFIX k")).Err)
+		})
+	}
+
+	for range limit {
+		<-started
+	}
+
+	result := db.Exec(ctx, []byte("GETPREFIX k"))
+	assert.Equal(t, database.StatusErr, result.Status)
+	require.ErrorIs(t, result.Err, database.ErrBusy)
+
+	result = db.Exec(ctx, []byte("GET k"))
+	require.NoError(t, result.Err, "cheap queries are not limited")
+	assert.Equal(t, []byte("v"), result.Data)
+
+	close(release)
+	wg.Wait()
+
+	result = db.Exec(ctx, []byte("GETPREFIX k"))
+	require.NoError(t, result.Err, "slots are released when queries finish")
+}
+
+func TestDatabase_SelfTest(t *testing.T) {
+	queryLog := &bytes.Buffer{}
+	publisher := &mockPublisher{}
+	s := storage.NewStorage()
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		s,
+		database.WithQueryLog(queryLog),
+		database.WithPublisher(publisher),
+	)
+
+	require.NoError(t, db.SelfTest(context.Background()))
+
+	stats, err := s.MapStats(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, stats.Len, "self-test must not leave keys behind")
+	assert.Empty(t, publisher.events, "self-test must not publish events")
+	assert.True(t, strings.HasPrefix(queryLog.String(), "# "), "query log gets a comment line")
+	assert.True(t, strings.HasSuffix(queryLog.String(), " self-test\n"))
+}
+
+func TestDatabase_SelfTestFailures(t *testing.T) {
+	t.Run("unwritable query log", func(t *testing.T) {
+		db := database.NewDatabase(
+			zaptest.NewLogger(t),
+			compute.NewCompute(128),
+			storage.NewStorage(),
+			database.WithQueryLog(failingWriter{}),
+		)
+
+		require.EqualError(t, db.SelfTest(context.Background()), "self-test: write query log: disk full")
+	})
+
+	t.Run("broken storage", func(t *testing.T) {
+		db := database.NewDatabase(
+			zaptest.NewLogger(t),
+			compute.NewCompute(128),
+			&mockStorage{
+				setFunc: func(_ context.Context, _, _ []byte) error {
+					return errors.New("engine offline")
+				},
+			},
+		)
+
+		require.EqualError(t, db.SelfTest(context.Background()), "self-test: set: engine offline")
+	})
+}
+
+func TestDatabase_QueryLogReplay(t *testing.T) {
+	ctx := context.Background()
+	queryLog := &bytes.Buffer{}
+
+	source := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithQueryLog(queryLog),
+	)
+
+	seeded, err := source.Seed(ctx, strings.NewReader("# seed\nSET s 1\n"))
+	require.NoError(t, err)
+	require.Equal(t, 1, seeded)
+
+	queries := []string{
+		"SET a 1",
+		"SET b 2",
+		"SET c 3",
+		"DEL b",
+		"GET a",
+		"SETMAX a 10",
+		"BAD QUERY",
+		"GETDEFAULT d default",
+	}
+	for _, query := range queries {
+		source.Exec(ctx, []byte(query))
+	}
+
+	logged := append([]string{"SET s 1"}, queries...)
+	lines := strings.Split(strings.TrimSuffix(queryLog.String(), "\n"), "\n")
+	require.Len(t, lines, 2*len(logged))
+	for i, query := range logged {
+		assert.True(t, strings.HasPrefix(lines[2*i], "# "), "expected timestamp comment, got %q", lines[2*i])
+		assert.Equal(t, query, lines[2*i+1])
+	}
+
+	replica := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+	)
+
+	app, err := cli.NewCliApp(queryLog, io.Discard, io.Discard, replica, cli.WithSkipComments(true))
+	require.NoError(t, err)
+	require.NoError(t, app.Run(ctx))
+
+	for _, key := range []string{"s", "a", "b", "c", "d"} {
+		want := source.Exec(ctx, []byte("GET "+key))
+		got := replica.Exec(ctx, []byte("GET "+key))
+		assert.Equal(t, want, got, "key %q", key)
+	}
+}
+
+func TestDatabase_QueryLogSkipsSessionQueries(t *testing.T) {
+	queryLog := &bytes.Buffer{}
+
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithQueryLog(queryLog),
+	)
+
+	first := database.WithSession(context.Background())
+	second := database.WithSession(context.Background())
+
+	for _, query := range []string{"NOREPLY ON", "DEFAULTTTL 30", "STATUSLINE ON", "SET a 1"} {
+		result := db.Exec(first, []byte(query))
+		require.NoError(t, result.Err, query)
+	}
+
+	for _, r := range db.ExecMulti(second, []byte("NOREPLY ON; SET b 2 ;INCR n")) {
+		require.NoError(t, r.Err)
+	}
+
+	db.ExecMulti(second, []byte("SET c 3; BAD"))
+
+	var logged []string
+	for _, line := range strings.Split(strings.TrimSuffix(queryLog.String(), "\n"), "\n") {
+		if !strings.HasPrefix(line, "# ") {
+			logged = append(logged, line)
+		}
+	}
+
+	assert.Equal(t, []string{"SET a 1", "SET b 2", "INCR n", "SET c 3; BAD"}, logged,
+		"session queries are left out and each query of a line is logged on its own")
+}
+
+func TestDatabase_ExecMaxResponseSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		value      []byte
+		wantStatus database.ExecStatus
+		wantErr    error
+	}{
+		{
+			name:       "unlimited",
+			limit:      0,
+			value:      bytes.Repeat([]byte("x"), 1024),
+			wantStatus: database.StatusOK,
+		},
+		{
+			name:       "under the limit",
+			limit:      8,
+			value:      []byte("1234567"),
+			wantStatus: database.StatusOK,
+		},
+		{
+			name:       "at the limit",
+			limit:      8,
+			value:      []byte("12345678"),
+			wantStatus: database.StatusOK,
+		},
+		{
+			name:       "over the limit",
+			limit:      8,
+			value:      []byte("123456789"),
+			wantStatus: database.StatusErr,
+			wantErr:    database.ErrResponseTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewDatabase(
+				zaptest.NewLogger(t),
+				compute.NewCompute(128),
+				&mockStorage{
+					getFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+						return tt.value, nil
+					},
+				},
+				database.WithMaxResponseSize(tt.limit),
+			)
+
+			result := db.Exec(context.Background(), []byte("GET key"))
+
+			assert.Equal(t, tt.wantStatus, result.Status)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, result.Err, tt.wantErr)
+				assert.Contains(t, result.Err.Error(), "GETRANGE", "the error points to a way to read the value")
+				assert.Nil(t, result.Data)
+
+				return
+			}
+
+			require.NoError(t, result.Err)
+			assert.Equal(t, tt.value, result.Data)
+		})
+	}
+}
+
+func TestDatabase_ExecGetRange(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewDatabase(
+		zaptest.NewLogger(t),
+		compute.NewCompute(128),
+		storage.NewStorage(),
+		database.WithMaxResponseSize(8),
+	)
+
+	require.NoError(t, db.Exec(ctx, []byte("SET k 0123456789")).Err)
+	require.ErrorIs(t, db.Exec(ctx, []byte("GET k")).Err, database.ErrResponseTooLarge)
+
+	tests := []struct {
+		query    string
+		wantData string
+	}{
+		{query: "GETRANGE k 0 7", wantData: "01234567"},
+		{query: "GETRANGE k 8 9", wantData: "89"},
+		{query: "GETRANGE k -3 -1", wantData: "789"},
+		{query: "GETRANGE k 5 100", wantData: "56789"},
+		{query: "GETRANGE k -100 2", wantData: "012"},
+		{query: "GETRANGE k 4 3", wantData: ""},
+		{query: "GETRANGE k 10 12", wantData: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result := db.Exec(ctx, []byte(tt.query))
+
+			require.NoError(t, result.Err)
+			assert.Equal(t, database.StatusOK, result.Status)
+			assert.Equal(t, tt.wantData, string(result.Data))
+		})
+	}
+
+	t.Run("range too large", func(t *testing.T) {
+		result := db.Exec(ctx, []byte("GETRANGE k 0 -1"))
+		assert.Equal(t, database.StatusErr, result.Status)
+		require.ErrorIs(t, result.Err, database.ErrResponseTooLarge)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		assert.Equal(t, database.StatusNotFound, db.Exec(ctx, []byte("GETRANGE missing 0 1")).Status)
+	})
+}
+
+type mockCompute struct {
+	parseFn      func([]byte) (compute.Query, error)
+	parseMultiFn func([]byte) ([]compute.Query, error)
+}
+
+func (m *mockCompute) Parse(q []byte) (compute.Query, error) {
+	return m.parseFn(q)
+}
+
+func (m *mockCompute) ParseMulti(q []byte) ([]compute.Query, error) {
+	return m.parseMultiFn(q)
+}
+
+type mockStorage struct {
+	setFunc          func(context.Context, []byte, []byte) error
+	setIfChangedFunc func(context.Context, []byte, []byte) (bool, error)
+	getFunc          func(context.Context, []byte) ([]byte, error)
+	getManyFunc      func(context.Context, [][]byte) ([][]byte, []bool, error)
+	setManyFunc      func(context.Context, []storage.KeyValue) error
+	delFunc          func(context.Context, []byte) (bool, error)
+	delIfFunc        func(context.Context, []byte, []byte) (bool, error)
+
+	getOrSetFunc func(context.Context, []byte, []byte) ([]byte, bool, error)
+
+	setImmutableFunc func(context.Context, []byte, []byte) error
+	unlockFunc       func(context.Context, []byte) (bool, error)
+
+	mapStatsFunc func(context.Context) (storage.MapStats, error)
+	setMaxFunc   func(context.Context, []byte, int64) (int64, bool, error)
+	setMinFunc   func(context.Context, []byte, int64) (int64, bool, error)
+
+	getPrefixFunc func(context.Context, []byte) ([]storage.KeyValue, error)
+	keysFunc      func(context.Context, func([]byte) bool) ([][]byte, error)
+	flushFunc     func(context.Context) error
+	lenFunc       func(context.Context) (int, error)
+	indexGetFunc  func(context.Context, []byte) ([][]byte, error)
+	incrFunc      func(context.Context, []byte, int64) (int64, error)
+	incrExFunc    func(context.Context, []byte, int64, time.Duration) (int64, error)
+	expireFunc    func(context.Context, []byte, time.Duration) (bool, error)
+	ttlFunc       func(context.Context, []byte) (time.Duration, error)
+	rotateFunc    func(context.Context, []byte, []byte, time.Duration) ([]byte, bool, error)
+	appendSepFunc func(context.Context, []byte, []byte, []byte) ([]byte, error)
+}
+
+func (m *mockStorage) Set(ctx context.Context, key, val []byte) error {
+	if m.setFunc == nil {
+		panic("setFunc is nil")
+	}
+	return m.setFunc(ctx, key, val)
+}
+
+func (m *mockStorage) SetIfChanged(ctx context.Context, key, val []byte) (bool, error) {
+	if m.setIfChangedFunc == nil {
+		panic("setIfChangedFunc is nil")
+	}
+	return m.setIfChangedFunc(ctx, key, val)
+}
+
+func (m *mockStorage) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if m.getFunc == nil {
+		panic("getFunc is nil")
+	}
+	return m.getFunc(ctx, key)
+}
+
+func (m *mockStorage) SetMany(ctx context.Context, pairs []storage.KeyValue) error {
+	if m.setManyFunc == nil {
+		panic("setManyFunc is nil")
+	}
+	return m.setManyFunc(ctx, pairs)
+}
+
+func (m *mockStorage) GetMany(ctx context.Context, keys [][]byte) ([][]byte, []bool, error) {
+	if m.getManyFunc == nil {
+		panic("getManyFunc is nil")
+	}
+	return m.getManyFunc(ctx, keys)
+}
+
+func (m *mockStorage) Del(ctx context.Context, key []byte) (bool, error) {
+	if m.delFunc == nil {
+		panic("delFunc is nil")
+	}
+	return m.delFunc(ctx, key)
+}
+
+type mockPublisher struct {
+	events []eventbus.Event
+}
+
+func (m *mockPublisher) Publish(event eventbus.Event) {
+	m.events = append(m.events, event)
+}
+
+func (m *mockStorage) DelIf(ctx context.Context, key, expected []byte) (bool, error) {
+	if m.delIfFunc == nil {
+		panic("delIfFunc is nil")
+	}
+	return m.delIfFunc(ctx, key, expected)
+}
+
+func (m *mockStorage) GetOrSet(ctx context.Context, key, val []byte) ([]byte, bool, error) {
+	if m.getOrSetFunc == nil {
+		panic("getOrSetFunc is nil")
+	}
+	return m.getOrSetFunc(ctx, key, val)
+}
+
+func (m *mockStorage) SetImmutable(ctx context.Context, key, val []byte) error {
+	if m.setImmutableFunc == nil {
+		panic("setImmutableFunc is nil")
+	}
+	return m.setImmutableFunc(ctx, key, val)
+}
+
+func (m *mockStorage) Unlock(ctx context.Context, key []byte) (bool, error) {
+	if m.unlockFunc == nil {
+		panic("unlockFunc is nil")
+	}
+	return m.unlockFunc(ctx, key)
+}
+
+func (m *mockStorage) MapStats(ctx context.Context) (storage.MapStats, error) {
+	if m.mapStatsFunc == nil {
+		panic("mapStatsFunc is nil")
+	}
+	return m.mapStatsFunc(ctx)
+}
+
+func (m *mockStorage) SetMax(ctx context.Context, key []byte, value int64) (int64, bool, error) {
+	if m.setMaxFunc == nil {
+		panic("setMaxFunc is nil")
+	}
+	return m.setMaxFunc(ctx, key, value)
+}
+
+func (m *mockStorage) SetMin(ctx context.Context, key []byte, value int64) (int64, bool, error) {
+	if m.setMinFunc == nil {
+		panic("setMinFunc is nil")
+	}
+	return m.setMinFunc(ctx, key, value)
+}
+
+func (m *mockStorage) GetPrefix(ctx context.Context, prefix []byte) ([]storage.KeyValue, error) {
+	if m.getPrefixFunc == nil {
+		panic("getPrefixFunc is nil")
+	}
+	return m.getPrefixFunc(ctx, prefix)
+}
+
+func (m *mockStorage) IndexGet(ctx context.Context, field []byte) ([][]byte, error) {
+	if m.indexGetFunc == nil {
+		panic("indexGetFunc is nil")
+	}
+	return m.indexGetFunc(ctx, field)
+}
+
+func (m *mockStorage) Keys(ctx context.Context, match func([]byte) bool) ([][]byte, error) {
+	if m.keysFunc == nil {
+		panic("keysFunc is nil")
+	}
+	return m.keysFunc(ctx, match)
+}
+
+func (m *mockStorage) Flush(ctx context.Context) error {
+	if m.flushFunc == nil {
+		panic("flushFunc is nil")
+	}
+	return m.flushFunc(ctx)
+}
+
+func (m *mockStorage) Len(ctx context.Context) (int, error) {
+	if m.lenFunc == nil {
+		panic("lenFunc is nil")
+	}
+	return m.lenFunc(ctx)
+}
+
+func (m *mockStorage) Incr(ctx context.Context, key []byte, delta int64) (int64, error) {
+	if m.incrFunc == nil {
+		panic("incrFunc is nil")
+	}
+	return m.incrFunc(ctx, key, delta)
+}
+
+func (m *mockStorage) IncrEx(ctx context.Context, key []byte, delta int64, ttl time.Duration) (int64, error) {
+	if m.incrExFunc == nil {
+		panic("incrExFunc is nil")
+	}
+	return m.incrExFunc(ctx, key, delta, ttl)
+}
+
+func embedsBaseQuery(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		if ident, ok := field.Type.(*ast.Ident); ok && len(field.Names) == 0 && ident.Name == "baseQuery" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *mockStorage) Expire(ctx context.Context, key []byte, ttl time.Duration) (bool, error) {
+	if m.expireFunc == nil {
+		panic("expireFunc is nil")
+	}
+	return m.expireFunc(ctx, key, ttl)
+}
+
+func (m *mockStorage) TTL(ctx context.Context, key []byte) (time.Duration, error) {
+	if m.ttlFunc == nil {
+		panic("ttlFunc is nil")
+	}
+	return m.ttlFunc(ctx, key)
+}
+
+func (m *mockStorage) Rotate(ctx context.Context, key, val []byte, ttl time.Duration) ([]byte, bool, error) {
+	if m.rotateFunc == nil {
+		panic("rotateFunc is nil")
+	}
+	return m.rotateFunc(ctx, key, val, ttl)
+}
+
+func (m *mockStorage) AppendSep(ctx context.Context, key, val, sep []byte) ([]byte, error) {
+	if m.appendSepFunc == nil {
+		panic("appendSepFunc is nil")
+	}
+	return m.appendSepFunc(ctx, key, val, sep)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func newObservedLogger() (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core)
+
+	return logger, logs
+}
+
+func parsePercentiles(t *testing.T, data []byte) map[string]time.Duration {
+	t.Helper()
+
+	got := make(map[string]time.Duration)
+	for line := range bytes.Lines(data) {
+		name, value, ok := bytes.Cut(bytes.TrimSpace(line), []byte("="))
+		require.True(t, ok, "malformed line %q", line)
+
+		d, err := time.ParseDuration(string(value))
+		require.NoError(t, err)
+		got[string(name)] = d
+	}
+
+	return got
 }
 
 type expectedLog struct {
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeyEncoding controls how keys with bytes that are not printable UTF-8 are written in
+// responses that list keys. Printable keys are always written as they are.
+type KeyEncoding int
+
+const (
+	KeyEncodingRaw KeyEncoding = iota
+	// KeyEncodingHex writes such keys as "hex:" followed by their hex digits.
+	KeyEncodingHex
+	// KeyEncodingBase64 writes such keys as "base64:" followed by their standard base64.
+	KeyEncodingBase64
+)
+
+func (e KeyEncoding) encode(key []byte) []byte {
+	if e == KeyEncodingRaw || printable(key) {
+		return key
+	}
+
+	if e == KeyEncodingHex {
+		return hex.AppendEncode([]byte("hex:"), key)
+	}
+
+	return base64.StdEncoding.AppendEncode([]byte("base64:"), key)
+}
+
+func printable(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if (r == utf8.RuneError && size <= 1) || !unicode.IsPrint(r) {
+			return false
+		}
+
+		b = b[size:]
+	}
+
+	return true
+}
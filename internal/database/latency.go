@@ -0,0 +1,77 @@
+package database
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultLatencyWindow = 1024
+
+type latencyPercentiles struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// latencyWindow keeps the most recent samples in a fixed-size ring so memory stays bounded.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+	full    bool
+	mu      sync.Mutex
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{
+		samples: make([]time.Duration, size),
+		mu:      sync.Mutex{},
+	}
+}
+
+// Record does nothing on a nil window, which is how tracking latency is turned off.
+func (w *latencyWindow) Record(d time.Duration) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples[w.next] = d
+	w.next++
+
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+}
+
+func (w *latencyWindow) Percentiles() latencyPercentiles {
+	w.mu.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	sorted := slices.Clone(w.samples[:n])
+	w.mu.Unlock()
+
+	slices.Sort(sorted)
+
+	return latencyPercentiles{
+		P50: percentile(sorted, 0.50),
+		P95: percentile(sorted, 0.95),
+		P99: percentile(sorted, 0.99),
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p * float64(len(sorted))))
+
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/maxm86545/concurrency_go/internal/database/compute"
+)
+
+type parseErrorStats struct {
+	emptyQuery       atomic.Uint64
+	invalidLen       atomic.Uint64
+	unknownCommand   atomic.Uint64
+	invalidArguments atomic.Uint64
+	other            atomic.Uint64
+}
+
+func (s *parseErrorStats) Record(err error) {
+	switch {
+	case errors.Is(err, compute.ErrEmptyQuery):
+		s.emptyQuery.Add(1)
+	case errors.Is(err, compute.ErrInvalidLen):
+		s.invalidLen.Add(1)
+	case errors.Is(err, compute.ErrUnknownCommand):
+		s.unknownCommand.Add(1)
+	case errors.Is(err, compute.ErrInvalidArguments):
+		s.invalidArguments.Add(1)
+	default:
+		s.other.Add(1)
+	}
+}
+
+func (s *parseErrorStats) Text() []byte {
+	return fmt.Appendf(nil,
+		"empty_query=%d\ninvalid_len=%d\nunknown_command=%d\ninvalid_arguments=%d\nother=%d",
+		s.emptyQuery.Load(),
+		s.invalidLen.Load(),
+		s.unknownCommand.Load(),
+		s.invalidArguments.Load(),
+		s.other.Load(),
+	)
+}
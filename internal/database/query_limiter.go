@@ -0,0 +1,34 @@
+package database
+
+import "github.com/maxm86545/concurrency_go/internal/database/compute"
+
+// queryLimiter caps how many expensive queries run at once; acquire fails instead of waiting.
+type queryLimiter struct {
+	slots chan struct{}
+}
+
+func newQueryLimiter(limit int) *queryLimiter {
+	return &queryLimiter{slots: make(chan struct{}, limit)}
+}
+
+func (l *queryLimiter) TryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *queryLimiter) Release() {
+	<-l.slots
+}
+
+func isExpensive(query compute.Query) bool {
+	switch query.(type) {
+	case *compute.GetPrefixQuery, *compute.FindValueQuery, *compute.KeysQuery:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/maxm86545/concurrency_go/internal/database/compute"
+)
+
+// queryLog writes every query preceded by its timestamp as a "#" comment line,
+// so the output can be fed back through the CLI with comments skipped.
+//
+// Queries from all connections are interleaved, so the log is replayed through a single
+// session. Queries that only set up their own session (DEFAULTTTL, NOREPLY, STATUSLINE) are
+// left out, as that session would apply them to every later query; SETs that relied on a
+// default TTL are therefore replayed without an expiry.
+type queryLog struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func newQueryLog(w io.Writer) *queryLog {
+	return &queryLog{
+		w:  w,
+		mu: sync.Mutex{},
+	}
+}
+
+func (l *queryLog) Write(at time.Time, rawQuery []byte) error {
+	buf := make([]byte, 0, len(rawQuery)+64)
+	buf = appendTimestamp(buf, at)
+	buf = append(buf, '\n')
+	buf = append(buf, rawQuery...)
+	buf = append(buf, '\n')
+
+	return l.write(buf)
+}
+
+// WriteComment appends a "#" line that replaying the log skips.
+func (l *queryLog) WriteComment(at time.Time, comment string) error {
+	buf := make([]byte, 0, len(comment)+64)
+	buf = appendTimestamp(buf, at)
+	buf = append(buf, ' ')
+	buf = append(buf, comment...)
+	buf = append(buf, '\n')
+
+	return l.write(buf)
+}
+
+func (l *queryLog) write(buf []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.w.Write(buf); err != nil {
+		return fmt.Errorf("write query log: %w", err)
+	}
+
+	return nil
+}
+
+// logQuery writes rawQuery to the query log, if there is one, unless query only changes the
+// session; query is nil when rawQuery did not parse.
+func (d *Database) logQuery(at time.Time, rawQuery []byte, query compute.Query) {
+	if d.queryLog == nil || sessionQuery(query) {
+		return
+	}
+
+	if err := d.queryLog.Write(at, rawQuery); err != nil {
+		d.logger.Warn("failed to write query log", zap.Error(err))
+	}
+}
+
+func appendTimestamp(buf []byte, at time.Time) []byte {
+	buf = append(buf, "# "...)
+
+	return at.UTC().AppendFormat(buf, time.RFC3339Nano)
+}
@@ -15,4 +15,7 @@ type ExecResult struct {
 	Status ExecStatus
 	Err    error
 	Data   []byte
+	// NoReply asks for nothing to be sent back; it is set on the SETs and DELs that succeed
+	// in a session with no-reply mode on.
+	NoReply bool
 }
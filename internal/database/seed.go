@@ -0,0 +1,67 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/maxm86545/concurrency_go/internal/database/compute"
+)
+
+var ErrInvalidSeed = errors.New("seed query must be SET")
+
+var seedCommentPrefix = []byte("#")
+
+// Seed replays newline-delimited SET queries from r, skipping blank lines and "#" comments,
+// and returns how many of them were applied. The queries go to the query log like any other.
+func (d *Database) Seed(ctx context.Context, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+
+	loaded := 0
+	for line := 1; scanner.Scan(); line++ {
+		rawQuery := bytes.TrimSpace(scanner.Bytes())
+		if len(rawQuery) == 0 || bytes.HasPrefix(rawQuery, seedCommentPrefix) {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return loaded, err
+		}
+
+		query, err := d.compute.Parse(bytes.Clone(rawQuery))
+		if err != nil {
+			return loaded, fmt.Errorf("seed line %d: parse query: %v", line, err)
+		}
+
+		q, ok := query.(*compute.SetQuery)
+		if !ok {
+			return loaded, fmt.Errorf("seed line %d: %w", line, ErrInvalidSeed)
+		}
+
+		if d.queryLog != nil {
+			if err := d.queryLog.Write(time.Now(), rawQuery); err != nil {
+				d.logger.Warn("failed to write query log", zap.Error(err))
+			}
+		}
+
+		if result := d.execQuery(ctx, q); result.Err != nil {
+			return loaded, fmt.Errorf("seed line %d: %v", line, result.Err)
+		}
+
+		loaded++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return loaded, fmt.Errorf("seed: read: %v", err)
+	}
+
+	d.logger.Info("seed loaded", zap.Int("queries", loaded))
+
+	return loaded, nil
+}
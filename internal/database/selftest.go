@@ -0,0 +1,59 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/maxm86545/concurrency_go/internal/database/storage"
+)
+
+var selfTestKey = []byte("__selftest__")
+
+// SelfTest round-trips a reserved key through storage and checks that the query log accepts
+// writes. It bypasses Exec so nothing is published or recorded as a query. The key is deleted
+// afterwards, so run it before loading data that might hold it.
+func (d *Database) SelfTest(ctx context.Context) error {
+	value := fmt.Appendf(nil, "%d", time.Now().UnixNano())
+
+	if err := d.storage.Set(ctx, selfTestKey, value); err != nil {
+		return fmt.Errorf("self-test: set: %v", err)
+	}
+
+	got, err := d.storage.Get(ctx, selfTestKey)
+	if err != nil {
+		return fmt.Errorf("self-test: get: %v", err)
+	}
+
+	if !bytes.Equal(got, value) {
+		return fmt.Errorf("self-test: get: expected %q, got %q", value, got)
+	}
+
+	ok, err := d.storage.Expire(ctx, selfTestKey, time.Minute)
+	if err != nil || !ok {
+		return fmt.Errorf("self-test: expire: ok=%t, err=%v", ok, err)
+	}
+
+	if ttl, err := d.storage.TTL(ctx, selfTestKey); err != nil || ttl <= 0 {
+		return fmt.Errorf("self-test: ttl: ttl=%s, err=%v", ttl, err)
+	}
+
+	deleted, err := d.storage.Del(ctx, selfTestKey)
+	if err != nil || !deleted {
+		return fmt.Errorf("self-test: del: deleted=%t, err=%v", deleted, err)
+	}
+
+	if _, err := d.storage.Get(ctx, selfTestKey); !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("self-test: get after del: expected not found, got %v", err)
+	}
+
+	if d.queryLog != nil {
+		if err := d.queryLog.WriteComment(time.Now(), "self-test"); err != nil {
+			return fmt.Errorf("self-test: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/maxm86545/concurrency_go/internal/database/compute"
+)
+
+var ErrNoSession = errors.New("no session")
+
+type sessionKey struct{}
+
+// session holds the state a connection sets for its own later queries.
+type session struct {
+	defaultTTL atomic.Int64
+	noReply    atomic.Bool
+	statusLine atomic.Bool
+}
+
+// WithSession returns a context carrying fresh connection-scoped state; every query executed
+// with it shares that state, so each connection should call it once.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// sessionQuery reports whether query only changes the state of its session.
+func sessionQuery(query compute.Query) bool {
+	switch query.(type) {
+	case *compute.DefaultTTLQuery, *compute.NoReplyQuery, *compute.StatusLineQuery:
+		return true
+	default:
+		return false
+	}
+}
+
+func sessionFrom(ctx context.Context) *session {
+	s, _ := ctx.Value(sessionKey{}).(*session)
+
+	return s
+}
+
+// DefaultTTL is the expiry applied to SETs without EX, 0 when there is none.
+func (s *session) DefaultTTL() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return time.Duration(s.defaultTTL.Load())
+}
+
+func (s *session) SetDefaultTTL(ttl time.Duration) {
+	s.defaultTTL.Store(int64(ttl))
+}
+
+// NoReply reports whether successful SETs and DELs go unanswered.
+func (s *session) NoReply() bool {
+	return s != nil && s.noReply.Load()
+}
+
+func (s *session) SetNoReply(noReply bool) {
+	s.noReply.Store(noReply)
+}
+
+// SetNoReply turns no-reply mode of the session in ctx on or off, as NOREPLY does.
+func SetNoReply(ctx context.Context, noReply bool) error {
+	s := sessionFrom(ctx)
+	if s == nil {
+		return ErrNoSession
+	}
+
+	s.SetNoReply(noReply)
+
+	return nil
+}
+
+// StatusLine reports whether answers carry a status line telling values apart from errors.
+func (s *session) StatusLine() bool {
+	return s != nil && s.statusLine.Load()
+}
+
+func (s *session) SetStatusLine(statusLine bool) {
+	s.statusLine.Store(statusLine)
+}
+
+// SetStatusLine turns status lines of the session in ctx on or off, as STATUSLINE does.
+func SetStatusLine(ctx context.Context, statusLine bool) error {
+	s := sessionFrom(ctx)
+	if s == nil {
+		return ErrNoSession
+	}
+
+	s.SetStatusLine(statusLine)
+
+	return nil
+}
+
+// StatusLine reports whether the session in ctx answers with status lines.
+func StatusLine(ctx context.Context) bool {
+	return sessionFrom(ctx).StatusLine()
+}
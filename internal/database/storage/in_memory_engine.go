@@ -1,38 +1,515 @@
 package storage
 
-import "sync"
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
 
 type inMemoryEngine struct {
-	m  map[string][]byte
-	mu sync.Mutex
+	m         map[string][]byte
+	immutable map[string]struct{}
+	expires   map[string]time.Time
+	// index is nil unless Index was called.
+	index *valueIndex
+	// onExpired is nil unless OnExpired was called.
+	onExpired func(key []byte)
+	// peak is the most keys m has held since it was made.
+	peak int
+	mu   sync.Mutex
 }
 
 func newInMemoryEngine(initSize int) *inMemoryEngine {
 	return &inMemoryEngine{
-		m:  make(map[string][]byte, initSize),
-		mu: sync.Mutex{},
+		m:         make(map[string][]byte, initSize),
+		immutable: make(map[string]struct{}),
+		expires:   make(map[string]time.Time),
+		mu:        sync.Mutex{},
 	}
 }
 
-func (e *inMemoryEngine) Set(key []byte, value []byte) {
+func (e *inMemoryEngine) Set(key []byte, value []byte) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.m[string(key)] = value
+	k := string(key)
+	e.evictExpired(k, time.Now())
+
+	if _, ok := e.immutable[k]; ok {
+		return ErrImmutable
+	}
+
+	e.put(k, value)
+	delete(e.expires, k)
+
+	return nil
+}
+
+// SetMany stores every pair under one lock, checking them all first so that a failure leaves
+// the engine untouched; it returns the index of the pair that failed.
+func (e *inMemoryEngine) SetMany(pairs []KeyValue) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	for i, pair := range pairs {
+		k := string(pair.Key)
+		e.evictExpired(k, now)
+
+		if _, ok := e.immutable[k]; ok {
+			return i, ErrImmutable
+		}
+	}
+
+	for _, pair := range pairs {
+		k := string(pair.Key)
+		e.put(k, pair.Value)
+		delete(e.expires, k)
+	}
+
+	return 0, nil
 }
 
 func (e *inMemoryEngine) Get(key []byte) ([]byte, bool) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	value, ok := e.m[string(key)]
+	k := string(key)
+	e.evictExpired(k, time.Now())
+
+	value, ok := e.m[k]
 
 	return value, ok
 }
 
-func (e *inMemoryEngine) Del(key []byte) {
+func (e *inMemoryEngine) GetMany(keys [][]byte) ([][]byte, []bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	values := make([][]byte, len(keys))
+	found := make([]bool, len(keys))
+
+	for i, key := range keys {
+		k := string(key)
+		e.evictExpired(k, now)
+
+		values[i], found[i] = e.m[k]
+	}
+
+	return values, found
+}
+
+func (e *inMemoryEngine) Del(key []byte) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := string(key)
+	e.evictExpired(k, time.Now())
+
+	if _, ok := e.immutable[k]; ok {
+		return false, ErrImmutable
+	}
+
+	if _, ok := e.m[k]; !ok {
+		return false, nil
+	}
+
+	e.remove(k)
+
+	return true, nil
+}
+
+func (e *inMemoryEngine) SetImmutable(key []byte, value []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := string(key)
+	e.evictExpired(k, time.Now())
+
+	if _, ok := e.immutable[k]; ok {
+		return ErrImmutable
+	}
+
+	e.put(k, value)
+	e.immutable[k] = struct{}{}
+	delete(e.expires, k)
+
+	return nil
+}
+
+func (e *inMemoryEngine) Unlock(key []byte) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := string(key)
+	e.evictExpired(k, time.Now())
+
+	if _, ok := e.immutable[k]; !ok {
+		return false
+	}
+
+	delete(e.immutable, k)
+
+	return true
+}
+
+func (e *inMemoryEngine) MapStats() MapStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return MapStats{
+		Len:       len(e.m),
+		Immutable: len(e.immutable),
+		Capacity:  e.peak,
+	}
+}
+
+// Len counts the keys, leaving out expired ones the sweeper has not reclaimed yet.
+func (e *inMemoryEngine) Len() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	n := len(e.m)
+	for k := range e.expires {
+		if e.expired(k, now) {
+			n--
+		}
+	}
+
+	return n
+}
+
+func (e *inMemoryEngine) ScanPrefix(prefix []byte) []KeyValue {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	var result []KeyValue
+	for k, value := range e.m {
+		if strings.HasPrefix(k, string(prefix)) && !e.expired(k, now) {
+			result = append(result, KeyValue{Key: []byte(k), Value: value})
+		}
+	}
+
+	slices.SortFunc(result, func(a, b KeyValue) int {
+		return bytes.Compare(a.Key, b.Key)
+	})
+
+	return result
+}
+
+// Keys returns the keys match accepts, sorted. match runs for every key under e.mu, so on a
+// large map it stalls writers for the whole pass; copying the keys out first would shorten the
+// lock at the cost of allocating them all.
+func (e *inMemoryEngine) Keys(match func(key []byte) bool) [][]byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	var result [][]byte
+	for k := range e.m {
+		if e.expired(k, now) {
+			continue
+		}
+
+		if key := []byte(k); match(key) {
+			result = append(result, key)
+		}
+	}
+
+	slices.SortFunc(result, bytes.Compare)
+
+	return result
+}
+
+func (e *inMemoryEngine) Update(key []byte, fn UpdateFunc) error {
+	return e.update(key, fn, time.Time{})
+}
+
+// UpdateExpire is Update that gives a key it creates the expiry at; a key that already
+// existed keeps its own.
+func (e *inMemoryEngine) UpdateExpire(key []byte, fn UpdateFunc, at time.Time) error {
+	return e.update(key, fn, at)
+}
+
+func (e *inMemoryEngine) update(key []byte, fn UpdateFunc, at time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := string(key)
+	e.evictExpired(k, time.Now())
+
+	old, existed := e.m[k]
+
+	value, action := fn(old, existed)
+	if action == UpdateKeep {
+		return nil
+	}
+
+	if _, ok := e.immutable[k]; ok {
+		return ErrImmutable
+	}
+
+	if action == UpdateKeepMutable {
+		return nil
+	}
+
+	if action == UpdateDelete {
+		e.remove(k)
+
+		return nil
+	}
+
+	e.put(k, value)
+	if action == UpdatePersist {
+		delete(e.expires, k)
+	} else if !existed && !at.IsZero() {
+		e.expires[k] = at
+	}
+
+	return nil
+}
+
+func (e *inMemoryEngine) Expire(key []byte, at time.Time) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := string(key)
+	e.evictExpired(k, time.Now())
+
+	if _, ok := e.m[k]; !ok {
+		return false, nil
+	}
+
+	if _, ok := e.immutable[k]; ok {
+		return false, ErrImmutable
+	}
+
+	e.expires[k] = at
+
+	return true, nil
+}
+
+func (e *inMemoryEngine) TTL(key []byte) (time.Duration, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := string(key)
+	now := time.Now()
+	e.evictExpired(k, now)
+
+	if _, ok := e.m[k]; !ok {
+		return 0, false
+	}
+
+	at, ok := e.expires[k]
+	if !ok {
+		return NoExpiry, true
+	}
+
+	return at.Sub(now), true
+}
+
+func (e *inMemoryEngine) Sweep() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	swept := 0
+	for k := range e.expires {
+		if e.evictExpired(k, now) {
+			swept++
+		}
+	}
+
+	return swept
+}
+
+func (e *inMemoryEngine) Swap(key []byte, value []byte, at time.Time) ([]byte, bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	k := string(key)
+	e.evictExpired(k, time.Now())
+
+	if _, ok := e.immutable[k]; ok {
+		return nil, false, ErrImmutable
+	}
+
+	old, existed := e.m[k]
+	e.put(k, value)
+	e.expires[k] = at
+
+	return old, existed, nil
+}
+
+func (e *inMemoryEngine) Entries() []Entry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	entries := make([]Entry, 0, len(e.m))
+	for k, value := range e.m {
+		if e.expired(k, now) {
+			continue
+		}
+
+		_, immutable := e.immutable[k]
+		entries = append(entries, Entry{
+			Key:       []byte(k),
+			Value:     value,
+			Immutable: immutable,
+			ExpiresAt: e.expires[k],
+		})
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return bytes.Compare(a.Key, b.Key)
+	})
+
+	return entries
+}
+
+// Flush drops every key, immutable ones included.
+func (e *inMemoryEngine) Flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.m = make(map[string][]byte, initSize)
+	e.immutable = make(map[string]struct{})
+	e.expires = make(map[string]time.Time)
+	e.peak = 0
+
+	if e.index != nil {
+		e.index = newValueIndex(e.index.prefix, e.m)
+	}
+}
+
+// Restore replaces the whole contents of the engine with entries; it never fails.
+func (e *inMemoryEngine) Restore(entries []Entry) error {
+	m := make(map[string][]byte, max(len(entries), initSize))
+	immutable := make(map[string]struct{})
+	expires := make(map[string]time.Time)
+
+	for _, entry := range entries {
+		k := string(entry.Key)
+		m[k] = bytes.Clone(entry.Value)
+
+		if entry.Immutable {
+			immutable[k] = struct{}{}
+		}
+
+		if !entry.ExpiresAt.IsZero() {
+			expires[k] = entry.ExpiresAt
+		}
+	}
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	delete(e.m, string(key))
+	e.m = m
+	e.immutable = immutable
+	e.expires = expires
+	e.peak = len(m)
+
+	if e.index != nil {
+		e.index = newValueIndex(e.index.prefix, e.m)
+	}
+
+	return nil
+}
+
+// Index starts indexing the keys that start with prefix by their value, replacing any index
+// set before.
+func (e *inMemoryEngine) Index(prefix []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.index = newValueIndex(string(prefix), e.m)
+}
+
+// IndexGet returns the indexed keys whose value is field, sorted; ok is false when nothing is
+// indexed.
+func (e *inMemoryEngine) IndexGet(field []byte) (keys [][]byte, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.index == nil {
+		return nil, false
+	}
+
+	now := time.Now()
+
+	for k := range e.index.keys[string(field)] {
+		if !e.expired(k, now) {
+			keys = append(keys, []byte(k))
+		}
+	}
+
+	slices.SortFunc(keys, bytes.Compare)
+
+	return keys, true
+}
+
+// OnExpired makes evictions of expired keys call fn, replacing any function set before.
+func (e *inMemoryEngine) OnExpired(fn func(key []byte)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.onExpired = fn
+}
+
+func (e *inMemoryEngine) expired(k string, now time.Time) bool {
+	at, ok := e.expires[k]
+
+	return ok && !now.Before(at)
+}
+
+// evictExpired removes k if its expiry has passed; the caller must hold e.mu.
+func (e *inMemoryEngine) evictExpired(k string, now time.Time) bool {
+	if !e.expired(k, now) {
+		return false
+	}
+
+	e.remove(k)
+
+	if e.onExpired != nil {
+		e.onExpired([]byte(k))
+	}
+
+	return true
+}
+
+// put stores value under k, keeping the index in step; the caller must hold e.mu.
+func (e *inMemoryEngine) put(k string, value []byte) {
+	if e.index != nil {
+		if old, ok := e.m[k]; ok {
+			e.index.remove(k, old)
+		}
+
+		e.index.add(k, value)
+	}
+
+	e.m[k] = bytes.Clone(value)
+	e.peak = max(e.peak, len(e.m))
+}
+
+// remove deletes k along with its expiry and index entry; the caller must hold e.mu.
+func (e *inMemoryEngine) remove(k string) {
+	if old, ok := e.m[k]; ok && e.index != nil {
+		e.index.remove(k, old)
+	}
+
+	delete(e.m, k)
+	delete(e.expires, k)
 }
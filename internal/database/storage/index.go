@@ -0,0 +1,54 @@
+package storage
+
+import "strings"
+
+// valueIndex maps the values of the keys starting with prefix to those keys. The engine keeps
+// it in step with its map under the same lock.
+type valueIndex struct {
+	prefix string
+	keys   map[string]map[string]struct{}
+}
+
+func newValueIndex(prefix string, m map[string][]byte) *valueIndex {
+	idx := &valueIndex{
+		prefix: prefix,
+		keys:   make(map[string]map[string]struct{}),
+	}
+
+	for k, value := range m {
+		idx.add(k, value)
+	}
+
+	return idx
+}
+
+func (idx *valueIndex) add(k string, value []byte) {
+	if !strings.HasPrefix(k, idx.prefix) {
+		return
+	}
+
+	field := string(value)
+
+	set, ok := idx.keys[field]
+	if !ok {
+		set = make(map[string]struct{})
+		idx.keys[field] = set
+	}
+
+	set[k] = struct{}{}
+}
+
+func (idx *valueIndex) remove(k string, value []byte) {
+	if !strings.HasPrefix(k, idx.prefix) {
+		return
+	}
+
+	field := string(value)
+
+	set := idx.keys[field]
+	delete(set, k)
+
+	if len(set) == 0 {
+		delete(idx.keys, field)
+	}
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// A snapshot is the magic, a version byte and the entry count, followed by the entries and a
+// CRC-32 (IEEE) of everything before it. Each entry is a flags byte, the expiry in Unix
+// nanoseconds if flagExpires is set, then the key and the value, each prefixed by its length.
+// Integers are varints.
+const (
+	snapshotMagic            = "KVSS"
+	snapshotVersion     byte = 1
+	snapshotChecksumLen      = crc32.Size
+)
+
+const (
+	flagImmutable byte = 1 << iota
+	flagExpires
+)
+
+var ErrInvalidSnapshot = errors.New("storage: invalid snapshot")
+
+// Snapshot writes every live key, with its immutability and expiry, to w. The entries are read
+// under a single engine lock, so the snapshot is consistent.
+func (s *Storage) Snapshot(w io.Writer) error {
+	entries := s.engine.Entries()
+
+	checksum := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, checksum))
+
+	buf := append([]byte(snapshotMagic), snapshotVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		buf = appendEntry(buf[:0], entry)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := w.Write(checksum.Sum(nil))
+
+	return err
+}
+
+// LoadSnapshot replaces the contents of the storage with a snapshot written by Snapshot,
+// dropping the keys that have expired since. Nothing changes if the snapshot is invalid.
+func (s *Storage) LoadSnapshot(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	entries, err := parseSnapshot(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	now := time.Now()
+	live := entries[:0]
+	for _, entry := range entries {
+		if entry.ExpiresAt.IsZero() || now.Before(entry.ExpiresAt) {
+			live = append(live, entry)
+		}
+	}
+
+	return s.engine.Restore(live)
+}
+
+func appendEntry(buf []byte, entry Entry) []byte {
+	var flags byte
+	if entry.Immutable {
+		flags |= flagImmutable
+	}
+
+	if !entry.ExpiresAt.IsZero() {
+		flags |= flagExpires
+	}
+
+	buf = append(buf, flags)
+	if !entry.ExpiresAt.IsZero() {
+		buf = binary.AppendVarint(buf, entry.ExpiresAt.UnixNano())
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(entry.Key)))
+	buf = append(buf, entry.Key...)
+	buf = binary.AppendUvarint(buf, uint64(len(entry.Value)))
+
+	return append(buf, entry.Value...)
+}
+
+func parseSnapshot(data []byte) ([]Entry, error) {
+	headerLen := len(snapshotMagic) + 1
+	if len(data) < headerLen+snapshotChecksumLen {
+		return nil, errors.New("too short")
+	}
+
+	body, sum := data[:len(data)-snapshotChecksumLen], data[len(data)-snapshotChecksumLen:]
+	if !bytes.Equal(body[:len(snapshotMagic)], []byte(snapshotMagic)) {
+		return nil, errors.New("not a snapshot")
+	}
+
+	if version := body[len(snapshotMagic)]; version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	r := bytes.NewReader(body[headerLen:])
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("entry count: %w", err)
+	}
+
+	// Every entry takes at least three bytes, which bounds the allocation below.
+	if count > uint64(r.Len()/3) {
+		return nil, fmt.Errorf("entry count %d exceeds the snapshot size", count)
+	}
+
+	entries := make([]Entry, 0, count)
+	for i := range count {
+		entry, err := readEntry(r)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes", r.Len())
+	}
+
+	return entries, nil
+}
+
+func readEntry(r *bytes.Reader) (Entry, error) {
+	flags, err := r.ReadByte()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{Immutable: flags&flagImmutable != 0}
+
+	if flags&flagExpires != 0 {
+		at, err := binary.ReadVarint(r)
+		if err != nil {
+			return Entry{}, fmt.Errorf("expiry: %w", err)
+		}
+
+		entry.ExpiresAt = time.Unix(0, at)
+	}
+
+	if entry.Key, err = readBytes(r); err != nil {
+		return Entry{}, fmt.Errorf("key: %w", err)
+	}
+
+	if entry.Value, err = readBytes(r); err != nil {
+		return Entry{}, fmt.Errorf("value: %w", err)
+	}
+
+	return entry, nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+
+	return b, err
+}
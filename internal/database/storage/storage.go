@@ -1,48 +1,240 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
 )
 
 const initSize = 1024
 
-var ErrNotFound = errors.New("storage: not found")
+// NoExpiry is the TTL reported for a key that never expires.
+const NoExpiry time.Duration = -1
+
+var (
+	ErrNotFound        = errors.New("storage: not found")
+	ErrInvalidEncoding = errors.New("storage: invalid encoding")
+	ErrImmutable       = errors.New("storage: key is immutable")
+	ErrNotInteger      = errors.New("storage: value is not an integer")
+	ErrOverflow        = errors.New("storage: integer overflow")
+	ErrTTLTooLong      = errors.New("storage: ttl exceeds the maximum")
+	ErrNoIndex         = errors.New("storage: no index")
+)
 
 type iEngine interface {
-	Set(key []byte, value []byte)
+	Set(key []byte, value []byte) error
+	SetMany(pairs []KeyValue) (int, error)
 	Get(key []byte) ([]byte, bool)
-	Del(key []byte)
+	GetMany(keys [][]byte) ([][]byte, []bool)
+	Del(key []byte) (bool, error)
+	SetImmutable(key []byte, value []byte) error
+	Unlock(key []byte) bool
+	MapStats() MapStats
+	Len() int
+	Update(key []byte, fn UpdateFunc) error
+	UpdateExpire(key []byte, fn UpdateFunc, at time.Time) error
+	ScanPrefix(prefix []byte) []KeyValue
+	Keys(match func(key []byte) bool) [][]byte
+	Expire(key []byte, at time.Time) (bool, error)
+	TTL(key []byte) (time.Duration, bool)
+	Sweep() int
+	Swap(key []byte, value []byte, at time.Time) ([]byte, bool, error)
+	Entries() []Entry
+	Restore(entries []Entry) error
+	Flush()
+	Index(prefix []byte)
+	IndexGet(field []byte) ([][]byte, bool)
+	OnExpired(fn func(key []byte))
+}
+
+// UpdateFunc receives the current value under the engine lock and returns the new value
+// together with what the engine should do with the key.
+type UpdateFunc func(old []byte, existed bool) ([]byte, UpdateAction)
+
+type UpdateAction int
+
+const (
+	UpdateKeep UpdateAction = iota
+	UpdateStore
+	UpdateDelete
+	// UpdateKeepMutable leaves the key as it is like UpdateKeep, but still fails with
+	// ErrImmutable on an immutable key, for writes that turn out not to change anything.
+	UpdateKeepMutable
+	// UpdatePersist stores the value like UpdateStore and also drops the key's expiry, as Set
+	// does.
+	UpdatePersist
+)
+
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Entry is a key with everything the engine knows about it; ExpiresAt is zero for keys that
+// never expire.
+type Entry struct {
+	Key       []byte
+	Value     []byte
+	Immutable bool
+	ExpiresAt time.Time
+}
+
+type MaxTTLPolicy int
+
+const (
+	MaxTTLClamp MaxTTLPolicy = iota
+	MaxTTLReject
+)
+
+type MapStats struct {
+	Len       int
+	Immutable int
+	// Capacity estimates the room the map holds as the most keys it has had since it was last
+	// rebuilt by Flush or a restore: Go maps do not shrink when keys are deleted.
+	Capacity int
 }
 
 type Storage struct {
-	engine iEngine
+	engine       iEngine
+	checkContext bool
+
+	maxTTL       time.Duration
+	maxTTLPolicy MaxTTLPolicy
+
+	sweepInterval time.Duration
+	stopSweep     chan struct{}
+	sweepDone     chan struct{}
+	closeOnce     sync.Once
 }
 
-func NewStorage() *Storage {
-	return &Storage{
-		engine: newInMemoryEngine(initSize),
+type Option func(s *Storage)
+
+func NewStorage(opts ...Option) *Storage {
+	return NewStorageWithEngine(newInMemoryEngine(initSize), opts...)
+}
+
+func NewStorageWithEngine(engine iEngine, opts ...Option) *Storage {
+	s := &Storage{
+		engine:       engine,
+		checkContext: true,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.sweepInterval > 0 {
+		s.stopSweep = make(chan struct{})
+		s.sweepDone = make(chan struct{})
+
+		go s.sweep()
 	}
+
+	return s
 }
 
-func NewStorageWithEngine(engine iEngine) *Storage {
-	return &Storage{
-		engine: engine,
+// WithValidator makes every write of a key or value, snapshots loaded included, fail with
+// ErrInvalidEncoding unless valid accepts both.
+func WithValidator(valid func(b []byte) bool) Option {
+	return func(s *Storage) {
+		s.engine = newValidatingEngine(s.engine, valid)
+	}
+}
+
+func WithoutContextChecks() Option {
+	return func(s *Storage) {
+		s.checkContext = false
+	}
+}
+
+// WithSweepInterval starts a background goroutine that deletes expired keys at the given
+// interval until Close is called. Expired keys are never returned either way.
+func WithSweepInterval(interval time.Duration) Option {
+	return func(s *Storage) {
+		s.sweepInterval = interval
+	}
+}
+
+// WithMaxTTL bounds the TTLs given to Expire and Rotate: longer ones are shortened to max or
+// fail with ErrTTLTooLong, depending on policy. A max of 0 disables the limit.
+func WithMaxTTL(limit time.Duration, policy MaxTTLPolicy) Option {
+	return func(s *Storage) {
+		s.maxTTL = limit
+		s.maxTTLPolicy = policy
+	}
+}
+
+// WithIndex indexes the keys starting with prefix by their value, for IndexGet. Every write
+// keeps the index up to date under the engine lock.
+func WithIndex(prefix []byte) Option {
+	return func(s *Storage) {
+		s.engine.Index(prefix)
+	}
+}
+
+// WithExpiredHook calls fn with every key dropped because its TTL passed, whether the sweeper
+// or a later access found it. fn runs under the engine lock, so it must not use the storage.
+func WithExpiredHook(fn func(key []byte)) Option {
+	return func(s *Storage) {
+		s.engine.OnExpired(fn)
 	}
 }
 
 func (s *Storage) Set(ctx context.Context, key []byte, value []byte) error {
-	if err := ctx.Err(); err != nil {
+	if err := s.ctxErr(ctx); err != nil {
 		return err
 	}
 
-	s.engine.Set(key, value)
+	return s.engine.Set(key, value)
+}
+
+// SetMany stores every pair or, when one of them cannot be stored, none of them. The error
+// names the key of the first pair that failed.
+func (s *Storage) SetMany(ctx context.Context, pairs []KeyValue) error {
+	if err := s.ctxErr(ctx); err != nil {
+		return err
+	}
+
+	if i, err := s.engine.SetMany(pairs); err != nil {
+		return fmt.Errorf("key %q: %w", pairs[i].Key, err)
+	}
 
 	return nil
 }
 
+// SetIfChanged is Set that reports whether the value changed. Like Set it drops the key's
+// expiry, even when the value stays the same.
+func (s *Storage) SetIfChanged(ctx context.Context, key []byte, value []byte) (bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return false, err
+	}
+
+	var stored bool
+
+	err := s.engine.Update(key, func(old []byte, existed bool) ([]byte, UpdateAction) {
+		if existed && bytes.Equal(old, value) {
+			// Stored again all the same so the key loses its expiry, as with Set.
+			return old, UpdatePersist
+		}
+
+		stored = true
+
+		return value, UpdatePersist
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return stored, nil
+}
+
 func (s *Storage) Get(ctx context.Context, key []byte) ([]byte, error) {
-	if err := ctx.Err(); err != nil {
+	if err := s.ctxErr(ctx); err != nil {
 		return nil, err
 	}
 
@@ -54,12 +246,396 @@ func (s *Storage) Get(ctx context.Context, key []byte) ([]byte, error) {
 	return value, nil
 }
 
-func (s *Storage) Del(ctx context.Context, key []byte) error {
-	if err := ctx.Err(); err != nil {
+// GetMany reads all keys under a single engine lock; found[i] reports whether keys[i] exists.
+func (s *Storage) GetMany(ctx context.Context, keys [][]byte) ([][]byte, []bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	values, found := s.engine.GetMany(keys)
+
+	return values, found, nil
+}
+
+func (s *Storage) Del(ctx context.Context, key []byte) (bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return false, err
+	}
+
+	return s.engine.Del(key)
+}
+
+func (s *Storage) DelIf(ctx context.Context, key []byte, expected []byte) (bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return false, err
+	}
+
+	var deleted bool
+
+	err := s.engine.Update(key, func(old []byte, existed bool) ([]byte, UpdateAction) {
+		if !existed || !bytes.Equal(old, expected) {
+			return nil, UpdateKeep
+		}
+
+		deleted = true
+
+		return nil, UpdateDelete
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+func (s *Storage) GetOrSet(ctx context.Context, key []byte, value []byte) ([]byte, bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return nil, false, err
+	}
+
+	var (
+		actual []byte
+		loaded bool
+	)
+
+	err := s.engine.Update(key, func(old []byte, existed bool) ([]byte, UpdateAction) {
+		if existed {
+			actual, loaded = old, true
+
+			return nil, UpdateKeep
+		}
+
+		actual = value
+
+		return value, UpdateStore
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return actual, loaded, nil
+}
+
+func (s *Storage) SetImmutable(ctx context.Context, key []byte, value []byte) error {
+	if err := s.ctxErr(ctx); err != nil {
 		return err
 	}
 
-	s.engine.Del(key)
+	return s.engine.SetImmutable(key, value)
+}
+
+func (s *Storage) Unlock(ctx context.Context, key []byte) (bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return false, err
+	}
+
+	return s.engine.Unlock(key), nil
+}
+
+func (s *Storage) MapStats(ctx context.Context) (MapStats, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return MapStats{}, err
+	}
+
+	return s.engine.MapStats(), nil
+}
+
+func (s *Storage) SetMax(ctx context.Context, key []byte, value int64) (int64, bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return 0, false, err
+	}
+
+	return s.setIf(key, value, func(candidate, current int64) bool {
+		return candidate > current
+	})
+}
+
+func (s *Storage) SetMin(ctx context.Context, key []byte, value int64) (int64, bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return 0, false, err
+	}
+
+	return s.setIf(key, value, func(candidate, current int64) bool {
+		return candidate < current
+	})
+}
+
+func (s *Storage) Incr(ctx context.Context, key []byte, delta int64) (int64, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return 0, err
+	}
+
+	return incr(delta, func(fn UpdateFunc) error {
+		return s.engine.Update(key, fn)
+	})
+}
+
+// IncrEx is Incr that makes a key it creates expire after ttl; the expiry of a key that
+// already existed is left alone, which makes a fixed-window counter.
+func (s *Storage) IncrEx(ctx context.Context, key []byte, delta int64, ttl time.Duration) (int64, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return 0, err
+	}
+
+	ttl, err := s.limitTTL(ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	at := time.Now().Add(ttl)
+
+	return incr(delta, func(fn UpdateFunc) error {
+		return s.engine.UpdateExpire(key, fn, at)
+	})
+}
+
+// incr adds delta to the integer value through update, starting from 0 for a missing key.
+func incr(delta int64, update func(fn UpdateFunc) error) (int64, error) {
+	var (
+		result  int64
+		incrErr error
+	)
+
+	err := update(func(old []byte, existed bool) ([]byte, UpdateAction) {
+		var current int64
+		if existed {
+			v, err := strconv.ParseInt(string(old), 10, 64)
+			if err != nil {
+				incrErr = ErrNotInteger
+
+				return nil, UpdateKeep
+			}
+
+			current = v
+		}
+
+		if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+			incrErr = ErrOverflow
+
+			return nil, UpdateKeep
+		}
+
+		result = current + delta
+
+		return strconv.AppendInt(nil, result, 10), UpdateStore
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if incrErr != nil {
+		return 0, incrErr
+	}
+
+	return result, nil
+}
+
+// AppendSep appends value to the current value, separated by sep unless the current value is
+// missing or empty, and returns the new value.
+func (s *Storage) AppendSep(ctx context.Context, key []byte, value []byte, sep []byte) ([]byte, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return nil, err
+	}
+
+	var result []byte
+
+	err := s.engine.Update(key, func(old []byte, _ bool) ([]byte, UpdateAction) {
+		result = make([]byte, 0, len(old)+len(sep)+len(value))
+		result = append(result, old...)
+		if len(old) > 0 {
+			result = append(result, sep...)
+		}
+
+		result = append(result, value...)
+
+		return result, UpdateStore
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *Storage) Update(ctx context.Context, key []byte, fn UpdateFunc) error {
+	if err := s.ctxErr(ctx); err != nil {
+		return err
+	}
+
+	return s.engine.Update(key, fn)
+}
+
+func (s *Storage) Len(ctx context.Context) (int, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return 0, err
+	}
+
+	return s.engine.Len(), nil
+}
+
+func (s *Storage) GetPrefix(ctx context.Context, prefix []byte) ([]KeyValue, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.engine.ScanPrefix(prefix), nil
+}
+
+func (s *Storage) Keys(ctx context.Context, match func(key []byte) bool) ([][]byte, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.engine.Keys(match), nil
+}
+
+// IndexGet returns the indexed keys whose value is field, sorted. It fails with ErrNoIndex
+// unless the Storage was created WithIndex.
+func (s *Storage) IndexGet(ctx context.Context, field []byte) ([][]byte, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return nil, err
+	}
+
+	keys, ok := s.engine.IndexGet(field)
+	if !ok {
+		return nil, ErrNoIndex
+	}
+
+	return keys, nil
+}
+
+// Flush deletes every key, immutable ones included.
+func (s *Storage) Flush(ctx context.Context) error {
+	if err := s.ctxErr(ctx); err != nil {
+		return err
+	}
+
+	s.engine.Flush()
+
+	return nil
+}
+
+func (s *Storage) Expire(ctx context.Context, key []byte, ttl time.Duration) (bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return false, err
+	}
+
+	ttl, err := s.limitTTL(ttl)
+	if err != nil {
+		return false, err
+	}
+
+	return s.engine.Expire(key, time.Now().Add(ttl))
+}
+
+func (s *Storage) TTL(ctx context.Context, key []byte) (time.Duration, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return 0, err
+	}
+
+	ttl, ok := s.engine.TTL(key)
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return ttl, nil
+}
+
+// Rotate stores value with a TTL and returns the value it replaced, in one engine step.
+func (s *Storage) Rotate(ctx context.Context, key []byte, value []byte, ttl time.Duration) ([]byte, bool, error) {
+	if err := s.ctxErr(ctx); err != nil {
+		return nil, false, err
+	}
+
+	ttl, err := s.limitTTL(ttl)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return s.engine.Swap(key, value, time.Now().Add(ttl))
+}
+
+func (s *Storage) Close() error {
+	s.closeOnce.Do(func() {
+		if s.stopSweep != nil {
+			close(s.stopSweep)
+			<-s.sweepDone
+		}
+	})
 
 	return nil
 }
+
+func (s *Storage) sweep() {
+	defer close(s.sweepDone)
+
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.engine.Sweep()
+		case <-s.stopSweep:
+			return
+		}
+	}
+}
+
+func (s *Storage) setIf(key []byte, value int64, replace func(candidate, current int64) bool) (int64, bool, error) {
+	var (
+		result   int64
+		stored   bool
+		parseErr error
+	)
+
+	err := s.engine.Update(key, func(old []byte, existed bool) ([]byte, UpdateAction) {
+		if existed {
+			current, err := strconv.ParseInt(string(old), 10, 64)
+			if err != nil {
+				parseErr = ErrNotInteger
+
+				return nil, UpdateKeepMutable
+			}
+
+			if !replace(value, current) {
+				result = current
+
+				return nil, UpdateKeepMutable
+			}
+		}
+
+		result, stored = value, true
+
+		return strconv.AppendInt(nil, value, 10), UpdateStore
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	if parseErr != nil {
+		return 0, false, parseErr
+	}
+
+	return result, stored, nil
+}
+
+func (s *Storage) limitTTL(ttl time.Duration) (time.Duration, error) {
+	if s.maxTTL <= 0 || ttl <= s.maxTTL {
+		return ttl, nil
+	}
+
+	if s.maxTTLPolicy == MaxTTLReject {
+		return 0, ErrTTLTooLong
+	}
+
+	return s.maxTTL, nil
+}
+
+func (s *Storage) ctxErr(ctx context.Context) error {
+	if !s.checkContext {
+		return nil
+	}
+
+	return ctx.Err()
+}
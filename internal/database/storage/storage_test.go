@@ -3,10 +3,16 @@ package storage_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -48,7 +54,8 @@ func TestStorageOperations(t *testing.T) {
 			name:  "Del missing key",
 			setup: func(_ *storage.Storage) {},
 			action: func(s *storage.Storage) ([]byte, error) {
-				err := s.Del(context.Background(), []byte("ghost"))
+				deleted, err := s.Del(context.Background(), []byte("ghost"))
+				assert.False(t, deleted)
 				return nil, err
 			},
 			want:    nil,
@@ -58,7 +65,7 @@ func TestStorageOperations(t *testing.T) {
 			name: "Del removes key",
 			setup: func(s *storage.Storage) {
 				_ = s.Set(context.Background(), []byte("key"), []byte("value"))
-				_ = s.Del(context.Background(), []byte("key"))
+				_, _ = s.Del(context.Background(), []byte("key"))
 			},
 			action: func(s *storage.Storage) ([]byte, error) {
 				return s.Get(context.Background(), []byte("key"))
@@ -161,6 +168,1237 @@ func TestConcurrentSetGet(t *testing.T) {
 	})
 }
 
+func TestSetMany(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage(storage.WithValidator(utf8.Valid))
+
+	require.NoError(t, s.Set(ctx, []byte("a"), []byte("old")))
+	_, err := s.Expire(ctx, []byte("a"), time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("v")))
+
+	pairs := []storage.KeyValue{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte("b"), Value: []byte("2")},
+	}
+	require.NoError(t, s.SetMany(ctx, pairs))
+
+	values, found, err := s.GetMany(ctx, [][]byte{[]byte("a"), []byte("b")})
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, found)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, values)
+
+	ttl, err := s.TTL(ctx, []byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.NoExpiry, ttl, "a stored pair loses its expiry like a SET")
+
+	failing := []struct {
+		name    string
+		pairs   []storage.KeyValue
+		wantErr error
+	}{
+		{
+			name:    "immutable key",
+			pairs:   []storage.KeyValue{{Key: []byte("c"), Value: []byte("3")}, {Key: []byte("locked"), Value: []byte("x")}},
+			wantErr: storage.ErrImmutable,
+		},
+		{
+			name:    "invalid value",
+			pairs:   []storage.KeyValue{{Key: []byte("c"), Value: []byte("3")}, {Key: []byte("d"), Value: []byte{0xff}}},
+			wantErr: storage.ErrInvalidEncoding,
+		},
+	}
+
+	for _, tt := range failing {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, s.SetMany(ctx, tt.pairs), tt.wantErr)
+
+			_, err := s.Get(ctx, []byte("c"))
+			require.ErrorIs(t, err, storage.ErrNotFound, "no pair is stored when one fails")
+		})
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	value, loaded, err := s.GetOrSet(ctx, []byte("key"), []byte("first"))
+	require.NoError(t, err)
+	assert.False(t, loaded)
+	assert.Equal(t, []byte("first"), value)
+
+	value, loaded, err = s.GetOrSet(ctx, []byte("key"), []byte("second"))
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, []byte("first"), value)
+
+	value, err = s.Get(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), value)
+}
+
+func TestConcurrentGetOrSet(t *testing.T) {
+	const workers = 100
+
+	s := storage.NewStorage()
+	ctx := context.Background()
+
+	var (
+		wg      sync.WaitGroup
+		writes  atomic.Int64
+		results = make([][]byte, workers)
+	)
+
+	runConcurrent(workers, &wg, func(i int) {
+		_, val := generateKV(i)
+		result, loaded, err := s.GetOrSet(ctx, []byte("shared"), val)
+		assert.NoError(t, err)
+
+		if !loaded {
+			writes.Add(1)
+		}
+		results[i] = result
+	})
+
+	assert.Equal(t, int64(1), writes.Load(), "exactly one write expected")
+	for _, result := range results {
+		assert.Equal(t, results[0], result)
+	}
+}
+
+func TestImmutable(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	require.NoError(t, s.Set(ctx, []byte("key"), []byte("mutable")))
+	require.NoError(t, s.SetImmutable(ctx, []byte("key"), []byte("locked")))
+
+	require.ErrorIs(t, s.Set(ctx, []byte("key"), []byte("other")), storage.ErrImmutable)
+	require.ErrorIs(t, s.SetImmutable(ctx, []byte("key"), []byte("other")), storage.ErrImmutable)
+
+	deleted, err := s.Del(ctx, []byte("key"))
+	require.ErrorIs(t, err, storage.ErrImmutable)
+	assert.False(t, deleted)
+
+	value, _, err := s.GetOrSet(ctx, []byte("key"), []byte("other"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("locked"), value)
+
+	value, err = s.Get(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("locked"), value)
+
+	unlocked, err := s.Unlock(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.True(t, unlocked)
+
+	unlocked, err = s.Unlock(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.False(t, unlocked)
+
+	require.NoError(t, s.Set(ctx, []byte("key"), []byte("other")))
+
+	deleted, err = s.Del(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.True(t, deleted)
+}
+
+func TestMapStats(t *testing.T) {
+	const keys = 10
+
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	stats, err := s.MapStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, storage.MapStats{}, stats)
+
+	for i := range keys {
+		key, val := generateKV(i)
+		require.NoError(t, s.Set(ctx, key, val))
+	}
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("value")))
+
+	_, err = s.Del(ctx, []byte("key0"))
+	require.NoError(t, err)
+
+	stats, err = s.MapStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, storage.MapStats{Len: keys, Immutable: 1, Capacity: keys + 1}, stats)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.Snapshot(&buf))
+	require.NoError(t, s.LoadSnapshot(&buf))
+
+	stats, err = s.MapStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, storage.MapStats{Len: keys, Immutable: 1, Capacity: keys}, stats, "restoring rebuilds the map")
+}
+
+func TestSetMaxSetMin(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	steps := []struct {
+		name       string
+		set        func(ctx context.Context, key []byte, value int64) (int64, bool, error)
+		value      int64
+		wantResult int64
+		wantStored bool
+	}{
+		{name: "max creates", set: s.SetMax, value: 10, wantResult: 10, wantStored: true},
+		{name: "max lower keeps", set: s.SetMax, value: 5, wantResult: 10, wantStored: false},
+		{name: "max equal keeps", set: s.SetMax, value: 10, wantResult: 10, wantStored: false},
+		{name: "max greater stores", set: s.SetMax, value: 20, wantResult: 20, wantStored: true},
+		{name: "min greater keeps", set: s.SetMin, value: 30, wantResult: 20, wantStored: false},
+		{name: "min lower stores", set: s.SetMin, value: -3, wantResult: -3, wantStored: true},
+	}
+
+	for _, step := range steps {
+		result, stored, err := step.set(ctx, []byte("gauge"), step.value)
+		require.NoError(t, err, step.name)
+		assert.Equal(t, step.wantResult, result, step.name)
+		assert.Equal(t, step.wantStored, stored, step.name)
+	}
+
+	value, err := s.Get(ctx, []byte("gauge"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("-3"), value)
+
+	require.NoError(t, s.Set(ctx, []byte("text"), []byte("abc")))
+	_, _, err = s.SetMax(ctx, []byte("text"), 1)
+	require.ErrorIs(t, err, storage.ErrNotInteger)
+	_, _, err = s.SetMin(ctx, []byte("text"), 1)
+	require.ErrorIs(t, err, storage.ErrNotInteger)
+
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("1")))
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked-text"), []byte("abc")))
+
+	for _, tt := range []struct {
+		name  string
+		set   func(ctx context.Context, key []byte, value int64) (int64, bool, error)
+		key   string
+		value int64
+	}{
+		{name: "max that would store", set: s.SetMax, key: "locked", value: 5},
+		{name: "max that would keep", set: s.SetMax, key: "locked", value: 0},
+		{name: "min that would store", set: s.SetMin, key: "locked", value: 0},
+		{name: "min that would keep", set: s.SetMin, key: "locked", value: 5},
+		{name: "non-integer value", set: s.SetMax, key: "locked-text", value: 1},
+	} {
+		_, _, err := tt.set(ctx, []byte(tt.key), tt.value)
+		require.ErrorIs(t, err, storage.ErrImmutable, tt.name)
+	}
+}
+
+func TestConcurrentSetMaxSetMin(t *testing.T) {
+	const workers = 100
+
+	s := storage.NewStorage()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	runConcurrent(workers, &wg, func(i int) {
+		_, _, err := s.SetMax(ctx, []byte("max"), int64(i))
+		assert.NoError(t, err)
+
+		_, _, err = s.SetMin(ctx, []byte("min"), int64(i))
+		assert.NoError(t, err)
+	})
+
+	value, err := s.Get(ctx, []byte("max"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte(strconv.Itoa(workers-1)), value)
+
+	value, err = s.Get(ctx, []byte("min"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("0"), value)
+}
+
+func TestSetIfChanged(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	steps := []struct {
+		name       string
+		value      []byte
+		wantStored bool
+	}{
+		{name: "missing key stores", value: []byte("a"), wantStored: true},
+		{name: "identical value skips", value: []byte("a"), wantStored: false},
+		{name: "different value stores", value: []byte("b"), wantStored: true},
+		{name: "empty value stores", value: []byte{}, wantStored: true},
+		{name: "identical empty value skips", value: []byte{}, wantStored: false},
+	}
+
+	for _, step := range steps {
+		stored, err := s.SetIfChanged(ctx, []byte("key"), step.value)
+		require.NoError(t, err, step.name)
+		assert.Equal(t, step.wantStored, stored, step.name)
+
+		value, err := s.Get(ctx, []byte("key"))
+		require.NoError(t, err, step.name)
+		assert.Equal(t, step.value, value, step.name)
+	}
+
+	for _, value := range []string{"a", "b"} {
+		require.NoError(t, s.Set(ctx, []byte("expiring"), []byte("a")))
+		_, err := s.Expire(ctx, []byte("expiring"), time.Hour)
+		require.NoError(t, err)
+
+		_, err = s.SetIfChanged(ctx, []byte("expiring"), []byte(value))
+		require.NoError(t, err)
+
+		ttl, err := s.TTL(ctx, []byte("expiring"))
+		require.NoError(t, err)
+		assert.Equal(t, storage.NoExpiry, ttl, "setting %q drops the expiry like Set", value)
+	}
+
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("v")))
+
+	_, err := s.SetIfChanged(ctx, []byte("locked"), []byte("other"))
+	require.ErrorIs(t, err, storage.ErrImmutable)
+
+	_, err = s.SetIfChanged(ctx, []byte("locked"), []byte("v"))
+	require.ErrorIs(t, err, storage.ErrImmutable, "an identical value fails like Set does")
+}
+
+func TestGetPrefix(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	for _, key := range []string{"user:2", "user:1", "users", "order:1", "use"} {
+		require.NoError(t, s.Set(ctx, []byte(key), []byte("v-"+key)))
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   []storage.KeyValue
+	}{
+		{
+			name:   "matching keys in key order",
+			prefix: "user:",
+			want: []storage.KeyValue{
+				{Key: []byte("user:1"), Value: []byte("v-user:1")},
+				{Key: []byte("user:2"), Value: []byte("v-user:2")},
+			},
+		},
+		{
+			name:   "key equal to prefix",
+			prefix: "order:1",
+			want:   []storage.KeyValue{{Key: []byte("order:1"), Value: []byte("v-order:1")}},
+		},
+		{
+			name:   "no match",
+			prefix: "session:",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetPrefix(ctx, []byte(tt.prefix))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	all, err := s.GetPrefix(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, all, 5, "empty prefix matches every key")
+}
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	for _, key := range []string{"user:2", "user:1", "order:1", "gone"} {
+		require.NoError(t, s.Set(ctx, []byte(key), []byte("v")))
+	}
+
+	_, err := s.Expire(ctx, []byte("gone"), 0)
+	require.NoError(t, err)
+
+	got, err := s.Keys(ctx, func(key []byte) bool { return bytes.HasPrefix(key, []byte("user:")) })
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("user:1"), []byte("user:2")}, got, "matching keys in key order")
+
+	got, err = s.Keys(ctx, func([]byte) bool { return true })
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:1"), []byte("user:1"), []byte("user:2")}, got, "expired keys are skipped")
+
+	got, err = s.Keys(ctx, func([]byte) bool { return false })
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestLen(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	n, err := s.Len(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "empty")
+
+	for _, key := range []string{"a", "b", "c", "gone"} {
+		require.NoError(t, s.Set(ctx, []byte(key), []byte("v")))
+	}
+
+	_, err = s.Expire(ctx, []byte("gone"), 0)
+	require.NoError(t, err)
+
+	n, err = s.Len(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "expired keys are not counted")
+
+	_, err = s.Del(ctx, []byte("a"))
+	require.NoError(t, err)
+
+	n, err = s.Len(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "after deletion")
+}
+
+func TestFlush(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	require.NoError(t, s.Set(ctx, []byte("a"), []byte("1")))
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("2")))
+	_, err := s.Expire(ctx, []byte("a"), time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Flush(ctx))
+
+	stats, err := s.MapStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, storage.MapStats{}, stats)
+
+	require.NoError(t, s.Set(ctx, []byte("locked"), []byte("3")), "immutability is flushed too")
+
+	_, err = s.TTL(ctx, []byte("a"))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, s.Flush(canceled), context.Canceled)
+}
+
+func TestIncr(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	steps := []struct {
+		name  string
+		delta int64
+		want  int64
+	}{
+		{name: "missing key starts at zero", delta: 1, want: 1},
+		{name: "increment", delta: 5, want: 6},
+		{name: "decrement below zero", delta: -10, want: -4},
+	}
+
+	for _, step := range steps {
+		got, err := s.Incr(ctx, []byte("counter"), step.delta)
+		require.NoError(t, err, step.name)
+		assert.Equal(t, step.want, got, step.name)
+	}
+
+	value, err := s.Get(ctx, []byte("counter"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("-4"), value)
+
+	require.NoError(t, s.Set(ctx, []byte("text"), []byte("abc")))
+	_, err = s.Incr(ctx, []byte("text"), 1)
+	require.ErrorIs(t, err, storage.ErrNotInteger)
+
+	require.NoError(t, s.Set(ctx, []byte("max"), []byte(strconv.FormatInt(math.MaxInt64, 10))))
+	_, err = s.Incr(ctx, []byte("max"), 1)
+	require.ErrorIs(t, err, storage.ErrOverflow)
+
+	require.NoError(t, s.Set(ctx, []byte("min"), []byte(strconv.FormatInt(math.MinInt64, 10))))
+	_, err = s.Incr(ctx, []byte("min"), -1)
+	require.ErrorIs(t, err, storage.ErrOverflow)
+
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("1")))
+	_, err = s.Incr(ctx, []byte("locked"), 1)
+	require.ErrorIs(t, err, storage.ErrImmutable)
+}
+
+func TestIncrEx(t *testing.T) {
+	const window = 100 * time.Millisecond
+
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	got, err := s.IncrEx(ctx, []byte("counter"), 1, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got, "first call creates the counter")
+
+	first, err := s.TTL(ctx, []byte("counter"))
+	require.NoError(t, err)
+	assert.Greater(t, first, time.Duration(0))
+	assert.LessOrEqual(t, first, window)
+
+	got, err = s.IncrEx(ctx, []byte("counter"), 1, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), got)
+
+	remaining, err := s.TTL(ctx, []byte("counter"))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, remaining, first, "later calls keep the expiry")
+
+	require.Eventually(t, func() bool {
+		_, err := s.Get(ctx, []byte("counter"))
+		return errors.Is(err, storage.ErrNotFound)
+	}, time.Second, 5*time.Millisecond)
+
+	got, err = s.IncrEx(ctx, []byte("counter"), 1, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got, "the next window starts over")
+
+	require.NoError(t, s.Set(ctx, []byte("persistent"), []byte("5")))
+	got, err = s.IncrEx(ctx, []byte("persistent"), 1, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), got)
+
+	remaining, err = s.TTL(ctx, []byte("persistent"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.NoExpiry, remaining, "existing keys get no expiry")
+
+	require.NoError(t, s.Set(ctx, []byte("text"), []byte("abc")))
+	_, err = s.IncrEx(ctx, []byte("text"), 1, window)
+	require.ErrorIs(t, err, storage.ErrNotInteger)
+
+	limited := storage.NewStorage(storage.WithMaxTTL(window, storage.MaxTTLReject))
+	_, err = limited.IncrEx(ctx, []byte("counter"), 1, time.Hour)
+	require.ErrorIs(t, err, storage.ErrTTLTooLong)
+}
+
+func TestConcurrentIncr(t *testing.T) {
+	const workers = 100
+
+	s := storage.NewStorage()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	runConcurrent(workers, &wg, func(i int) {
+		delta := int64(2)
+		if i%2 == 1 {
+			delta = -1
+		}
+
+		_, err := s.Incr(ctx, []byte("counter"), delta)
+		assert.NoError(t, err)
+	})
+
+	value, err := s.Get(ctx, []byte("counter"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte(strconv.Itoa(workers/2)), value)
+}
+
+func TestExpire(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	require.NoError(t, s.Set(ctx, []byte("key"), []byte("value")))
+	require.NoError(t, s.Set(ctx, []byte("persistent"), []byte("value")))
+
+	ok, err := s.Expire(ctx, []byte("key"), ttl)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.Expire(ctx, []byte("missing"), ttl)
+	require.NoError(t, err)
+	assert.False(t, ok, "missing keys cannot expire")
+
+	remaining, err := s.TTL(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.Greater(t, remaining, time.Duration(0))
+	assert.LessOrEqual(t, remaining, ttl)
+
+	remaining, err = s.TTL(ctx, []byte("persistent"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.NoExpiry, remaining)
+
+	value, err := s.Get(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	require.Eventually(t, func() bool {
+		_, err := s.Get(ctx, []byte("key"))
+		return errors.Is(err, storage.ErrNotFound)
+	}, time.Second, 5*time.Millisecond)
+
+	_, err = s.TTL(ctx, []byte("key"))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	prefixed, err := s.GetPrefix(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, prefixed, 1, "expired keys are not scanned")
+
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("value")))
+	_, err = s.Expire(ctx, []byte("locked"), ttl)
+	require.ErrorIs(t, err, storage.ErrImmutable)
+}
+
+func TestExpireClearedBySet(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	require.NoError(t, s.Set(ctx, []byte("key"), []byte("v1")))
+	_, err := s.Expire(ctx, []byte("key"), time.Hour)
+	require.NoError(t, err)
+
+	_, err = s.Incr(ctx, []byte("counter"), 1)
+	require.NoError(t, err)
+	_, err = s.Expire(ctx, []byte("counter"), time.Hour)
+	require.NoError(t, err)
+	_, err = s.Incr(ctx, []byte("counter"), 1)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Set(ctx, []byte("key"), []byte("v2")))
+
+	remaining, err := s.TTL(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.NoExpiry, remaining, "SET drops the expiry")
+
+	remaining, err = s.TTL(ctx, []byte("counter"))
+	require.NoError(t, err)
+	assert.Greater(t, remaining, time.Duration(0), "read-modify-write keeps the expiry")
+}
+
+func TestMaxTTL(t *testing.T) {
+	const limit = time.Hour
+
+	tests := []struct {
+		name    string
+		policy  storage.MaxTTLPolicy
+		ttl     time.Duration
+		want    time.Duration
+		wantErr error
+	}{
+		{name: "clamp above max", policy: storage.MaxTTLClamp, ttl: 24 * time.Hour, want: limit},
+		{name: "clamp below max", policy: storage.MaxTTLClamp, ttl: 30 * time.Minute, want: 30 * time.Minute},
+		{name: "clamp at max", policy: storage.MaxTTLClamp, ttl: limit, want: limit},
+		{name: "reject above max", policy: storage.MaxTTLReject, ttl: limit + time.Second, wantErr: storage.ErrTTLTooLong},
+		{name: "reject below max", policy: storage.MaxTTLReject, ttl: 30 * time.Minute, want: 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := storage.NewStorage(storage.WithMaxTTL(limit, tt.policy))
+
+			require.NoError(t, s.Set(ctx, []byte("key"), []byte("value")))
+
+			_, err := s.Expire(ctx, []byte("key"), tt.ttl)
+			_, _, rotateErr := s.Rotate(ctx, []byte("rotated"), []byte("value"), tt.ttl)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				require.ErrorIs(t, rotateErr, tt.wantErr)
+
+				remaining, err := s.TTL(ctx, []byte("key"))
+				require.NoError(t, err)
+				assert.Equal(t, storage.NoExpiry, remaining, "a rejected TTL leaves the key untouched")
+
+				_, err = s.Get(ctx, []byte("rotated"))
+				require.ErrorIs(t, err, storage.ErrNotFound)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, rotateErr)
+
+			for _, key := range []string{"key", "rotated"} {
+				remaining, err := s.TTL(ctx, []byte(key))
+				require.NoError(t, err)
+				assert.LessOrEqual(t, remaining, tt.want, key)
+				assert.Greater(t, remaining, tt.want-time.Second, key)
+			}
+		})
+	}
+}
+
+func TestSweepInterval(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage(storage.WithSweepInterval(5 * time.Millisecond))
+	defer s.Close()
+
+	for i := range 10 {
+		key, val := generateKV(i)
+		require.NoError(t, s.Set(ctx, key, val))
+
+		_, err := s.Expire(ctx, key, time.Millisecond)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, s.Set(ctx, []byte("persistent"), []byte("value")))
+
+	require.Eventually(t, func() bool {
+		stats, err := s.MapStats(ctx)
+		require.NoError(t, err)
+
+		return stats.Len == 1
+	}, time.Second, 5*time.Millisecond, "expired keys are reclaimed without being accessed")
+
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close(), "Close is idempotent")
+}
+
+func TestExpiredHook(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu      sync.Mutex
+		expired []string
+	)
+
+	s := storage.NewStorage(
+		storage.WithSweepInterval(5*time.Millisecond),
+		storage.WithExpiredHook(func(key []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			expired = append(expired, string(key))
+		}),
+	)
+	defer s.Close()
+
+	for _, key := range []string{"accessed", "swept"} {
+		require.NoError(t, s.Set(ctx, []byte(key), []byte("v")))
+
+		_, err := s.Expire(ctx, []byte(key), time.Millisecond)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, s.Set(ctx, []byte("persistent"), []byte("v")))
+	_, err := s.Del(ctx, []byte("persistent"))
+	require.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+
+	_, err = s.Get(ctx, []byte("accessed"))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(expired) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"accessed", "swept"}, expired, "each expired key is reported once, deleted ones never")
+}
+
+func TestDelIf(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	require.NoError(t, s.Set(ctx, []byte("key"), []byte("v2")))
+
+	deleted, err := s.DelIf(ctx, []byte("key"), []byte("v1"))
+	require.NoError(t, err)
+	assert.False(t, deleted, "stale expected value must not delete")
+
+	value, err := s.Get(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v2"), value)
+
+	deleted, err = s.DelIf(ctx, []byte("key"), []byte("v2"))
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	_, err = s.Get(ctx, []byte("key"))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	deleted, err = s.DelIf(ctx, []byte("missing"), nil)
+	require.NoError(t, err)
+	assert.False(t, deleted, "missing key matches no expected value")
+
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("v")))
+	_, err = s.DelIf(ctx, []byte("locked"), []byte("v"))
+	require.ErrorIs(t, err, storage.ErrImmutable)
+}
+
+func TestConcurrentDelIf(t *testing.T) {
+	const workers = 100
+
+	ctx := context.Background()
+	s := storage.NewStorage()
+	require.NoError(t, s.Set(ctx, []byte("lock"), []byte("owner")))
+
+	var (
+		wg      sync.WaitGroup
+		deleted atomic.Int32
+	)
+
+	runConcurrent(workers, &wg, func(i int) {
+		expected := []byte("owner")
+		if i%2 == 1 {
+			expected = []byte("stale")
+		}
+
+		ok, err := s.DelIf(ctx, []byte("lock"), expected)
+		assert.NoError(t, err)
+
+		if ok {
+			deleted.Add(1)
+		}
+	})
+
+	assert.Equal(t, int32(1), deleted.Load(), "exactly one matching DelIf deletes the key")
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	old, existed, err := s.Rotate(ctx, []byte("token"), []byte("t1"), time.Hour)
+	require.NoError(t, err)
+	assert.False(t, existed)
+	assert.Nil(t, old)
+
+	old, existed, err = s.Rotate(ctx, []byte("token"), []byte("t2"), time.Hour)
+	require.NoError(t, err)
+	assert.True(t, existed)
+	assert.Equal(t, []byte("t1"), old)
+
+	value, err := s.Get(ctx, []byte("token"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("t2"), value)
+
+	remaining, err := s.TTL(ctx, []byte("token"))
+	require.NoError(t, err)
+	assert.Greater(t, remaining, time.Duration(0))
+	assert.LessOrEqual(t, remaining, time.Hour)
+
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("v")))
+	_, _, err = s.Rotate(ctx, []byte("locked"), []byte("v2"), time.Hour)
+	require.ErrorIs(t, err, storage.ErrImmutable)
+}
+
+func TestConcurrentRotate(t *testing.T) {
+	const workers = 100
+
+	ctx := context.Background()
+	s := storage.NewStorage()
+	require.NoError(t, s.Set(ctx, []byte("token"), []byte("initial")))
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		olds = make(map[string]int)
+	)
+
+	runConcurrent(workers, &wg, func(i int) {
+		old, existed, err := s.Rotate(ctx, []byte("token"), fmt.Appendf(nil, "t%d", i), time.Hour)
+		assert.NoError(t, err)
+		assert.True(t, existed)
+
+		mu.Lock()
+		olds[string(old)]++
+		mu.Unlock()
+	})
+
+	last, err := s.Get(ctx, []byte("token"))
+	require.NoError(t, err)
+
+	// Serialized rotations form a chain: every value but the last is handed back exactly once.
+	assert.Len(t, olds, workers)
+	assert.Equal(t, 1, olds["initial"])
+	assert.NotContains(t, olds, string(last))
+
+	for old, n := range olds {
+		assert.Equal(t, 1, n, old)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	src := storage.NewStorage()
+
+	require.NoError(t, src.Set(ctx, []byte("plain"), []byte("value")))
+	require.NoError(t, src.Set(ctx, []byte("empty"), nil))
+	require.NoError(t, src.Set(ctx, []byte("binary"), []byte{0, 0xff, '\n'}))
+	require.NoError(t, src.SetImmutable(ctx, []byte("locked"), []byte("v")))
+	require.NoError(t, src.Set(ctx, []byte("expiring"), []byte("soon")))
+	_, err := src.Expire(ctx, []byte("expiring"), time.Hour)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Snapshot(&buf))
+
+	dst := storage.NewStorage()
+	require.NoError(t, dst.Set(ctx, []byte("stale"), []byte("replaced by the snapshot")))
+	require.NoError(t, dst.LoadSnapshot(&buf))
+
+	all, err := dst.GetPrefix(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.KeyValue{
+		{Key: []byte("binary"), Value: []byte{0, 0xff, '\n'}},
+		{Key: []byte("empty"), Value: []byte{}},
+		{Key: []byte("expiring"), Value: []byte("soon")},
+		{Key: []byte("locked"), Value: []byte("v")},
+		{Key: []byte("plain"), Value: []byte("value")},
+	}, all)
+
+	require.ErrorIs(t, dst.Set(ctx, []byte("locked"), []byte("v2")), storage.ErrImmutable)
+
+	remaining, err := dst.TTL(ctx, []byte("expiring"))
+	require.NoError(t, err)
+	assert.Greater(t, remaining, 59*time.Minute)
+
+	remaining, err = dst.TTL(ctx, []byte("plain"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.NoExpiry, remaining)
+}
+
+func TestSnapshotDropsExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	src := storage.NewStorage()
+
+	require.NoError(t, src.Set(ctx, []byte("key"), []byte("value")))
+	_, err := src.Expire(ctx, []byte("key"), 20*time.Millisecond)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Snapshot(&buf))
+	time.Sleep(30 * time.Millisecond)
+
+	dst := storage.NewStorage()
+	require.NoError(t, dst.LoadSnapshot(&buf))
+
+	stats, err := dst.MapStats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Len)
+}
+
+func TestLoadSnapshotInvalid(t *testing.T) {
+	ctx := context.Background()
+	src := storage.NewStorage()
+	require.NoError(t, src.Set(ctx, []byte("key"), []byte("value")))
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Snapshot(&buf))
+	valid := buf.Bytes()
+
+	corrupt := func(i int) []byte {
+		data := bytes.Clone(valid)
+		data[i] ^= 0xff
+
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "wrong magic", data: corrupt(0)},
+		{name: "unknown version", data: corrupt(4)},
+		{name: "corrupted entry", data: corrupt(len(valid) - 6)},
+		{name: "truncated", data: valid[:len(valid)-1]},
+		{name: "trailing bytes", data: append(bytes.Clone(valid), 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := storage.NewStorage()
+			require.NoError(t, dst.Set(ctx, []byte("existing"), []byte("kept")))
+
+			require.ErrorIs(t, dst.LoadSnapshot(bytes.NewReader(tt.data)), storage.ErrInvalidSnapshot)
+
+			value, err := dst.Get(ctx, []byte("existing"))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("kept"), value, "a rejected snapshot leaves the storage untouched")
+		})
+	}
+}
+
+func TestAppendSep(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	for _, tt := range []struct{ value, want string }{
+		{value: "a", want: "a"},
+		{value: "b", want: "a,b"},
+		{value: "", want: "a,b,"},
+		{value: "c", want: "a,b,,c"},
+	} {
+		result, err := s.AppendSep(ctx, []byte("list"), []byte(tt.value), []byte(","))
+		require.NoError(t, err)
+		assert.Equal(t, []byte(tt.want), result)
+	}
+
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("v")))
+	_, err := s.AppendSep(ctx, []byte("locked"), []byte("w"), []byte(","))
+	require.ErrorIs(t, err, storage.ErrImmutable)
+}
+
+func TestConcurrentAppendSep(t *testing.T) {
+	const workers = 100
+
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	var wg sync.WaitGroup
+	runConcurrent(workers, &wg, func(i int) {
+		_, err := s.AppendSep(ctx, []byte("list"), []byte(strconv.Itoa(i)), []byte(","))
+		assert.NoError(t, err)
+	})
+
+	value, err := s.Get(ctx, []byte("list"))
+	require.NoError(t, err)
+
+	items := strings.Split(string(value), ",")
+	want := make([]string, workers)
+	for i := range want {
+		want[i] = strconv.Itoa(i)
+	}
+
+	assert.ElementsMatch(t, want, items, "no append is lost")
+}
+
+func TestGetMany(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	require.NoError(t, s.Set(ctx, []byte("a"), []byte("1")))
+	require.NoError(t, s.Set(ctx, []byte("empty"), nil))
+
+	values, found, err := s.GetMany(ctx, [][]byte{[]byte("a"), []byte("missing"), []byte("empty"), []byte("a")})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), nil, nil, []byte("1")}, values)
+	assert.Equal(t, []bool{true, false, true, true}, found)
+}
+
+func TestStoredValueIsCopied(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	writes := []struct {
+		name  string
+		write func(key, value []byte) error
+	}{
+		{name: "set", write: func(key, value []byte) error { return s.Set(ctx, key, value) }},
+		{name: "setimmutable", write: func(key, value []byte) error { return s.SetImmutable(ctx, key, value) }},
+		{name: "getorset", write: func(key, value []byte) error {
+			_, _, err := s.GetOrSet(ctx, key, value)
+			return err
+		}},
+	}
+
+	for _, w := range writes {
+		t.Run(w.name, func(t *testing.T) {
+			key := []byte(w.name)
+			buf := []byte("original")
+			require.NoError(t, w.write(key, buf))
+
+			copy(buf, "mutated!")
+
+			value, err := s.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("original"), value)
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage()
+
+	var (
+		gotOld     []byte
+		gotExisted bool
+	)
+
+	err := s.Update(ctx, []byte("key"), func(old []byte, existed bool) ([]byte, storage.UpdateAction) {
+		gotOld, gotExisted = old, existed
+		return []byte("ignored"), storage.UpdateKeep
+	})
+	require.NoError(t, err)
+	assert.Nil(t, gotOld)
+	assert.False(t, gotExisted)
+
+	_, err = s.Get(ctx, []byte("key"))
+	require.ErrorIs(t, err, storage.ErrNotFound, "value must not be stored when store is false")
+
+	err = s.Update(ctx, []byte("key"), func(_ []byte, _ bool) ([]byte, storage.UpdateAction) {
+		return []byte("stored"), storage.UpdateStore
+	})
+	require.NoError(t, err)
+
+	err = s.Update(ctx, []byte("key"), func(old []byte, existed bool) ([]byte, storage.UpdateAction) {
+		gotOld, gotExisted = old, existed
+		return nil, storage.UpdateKeep
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("stored"), gotOld)
+	assert.True(t, gotExisted)
+
+	require.NoError(t, s.SetImmutable(ctx, []byte("locked"), []byte("value")))
+
+	err = s.Update(ctx, []byte("locked"), func(_ []byte, _ bool) ([]byte, storage.UpdateAction) {
+		return []byte("other"), storage.UpdateStore
+	})
+	require.ErrorIs(t, err, storage.ErrImmutable)
+
+	err = s.Update(ctx, []byte("locked"), func(_ []byte, _ bool) ([]byte, storage.UpdateAction) {
+		return nil, storage.UpdateKeep
+	})
+	require.NoError(t, err, "read-only update of an immutable key is allowed")
+
+	err = s.Update(ctx, []byte("locked"), func(_ []byte, _ bool) ([]byte, storage.UpdateAction) {
+		return nil, storage.UpdateDelete
+	})
+	require.ErrorIs(t, err, storage.ErrImmutable)
+
+	err = s.Update(ctx, []byte("key"), func(_ []byte, _ bool) ([]byte, storage.UpdateAction) {
+		return nil, storage.UpdateDelete
+	})
+	require.NoError(t, err)
+
+	_, err = s.Get(ctx, []byte("key"))
+	require.ErrorIs(t, err, storage.ErrNotFound, "value must be removed on delete")
+}
+
+func TestConcurrentUpdateIncr(t *testing.T) {
+	const (
+		workers    = 100
+		increments = 10
+	)
+
+	s := storage.NewStorage()
+	ctx := context.Background()
+
+	incr := func(old []byte, _ bool) ([]byte, storage.UpdateAction) {
+		n, _ := strconv.Atoi(string(old))
+		return []byte(strconv.Itoa(n + 1)), storage.UpdateStore
+	}
+
+	var wg sync.WaitGroup
+
+	runConcurrent(workers, &wg, func(_ int) {
+		for range increments {
+			assert.NoError(t, s.Update(ctx, []byte("counter"), incr))
+		}
+	})
+
+	value, err := s.Get(ctx, []byte("counter"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte(strconv.Itoa(workers*increments)), value)
+}
+
+func TestIndexGet(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewStorage(storage.WithIndex([]byte("user:")))
+
+	require.NoError(t, s.Set(ctx, []byte("user:1"), []byte("admin")))
+	require.NoError(t, s.Set(ctx, []byte("user:2"), []byte("guest")))
+	require.NoError(t, s.Set(ctx, []byte("user:3"), []byte("admin")))
+	require.NoError(t, s.Set(ctx, []byte("group:1"), []byte("admin")))
+
+	indexGet := func(field string) [][]byte {
+		t.Helper()
+
+		keys, err := s.IndexGet(ctx, []byte(field))
+		require.NoError(t, err)
+
+		return keys
+	}
+
+	assert.Equal(t, [][]byte{[]byte("user:1"), []byte("user:3")}, indexGet("admin"), "only keys with the prefix")
+	assert.Equal(t, [][]byte{[]byte("user:2")}, indexGet("guest"))
+	assert.Empty(t, indexGet("owner"))
+
+	require.NoError(t, s.Set(ctx, []byte("user:3"), []byte("guest")))
+	assert.Equal(t, [][]byte{[]byte("user:1")}, indexGet("admin"), "overwrites move the key")
+	assert.Equal(t, [][]byte{[]byte("user:2"), []byte("user:3")}, indexGet("guest"))
+
+	_, err := s.Del(ctx, []byte("user:1"))
+	require.NoError(t, err)
+	assert.Empty(t, indexGet("admin"), "deletes remove the key")
+
+	_, err = s.Incr(ctx, []byte("user:4"), 1)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("user:4")}, indexGet("1"), "updates are indexed")
+
+	_, err = s.Expire(ctx, []byte("user:4"), time.Millisecond)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(indexGet("1")) == 0
+	}, time.Second, 5*time.Millisecond, "expired keys are left out")
+
+	var buf bytes.Buffer
+	require.NoError(t, s.Snapshot(&buf))
+	require.NoError(t, s.Flush(ctx))
+	assert.Empty(t, indexGet("guest"), "flush empties the index")
+
+	require.NoError(t, s.LoadSnapshot(&buf))
+	assert.Equal(t, [][]byte{[]byte("user:2"), []byte("user:3")}, indexGet("guest"), "restored keys are indexed")
+
+	_, err = storage.NewStorage().IndexGet(ctx, []byte("guest"))
+	require.ErrorIs(t, err, storage.ErrNoIndex)
+}
+
+func TestConcurrentIndex(t *testing.T) {
+	const (
+		workers = 50
+		rounds  = 100
+	)
+
+	ctx := context.Background()
+	s := storage.NewStorage(storage.WithIndex([]byte("key")))
+
+	var wg sync.WaitGroup
+
+	runConcurrent(workers, &wg, func(i int) {
+		key := []byte("key" + strconv.Itoa(i%10))
+		for j := range rounds {
+			if j%3 == 0 {
+				_, err := s.Del(ctx, key)
+				assert.NoError(t, err)
+
+				continue
+			}
+
+			assert.NoError(t, s.Set(ctx, key, []byte(strconv.Itoa(j%4))))
+		}
+	})
+
+	indexed := make(map[string]string)
+	for field := range 4 {
+		keys, err := s.IndexGet(ctx, []byte(strconv.Itoa(field)))
+		require.NoError(t, err)
+
+		for _, key := range keys {
+			_, dup := indexed[string(key)]
+			require.False(t, dup, "%s is indexed under two values", key)
+
+			indexed[string(key)] = strconv.Itoa(field)
+		}
+	}
+
+	stored, err := s.GetPrefix(ctx, []byte("key"))
+	require.NoError(t, err)
+	require.Len(t, indexed, len(stored))
+
+	for _, kv := range stored {
+		assert.Equal(t, string(kv.Value), indexed[string(kv.Key)], "index of %s", kv.Key)
+	}
+}
+
 func TestCustomEngine(t *testing.T) {
 	ctx := context.Background()
 
@@ -220,12 +1458,14 @@ func TestCustomEngine(t *testing.T) {
 		{
 			name: "Del delegates to engine",
 			setup: func(m *mockEngine) {
-				m.delFunc = func(key []byte) {
+				m.delFunc = func(key []byte) (bool, error) {
 					assert.Equal(t, []byte("foo"), key)
+					return true, nil
 				}
 			},
 			action: func(s *storage.Storage) ([]byte, error) {
-				err := s.Del(ctx, []byte("foo"))
+				deleted, err := s.Del(ctx, []byte("foo"))
+				assert.True(t, deleted)
 				return nil, err
 			},
 			expected: nil,
@@ -247,6 +1487,131 @@ func TestCustomEngine(t *testing.T) {
 	}
 }
 
+func TestValidator(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		key     []byte
+		value   []byte
+		wantErr error
+	}{
+		{
+			name:    "valid key and value",
+			key:     []byte("ключ"),
+			value:   []byte("значение"),
+			wantErr: nil,
+		},
+		{
+			name:    "empty key and value",
+			key:     []byte{},
+			value:   []byte{},
+			wantErr: nil,
+		},
+		{
+			name:    "invalid key",
+			key:     []byte{0xff, 0xfe},
+			value:   []byte("value"),
+			wantErr: storage.ErrInvalidEncoding,
+		},
+		{
+			name:    "invalid value",
+			key:     []byte("key"),
+			value:   []byte{'v', 0xc3},
+			wantErr: storage.ErrInvalidEncoding,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := storage.NewStorage(storage.WithValidator(utf8.Valid))
+
+			_, _, err := s.GetOrSet(ctx, tc.key, tc.value)
+			require.ErrorIs(t, err, tc.wantErr)
+
+			err = s.Update(ctx, tc.key, func(_ []byte, _ bool) ([]byte, storage.UpdateAction) {
+				return tc.value, storage.UpdateStore
+			})
+			require.ErrorIs(t, err, tc.wantErr)
+
+			err = s.Set(ctx, tc.key, tc.value)
+			require.ErrorIs(t, err, tc.wantErr)
+
+			err = s.SetMany(ctx, []storage.KeyValue{{Key: tc.key, Value: tc.value}})
+			require.ErrorIs(t, err, tc.wantErr)
+
+			_, _, err = s.Rotate(ctx, tc.key, tc.value, time.Hour)
+			require.ErrorIs(t, err, tc.wantErr)
+
+			src := storage.NewStorage()
+			require.NoError(t, src.Set(ctx, tc.key, tc.value))
+
+			var snapshot bytes.Buffer
+			require.NoError(t, src.Snapshot(&snapshot))
+
+			err = s.LoadSnapshot(&snapshot)
+			require.ErrorIs(t, err, tc.wantErr, "snapshots are validated too")
+
+			err = s.SetImmutable(ctx, tc.key, tc.value)
+			require.ErrorIs(t, err, tc.wantErr)
+
+			result, err := s.Get(ctx, tc.key)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, storage.ErrNotFound)
+				assert.Nil(t, result)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.value, result)
+		})
+	}
+}
+
+func TestWithoutContextChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := storage.NewStorage(storage.WithoutContextChecks())
+
+	require.NoError(t, s.Set(ctx, []byte("key"), []byte("value")))
+
+	value, err := s.Get(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	deleted, err := s.Del(ctx, []byte("key"))
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	_, err = s.Get(ctx, []byte("key"))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func BenchmarkStorageGet(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		opts []storage.Option
+	}{
+		{name: "with context checks", opts: nil},
+		{name: "without context checks", opts: []storage.Option{storage.WithoutContextChecks()}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			ctx := context.Background()
+			s := storage.NewStorage(bm.opts...)
+			key := []byte("key")
+			require.NoError(b, s.Set(ctx, key, []byte("value")))
+
+			for b.Loop() {
+				_, _ = s.Get(ctx, key)
+			}
+		})
+	}
+}
+
 func FuzzStorage(f *testing.F) {
 	ctx := context.Background()
 	s := storage.NewStorage()
@@ -263,7 +1628,9 @@ func FuzzStorage(f *testing.F) {
 		require.NoError(t, err, "Get should not fail")
 		require.Equal(t, value, result, "Get returned unexpected value")
 
-		require.NoError(t, s.Del(ctx, key), "Del should not fail")
+		deleted, err := s.Del(ctx, key)
+		require.NoError(t, err, "Del should not fail")
+		require.True(t, deleted, "Del should report existing key")
 
 		result, err = s.Get(ctx, key)
 		require.Nil(t, result, "Result should be nil after deletion")
@@ -272,16 +1639,52 @@ func FuzzStorage(f *testing.F) {
 }
 
 type mockEngine struct {
-	setFunc func(key, value []byte)
-	getFunc func(key []byte) ([]byte, bool)
-	delFunc func(key []byte)
+	setFunc     func(key, value []byte)
+	setManyFunc func(pairs []storage.KeyValue) (int, error)
+	getFunc     func(key []byte) ([]byte, bool)
+	getManyFunc func(keys [][]byte) ([][]byte, []bool)
+	delFunc     func(key []byte) (bool, error)
+
+	setImmutableFunc func(key, value []byte) error
+	unlockFunc       func(key []byte) bool
+
+	mapStatsFunc func() storage.MapStats
+	lenFunc      func() int
+	updateFunc   func(key []byte, fn storage.UpdateFunc) error
+
+	updateExpireFunc func(key []byte, fn storage.UpdateFunc, at time.Time) error
+
+	scanPrefixFunc func(prefix []byte) []storage.KeyValue
+	keysFunc       func(match func(key []byte) bool) [][]byte
+	expireFunc     func(key []byte, at time.Time) (bool, error)
+	ttlFunc        func(key []byte) (time.Duration, bool)
+	sweepFunc      func() int
+	swapFunc       func(key, value []byte, at time.Time) ([]byte, bool, error)
+
+	entriesFunc func() []storage.Entry
+	restoreFunc func(entries []storage.Entry) error
+	flushFunc   func()
+
+	indexFunc    func(prefix []byte)
+	indexGetFunc func(field []byte) ([][]byte, bool)
+
+	onExpiredFunc func(fn func(key []byte))
+}
+
+func (m *mockEngine) SetMany(pairs []storage.KeyValue) (int, error) {
+	if m.setManyFunc == nil {
+		panic("setManyFunc is nil")
+	}
+	return m.setManyFunc(pairs)
 }
 
-func (m *mockEngine) Set(key, value []byte) {
+func (m *mockEngine) Set(key, value []byte) error {
 	if m.setFunc == nil {
 		panic("setFunc is nil")
 	}
 	m.setFunc(key, value)
+
+	return nil
 }
 
 func (m *mockEngine) Get(key []byte) ([]byte, bool) {
@@ -291,11 +1694,144 @@ func (m *mockEngine) Get(key []byte) ([]byte, bool) {
 	return m.getFunc(key)
 }
 
-func (m *mockEngine) Del(key []byte) {
+func (m *mockEngine) GetMany(keys [][]byte) ([][]byte, []bool) {
+	if m.getManyFunc == nil {
+		panic("getManyFunc is nil")
+	}
+	return m.getManyFunc(keys)
+}
+
+func (m *mockEngine) Del(key []byte) (bool, error) {
 	if m.delFunc == nil {
 		panic("delFunc is nil")
 	}
-	m.delFunc(key)
+	return m.delFunc(key)
+}
+
+func (m *mockEngine) SetImmutable(key, value []byte) error {
+	if m.setImmutableFunc == nil {
+		panic("setImmutableFunc is nil")
+	}
+	return m.setImmutableFunc(key, value)
+}
+
+func (m *mockEngine) Unlock(key []byte) bool {
+	if m.unlockFunc == nil {
+		panic("unlockFunc is nil")
+	}
+	return m.unlockFunc(key)
+}
+
+func (m *mockEngine) MapStats() storage.MapStats {
+	if m.mapStatsFunc == nil {
+		panic("mapStatsFunc is nil")
+	}
+	return m.mapStatsFunc()
+}
+
+func (m *mockEngine) Len() int {
+	if m.lenFunc == nil {
+		panic("lenFunc is nil")
+	}
+	return m.lenFunc()
+}
+
+func (m *mockEngine) Update(key []byte, fn storage.UpdateFunc) error {
+	if m.updateFunc == nil {
+		panic("updateFunc is nil")
+	}
+	return m.updateFunc(key, fn)
+}
+
+func (m *mockEngine) Index(prefix []byte) {
+	if m.indexFunc == nil {
+		panic("indexFunc is nil")
+	}
+	m.indexFunc(prefix)
+}
+
+func (m *mockEngine) IndexGet(field []byte) ([][]byte, bool) {
+	if m.indexGetFunc == nil {
+		panic("indexGetFunc is nil")
+	}
+	return m.indexGetFunc(field)
+}
+
+func (m *mockEngine) OnExpired(fn func(key []byte)) {
+	if m.onExpiredFunc == nil {
+		panic("onExpiredFunc is nil")
+	}
+	m.onExpiredFunc(fn)
+}
+
+func (m *mockEngine) UpdateExpire(key []byte, fn storage.UpdateFunc, at time.Time) error {
+	if m.updateExpireFunc == nil {
+		panic("updateExpireFunc is nil")
+	}
+	return m.updateExpireFunc(key, fn, at)
+}
+
+func (m *mockEngine) ScanPrefix(prefix []byte) []storage.KeyValue {
+	if m.scanPrefixFunc == nil {
+		panic("scanPrefixFunc is nil")
+	}
+	return m.scanPrefixFunc(prefix)
+}
+
+func (m *mockEngine) Keys(match func(key []byte) bool) [][]byte {
+	if m.keysFunc == nil {
+		panic("keysFunc is nil")
+	}
+	return m.keysFunc(match)
+}
+
+func (m *mockEngine) Expire(key []byte, at time.Time) (bool, error) {
+	if m.expireFunc == nil {
+		panic("expireFunc is nil")
+	}
+	return m.expireFunc(key, at)
+}
+
+func (m *mockEngine) TTL(key []byte) (time.Duration, bool) {
+	if m.ttlFunc == nil {
+		panic("ttlFunc is nil")
+	}
+	return m.ttlFunc(key)
+}
+
+func (m *mockEngine) Sweep() int {
+	if m.sweepFunc == nil {
+		panic("sweepFunc is nil")
+	}
+	return m.sweepFunc()
+}
+
+func (m *mockEngine) Swap(key, value []byte, at time.Time) ([]byte, bool, error) {
+	if m.swapFunc == nil {
+		panic("swapFunc is nil")
+	}
+	return m.swapFunc(key, value, at)
+}
+
+func (m *mockEngine) Entries() []storage.Entry {
+	if m.entriesFunc == nil {
+		panic("entriesFunc is nil")
+	}
+	return m.entriesFunc()
+}
+
+func (m *mockEngine) Restore(entries []storage.Entry) error {
+	if m.restoreFunc == nil {
+		panic("restoreFunc is nil")
+	}
+	return m.restoreFunc(entries)
+}
+
+func (m *mockEngine) Flush() {
+	if m.flushFunc == nil {
+		panic("flushFunc is nil")
+	}
+	m.flushFunc()
 }
 
 func runConcurrent(n int, wg *sync.WaitGroup, fn func(i int)) {
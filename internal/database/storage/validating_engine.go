@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// validatingEngine checks the keys and values of every method that writes them; the methods
+// it does not override only read or remove keys.
+type validatingEngine struct {
+	iEngine
+
+	valid func(b []byte) bool
+}
+
+func newValidatingEngine(engine iEngine, valid func(b []byte) bool) *validatingEngine {
+	return &validatingEngine{
+		iEngine: engine,
+		valid:   valid,
+	}
+}
+
+func (e *validatingEngine) Set(key []byte, value []byte) error {
+	if err := e.validate(key, value); err != nil {
+		return err
+	}
+
+	return e.iEngine.Set(key, value)
+}
+
+func (e *validatingEngine) SetMany(pairs []KeyValue) (int, error) {
+	for i, pair := range pairs {
+		if err := e.validate(pair.Key, pair.Value); err != nil {
+			return i, err
+		}
+	}
+
+	return e.iEngine.SetMany(pairs)
+}
+
+func (e *validatingEngine) SetImmutable(key []byte, value []byte) error {
+	if err := e.validate(key, value); err != nil {
+		return err
+	}
+
+	return e.iEngine.SetImmutable(key, value)
+}
+
+func (e *validatingEngine) Update(key []byte, fn UpdateFunc) error {
+	return e.update(key, fn, e.iEngine.Update)
+}
+
+func (e *validatingEngine) UpdateExpire(key []byte, fn UpdateFunc, at time.Time) error {
+	return e.update(key, fn, func(key []byte, fn UpdateFunc) error {
+		return e.iEngine.UpdateExpire(key, fn, at)
+	})
+}
+
+// update validates key and the value fn stores before update runs it.
+func (e *validatingEngine) update(key []byte, fn UpdateFunc, update func(key []byte, fn UpdateFunc) error) error {
+	if !e.valid(key) {
+		return ErrInvalidEncoding
+	}
+
+	var invalid bool
+
+	err := update(key, func(old []byte, existed bool) ([]byte, UpdateAction) {
+		value, action := fn(old, existed)
+		if (action == UpdateStore || action == UpdatePersist) && !e.valid(value) {
+			invalid = true
+
+			return nil, UpdateKeep
+		}
+
+		return value, action
+	})
+	if err != nil {
+		return err
+	}
+
+	if invalid {
+		return ErrInvalidEncoding
+	}
+
+	return nil
+}
+
+func (e *validatingEngine) Swap(key []byte, value []byte, at time.Time) ([]byte, bool, error) {
+	if err := e.validate(key, value); err != nil {
+		return nil, false, err
+	}
+
+	return e.iEngine.Swap(key, value, at)
+}
+
+// Restore leaves the engine untouched if any entry is invalid.
+func (e *validatingEngine) Restore(entries []Entry) error {
+	for _, entry := range entries {
+		if err := e.validate(entry.Key, entry.Value); err != nil {
+			return fmt.Errorf("key %q: %w", entry.Key, err)
+		}
+	}
+
+	return e.iEngine.Restore(entries)
+}
+
+func (e *validatingEngine) validate(key []byte, value []byte) error {
+	if !e.valid(key) || !e.valid(value) {
+		return ErrInvalidEncoding
+	}
+
+	return nil
+}
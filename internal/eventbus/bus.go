@@ -0,0 +1,137 @@
+package eventbus
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+type OverflowPolicy int
+
+const (
+	OverflowDropNewest OverflowPolicy = iota
+	OverflowDropOldest
+	OverflowDisconnect
+)
+
+type Bus struct {
+	queueSize   int
+	version     atomic.Uint64
+	dropped     atomic.Uint64
+	subscribers map[*Subscription]struct{}
+	mu          sync.RWMutex
+}
+
+func NewBus(queueSize int) *Bus {
+	return &Bus{
+		queueSize:   queueSize,
+		subscribers: make(map[*Subscription]struct{}),
+		mu:          sync.RWMutex{},
+	}
+}
+
+// Publish never blocks: a subscriber whose queue is full is handled according to its OverflowPolicy.
+func (b *Bus) Publish(e Event) {
+	e.Key = bytes.Clone(e.Key)
+	e.Value = bytes.Clone(e.Value)
+	e.Version = b.version.Add(1)
+
+	var disconnected []*Subscription
+
+	b.mu.RLock()
+	for sub := range b.subscribers {
+		if !sub.offer(e) {
+			disconnected = append(disconnected, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range disconnected {
+		b.unsubscribe(sub)
+	}
+}
+
+func (b *Bus) Subscribe(policy OverflowPolicy) *Subscription {
+	sub := &Subscription{
+		bus:    b,
+		policy: policy,
+		events: make(chan Event, b.queueSize),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[sub] = struct{}{}
+
+	return sub
+}
+
+func (b *Bus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+type Subscription struct {
+	bus     *Bus
+	policy  OverflowPolicy
+	dropped atomic.Uint64
+	events  chan Event
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// offer reports false when the subscriber must be disconnected.
+func (s *Subscription) offer(e Event) bool {
+	for {
+		select {
+		case s.events <- e:
+			return true
+		default:
+		}
+
+		switch s.policy {
+		case OverflowDropOldest:
+			select {
+			case <-s.events:
+				s.drop()
+			default:
+			}
+
+		case OverflowDisconnect:
+			s.drop()
+
+			return false
+
+		default:
+			s.drop()
+
+			return true
+		}
+	}
+}
+
+func (s *Subscription) drop() {
+	s.dropped.Add(1)
+	s.bus.dropped.Add(1)
+}
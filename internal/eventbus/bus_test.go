@@ -0,0 +1,144 @@
+package eventbus_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxm86545/concurrency_go/internal/eventbus"
+)
+
+func TestBus_PublishToSubscribers(t *testing.T) {
+	const subscribers = 3
+
+	bus := eventbus.NewBus(10)
+
+	subs := make([]*eventbus.Subscription, 0, subscribers)
+	for range subscribers {
+		subs = append(subs, bus.Subscribe(eventbus.OverflowDropNewest))
+	}
+
+	bus.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: []byte("k"), Value: []byte("v")})
+	bus.Publish(eventbus.Event{Command: eventbus.CommandDel, Key: []byte("k")})
+
+	for _, sub := range subs {
+		e := <-sub.Events()
+		assert.Equal(t, eventbus.Event{Command: eventbus.CommandSet, Key: []byte("k"), Value: []byte("v"), Version: 1}, e)
+
+		e = <-sub.Events()
+		assert.Equal(t, eventbus.Event{Command: eventbus.CommandDel, Key: []byte("k"), Version: 2}, e)
+	}
+}
+
+func TestBus_PublishCopiesPayload(t *testing.T) {
+	bus := eventbus.NewBus(1)
+	sub := bus.Subscribe(eventbus.OverflowDropNewest)
+
+	key := []byte("key")
+	value := []byte("value")
+	bus.Publish(eventbus.Event{Command: eventbus.CommandSet, Key: key, Value: value})
+
+	copy(key, "xxx")
+	copy(value, "xxxxx")
+
+	e := <-sub.Events()
+	assert.Equal(t, []byte("key"), e.Key)
+	assert.Equal(t, []byte("value"), e.Value)
+}
+
+func TestBus_Overflow(t *testing.T) {
+	const (
+		queueSize = 2
+		published = 5
+	)
+
+	tests := []struct {
+		name             string
+		policy           eventbus.OverflowPolicy
+		wantVersions     []uint64
+		wantDropped      uint64
+		wantDisconnected bool
+	}{
+		{
+			name:         "drop newest",
+			policy:       eventbus.OverflowDropNewest,
+			wantVersions: []uint64{1, 2},
+			wantDropped:  3,
+		},
+		{
+			name:         "drop oldest",
+			policy:       eventbus.OverflowDropOldest,
+			wantVersions: []uint64{4, 5},
+			wantDropped:  3,
+		},
+		{
+			name:             "disconnect",
+			policy:           eventbus.OverflowDisconnect,
+			wantVersions:     []uint64{1, 2},
+			wantDropped:      1,
+			wantDisconnected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := eventbus.NewBus(queueSize)
+			slow := bus.Subscribe(tt.policy)
+			fast := bus.Subscribe(eventbus.OverflowDropNewest)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+
+				for range published {
+					bus.Publish(eventbus.Event{Command: eventbus.CommandSet})
+					<-fast.Events()
+				}
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				require.FailNow(t, "publisher blocked by slow subscriber")
+			}
+
+			versions := make([]uint64, 0, queueSize)
+			for range queueSize {
+				versions = append(versions, (<-slow.Events()).Version)
+			}
+			assert.Equal(t, tt.wantVersions, versions)
+
+			assert.Equal(t, tt.wantDropped, slow.Dropped())
+			assert.Equal(t, uint64(0), fast.Dropped())
+			assert.Equal(t, tt.wantDropped, bus.Dropped())
+
+			if tt.wantDisconnected {
+				_, ok := <-slow.Events()
+				assert.False(t, ok, "slow subscriber should be disconnected")
+
+				return
+			}
+
+			select {
+			case e := <-slow.Events():
+				require.Fail(t, "unexpected event", "got %v", e)
+			default:
+			}
+		})
+	}
+}
+
+func TestSubscription_Close(t *testing.T) {
+	bus := eventbus.NewBus(1)
+	sub := bus.Subscribe(eventbus.OverflowDropNewest)
+
+	sub.Close()
+	sub.Close()
+
+	bus.Publish(eventbus.Event{Command: eventbus.CommandSet})
+
+	_, ok := <-sub.Events()
+	assert.False(t, ok, "events channel should be closed")
+}
@@ -0,0 +1,27 @@
+package eventbus
+
+import "time"
+
+type Command int
+
+const (
+	CommandUndefined Command = iota
+	CommandSet
+	CommandDel
+	// CommandFlush deletes every key; its event carries no key.
+	CommandFlush
+	// CommandExpire sets the TTL of an existing key without changing its value.
+	CommandExpire
+	// CommandExpired reports a key dropped because its TTL passed.
+	CommandExpired
+)
+
+type Event struct {
+	Command Command
+	Key     []byte
+	Value   []byte
+	// TTL is the expiry the command asked for, 0 when the key does not expire. The storage may
+	// shorten it (storage.WithMaxTTL); CommandExpired follows once it has passed.
+	TTL     time.Duration
+	Version uint64
+}
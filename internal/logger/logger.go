@@ -1,31 +1,74 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"syscall"
 
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func MakeFileLogger(fileName string) (*zap.Logger, error) {
+// MakeFileLogger logs entries at level and above to fileName as JSON, in addition to the
+// production config outputs.
+func MakeFileLogger(fileName string, level zapcore.Level) (*zap.Logger, error) {
 	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if err != nil {
 		return nil, fmt.Errorf("open log file: %w", err)
 	}
 
+	return build(zapcore.AddSync(f), level)
+}
+
+// MakeConsoleLogger is MakeFileLogger writing to os.Stdout. Sync does not sync stdout, which
+// fails for pipes and terminals.
+func MakeConsoleLogger(level zapcore.Level) (*zap.Logger, error) {
+	return build(zapcore.AddSync(struct{ io.Writer }{os.Stdout}), level)
+}
+
+func build(out zapcore.WriteSyncer, level zapcore.Level) (*zap.Logger, error) {
 	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(level)
 	cfg.OutputPaths = []string{}
 	cfg.DisableStacktrace = true
 	cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
 	return cfg.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
-		fileCore := zapcore.NewCore(
+		outCore := zapcore.NewCore(
 			zapcore.NewJSONEncoder(cfg.EncoderConfig),
-			zapcore.AddSync(f),
+			out,
 			cfg.Level,
 		)
 
-		return zapcore.NewTee(core, fileCore)
+		return zapcore.NewTee(core, outCore)
 	}))
 }
+
+// Sync flushes log like log.Sync, but drops the errors stdout and stderr give when they are
+// terminals or pipes, such as "sync /dev/stdout: invalid argument". Other errors are kept.
+func Sync(log *zap.Logger) error {
+	var kept error
+	for _, err := range multierr.Errors(log.Sync()) {
+		if !benignSyncError(err) {
+			kept = multierr.Append(kept, err)
+		}
+	}
+
+	return kept
+}
+
+func benignSyncError(err error) bool {
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) || pathErr.Op != "sync" {
+		return false
+	}
+
+	if pathErr.Path != os.Stdout.Name() && pathErr.Path != os.Stderr.Name() {
+		return false
+	}
+
+	return errors.Is(pathErr.Err, syscall.EINVAL) || errors.Is(pathErr.Err, syscall.ENOTTY)
+}
@@ -0,0 +1,121 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/maxm86545/concurrency_go/internal/logger"
+)
+
+func TestMakeFileLogger_Level(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	log, err := logger.MakeFileLogger(path, zapcore.WarnLevel)
+	require.NoError(t, err)
+
+	assert.False(t, log.Core().Enabled(zapcore.DebugLevel))
+	assert.False(t, log.Core().Enabled(zapcore.InfoLevel))
+	assert.True(t, log.Core().Enabled(zapcore.WarnLevel))
+
+	log.Debug("debug entry")
+	log.Info("info entry")
+	log.Warn("warn entry")
+	log.Error("error entry")
+	require.NoError(t, log.Sync())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"msg":"warn entry"`)
+	assert.Contains(t, lines[1], `"msg":"error entry"`)
+}
+
+func TestMakeConsoleLogger(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	log, err := logger.MakeConsoleLogger(zapcore.InfoLevel)
+	os.Stdout = stdout
+	require.NoError(t, err)
+
+	log.Debug("debug entry")
+	log.Info("info entry", zap.String("key", "value"))
+	require.NoError(t, log.Sync(), "syncing a pipe must not fail")
+	require.NoError(t, w.Close())
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(data, &entry), "exactly one JSON entry: %s", data)
+	assert.Equal(t, "info entry", entry["msg"])
+	assert.Equal(t, "value", entry["key"])
+	assert.Regexp(t, `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`, entry["ts"], "ISO8601 time")
+	assert.NotContains(t, entry, "stacktrace")
+}
+
+type syncErrWriter struct {
+	io.Writer
+
+	err error
+}
+
+func (w syncErrWriter) Sync() error {
+	return w.err
+}
+
+func TestSync(t *testing.T) {
+	newLogger := func(out zapcore.WriteSyncer) *zap.Logger {
+		return zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), out, zapcore.InfoLevel))
+	}
+
+	t.Run("terminal stdout", func(t *testing.T) {
+		log := newLogger(syncErrWriter{
+			Writer: io.Discard,
+			err:    &os.PathError{Op: "sync", Path: os.Stdout.Name(), Err: syscall.EINVAL},
+		})
+
+		require.Error(t, log.Sync())
+		assert.NoError(t, logger.Sync(log))
+	})
+
+	t.Run("closed file", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "app.log"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		err = logger.Sync(newLogger(f))
+		require.ErrorIs(t, err, os.ErrClosed)
+	})
+
+	t.Run("benign and genuine", func(t *testing.T) {
+		genuine := errors.New("disk failure")
+		log := newLogger(zapcore.NewMultiWriteSyncer(
+			syncErrWriter{
+				Writer: io.Discard,
+				err:    &os.PathError{Op: "sync", Path: os.Stderr.Name(), Err: syscall.ENOTTY},
+			},
+			syncErrWriter{Writer: io.Discard, err: genuine},
+		))
+
+		err := logger.Sync(log)
+		require.ErrorIs(t, err, genuine)
+		assert.NotErrorIs(t, err, syscall.ENOTTY)
+	})
+}
@@ -0,0 +1,229 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/maxm86545/concurrency_go/internal/cli"
+	"github.com/maxm86545/concurrency_go/internal/database"
+)
+
+const (
+	loggerName = "network"
+
+	rejectWriteTimeout = time.Second
+)
+
+var rejectMessage = []byte("too many connections\n")
+
+type iQueryExecutor interface {
+	Exec(ctx context.Context, rawQuery []byte) database.ExecResult
+	ExecMulti(ctx context.Context, rawQuery []byte) []database.ExecResult
+}
+
+type TCPServer struct {
+	listener net.Listener
+	qe       iQueryExecutor
+	logger   *zap.Logger
+	nextID   atomic.Uint64
+	active   atomic.Int64
+
+	appOpts []cli.Option
+	hooks   ConnectionHooks
+	slots   chan struct{}
+}
+
+type ConnectionInfo struct {
+	ID         uint64
+	RemoteAddr net.Addr
+}
+
+// ConnectionHooks are called from the connection's goroutine. Each runs exactly once per
+// accepted connection; OnClose runs after the connection is closed, however it ended.
+type ConnectionHooks struct {
+	OnOpen  func(info ConnectionInfo)
+	OnClose func(info ConnectionInfo)
+}
+
+type Option func(s *TCPServer)
+
+func NewTCPServer(address string, qe iQueryExecutor, l *zap.Logger, opts ...Option) (*TCPServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	s := &TCPServer{
+		listener: listener,
+		qe:       qe,
+		logger:   l.Named(loggerName),
+		// A stray newline from a client is not worth an error it may not expect.
+		appOpts: []cli.Option{cli.WithSkipEmptyLines(true)},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// WithAppOptions configures the line protocol of every connection, which is served by a cli.App.
+// Empty lines are skipped unless these options say otherwise.
+func WithAppOptions(opts ...cli.Option) Option {
+	return func(s *TCPServer) {
+		s.appOpts = append(s.appOpts, opts...)
+	}
+}
+
+func WithConnectionHooks(hooks ConnectionHooks) Option {
+	return func(s *TCPServer) {
+		s.hooks = hooks
+	}
+}
+
+// WithMaxConnections caps how many connections are served at once; the ones accepted beyond it
+// are told so and closed. Zero or less means no limit.
+func WithMaxConnections(n int) Option {
+	return func(s *TCPServer) {
+		if n > 0 {
+			s.slots = make(chan struct{}, n)
+		} else {
+			s.slots = nil
+		}
+	}
+}
+
+func (s *TCPServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// ActiveConnections reports how many connections are being served.
+func (s *TCPServer) ActiveConnections() int64 {
+	return s.active.Load()
+}
+
+// Run accepts connections until ctx is done or the listener fails, then closes every open
+// connection and waits for its handler to return.
+func (s *TCPServer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	wg.Go(func() {
+		<-ctx.Done()
+
+		if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.logger.Warn("failed to close listener", zap.Error(err))
+		}
+	})
+
+	s.logger.Info("listening", zap.Stringer("address", s.listener.Addr()))
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("accept: %v", err)
+		}
+
+		if !s.acquire() {
+			wg.Go(func() {
+				s.reject(conn)
+			})
+
+			continue
+		}
+
+		wg.Go(func() {
+			defer s.release()
+
+			s.serve(ctx, conn)
+		})
+	}
+}
+
+func (s *TCPServer) acquire() bool {
+	if s.slots == nil {
+		return true
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *TCPServer) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+func (s *TCPServer) reject(conn net.Conn) {
+	s.logger.Warn("connection rejected: too many connections", zap.Stringer("remote", conn.RemoteAddr()))
+
+	// A client that does not read must not hold up the close.
+	if err := conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout)); err == nil {
+		if _, err := conn.Write(rejectMessage); err != nil {
+			s.logger.Debug("failed to write rejection", zap.Error(err))
+		}
+	}
+
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.logger.Warn("failed to close connection", zap.Error(err))
+	}
+}
+
+func (s *TCPServer) serve(ctx context.Context, conn net.Conn) {
+	info := ConnectionInfo{
+		ID:         s.nextID.Add(1),
+		RemoteAddr: conn.RemoteAddr(),
+	}
+
+	logger := s.logger.With(zap.Uint64("conn_id", info.ID), zap.Stringer("remote", info.RemoteAddr))
+	logger.Debug("connection accepted", zap.Int64("active", s.active.Add(1)))
+
+	if s.hooks.OnOpen != nil {
+		s.hooks.OnOpen(info)
+	}
+
+	defer func() {
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Warn("failed to close connection", zap.Error(err))
+		}
+
+		logger.Debug("connection closed", zap.Int64("active", s.active.Add(-1)))
+
+		if s.hooks.OnClose != nil {
+			s.hooks.OnClose(info)
+		}
+	}()
+
+	app, err := cli.NewCliApp(conn, conn, conn, s.qe, s.appOpts...)
+	if err != nil {
+		logger.Error("failed to create connection handler", zap.Error(err))
+
+		return
+	}
+
+	if err := app.Run(ctx); err != nil {
+		logger.Warn("connection terminated", zap.Error(err))
+	}
+}
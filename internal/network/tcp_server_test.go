@@ -0,0 +1,394 @@
+package network_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/maxm86545/concurrency_go/internal/cli"
+	"github.com/maxm86545/concurrency_go/internal/database"
+	"github.com/maxm86545/concurrency_go/internal/database/compute"
+	"github.com/maxm86545/concurrency_go/internal/database/storage"
+	"github.com/maxm86545/concurrency_go/internal/network"
+)
+
+func TestTCPServer_Responses(t *testing.T) {
+	addr := startServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "SET a 1", want: "OK"},
+		{query: "GET a", want: "1"},
+		{query: "GET missing", want: "NOT_FOUND"},
+		{query: "DEL a", want: "OK"},
+		{query: "PING", want: `parse query: unknown command: "PING"`},
+	}
+
+	for _, tt := range tests {
+		_, err := fmt.Fprintf(conn, "%s\n", tt.query)
+		require.NoError(t, err, tt.query)
+
+		assert.Equal(t, tt.want, readLine(t, reader), tt.query)
+	}
+}
+
+func TestTCPServer_Pipelining(t *testing.T) {
+	addr := startServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	_, err = fmt.Fprint(conn, "SET a 1\nSET b 2\nGET a\n")
+	require.NoError(t, err)
+
+	for _, want := range []string{"OK", "OK", "1"} {
+		assert.Equal(t, want, readLine(t, reader))
+	}
+
+	// A trailing partial command is kept as the start of the next one.
+	_, err = fmt.Fprint(conn, "GET b\nGE")
+	require.NoError(t, err)
+	assert.Equal(t, "2", readLine(t, reader))
+
+	_, err = fmt.Fprint(conn, "T a\n")
+	require.NoError(t, err)
+	assert.Equal(t, "1", readLine(t, reader))
+}
+
+func TestTCPServer_EmptyLines(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []network.Option
+		want []string
+	}{
+		{name: "ignored by default", want: []string{"1"}},
+		{
+			name: "marker",
+			opts: []network.Option{network.WithAppOptions(cli.WithEmptyLineMarker([]byte("EMPTY")))},
+			want: []string{"EMPTY", "EMPTY", "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startServer(t, tt.opts...)
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			reader := bufio.NewReader(conn)
+
+			_, err = fmt.Fprint(conn, "\r\n\nECHO 1\n")
+			require.NoError(t, err)
+
+			for _, want := range tt.want {
+				assert.Equal(t, want, readLine(t, reader))
+			}
+		})
+	}
+}
+
+func TestTCPServer_MultiQueryOrder(t *testing.T) {
+	addr := startServer(t, network.WithAppOptions(cli.WithMultiQuery(true)))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	_, err = fmt.Fprint(conn, "SETIMMUTABLE a 1\n")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", readLine(t, reader))
+
+	_, err = fmt.Fprint(conn, "SET a 1; SET b 2; SET c 3; GET b\n")
+	require.NoError(t, err)
+
+	for _, want := range []string{"set query: storage: key is immutable", "OK", "OK", "2"} {
+		assert.Equal(t, want, readLine(t, reader), "errors are answered in query order")
+	}
+}
+
+func TestTCPServer_DefaultTTL(t *testing.T) {
+	addr := startServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	other, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer other.Close()
+
+	reader := bufio.NewReader(conn)
+	otherReader := bufio.NewReader(other)
+
+	_, err = fmt.Fprint(conn, "DEFAULTTTL 30\nSET a 1\nSET b 1 EX 100\nTTL a\nTTL b\n")
+	require.NoError(t, err)
+
+	for _, want := range []string{"OK", "OK", "OK", "30", "100"} {
+		assert.Equal(t, want, readLine(t, reader))
+	}
+
+	_, err = fmt.Fprint(other, "SET c 1\nTTL c\n")
+	require.NoError(t, err)
+
+	for _, want := range []string{"OK", "-1"} {
+		assert.Equal(t, want, readLine(t, otherReader), "another connection keeps no default")
+	}
+}
+
+func TestTCPServer_NoReply(t *testing.T) {
+	addr := startServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	_, err = fmt.Fprint(conn, "NOREPLY ON\n")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", readLine(t, reader))
+
+	var writes strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&writes, "SET k%d v%d\n", i, i)
+	}
+	writes.WriteString("DEL k0\n")
+
+	_, err = fmt.Fprint(conn, writes.String())
+	require.NoError(t, err)
+
+	// The first answer after the writes is the GET's, so the writes sent no response bytes.
+	_, err = fmt.Fprint(conn, "GET k99\nGET k0\n")
+	require.NoError(t, err)
+	assert.Equal(t, "v99", readLine(t, reader))
+	assert.Equal(t, "NOT_FOUND", readLine(t, reader))
+
+	other, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer other.Close()
+
+	_, err = fmt.Fprint(other, "SET k1 changed\n")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", readLine(t, bufio.NewReader(other)), "other connections are still answered")
+}
+
+func TestTCPServer_ConcurrentClients(t *testing.T) {
+	const (
+		clients = 20
+		queries = 50
+	)
+
+	addr := startServer(t)
+
+	var wg sync.WaitGroup
+	for c := range clients {
+		wg.Go(func() {
+			conn, err := net.Dial("tcp", addr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer conn.Close()
+
+			reader := bufio.NewReader(conn)
+			for i := range queries {
+				key := fmt.Sprintf("client%d:%d", c, i)
+
+				_, err := fmt.Fprintf(conn, "SET %s %d\nGET %s\n", key, i, key)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				for _, want := range []string{"OK\n", fmt.Sprintf("%d\n", i)} {
+					line, err := reader.ReadString('\n')
+					if !assert.NoError(t, err) {
+						return
+					}
+
+					assert.Equal(t, want, line)
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+}
+
+func TestTCPServer_ConnectionHooks(t *testing.T) {
+	type event struct {
+		kind string
+		info network.ConnectionInfo
+	}
+
+	events := make(chan event, 4)
+	addr := startServer(t, network.WithConnectionHooks(network.ConnectionHooks{
+		OnOpen:  func(info network.ConnectionInfo) { events <- event{kind: "open", info: info} },
+		OnClose: func(info network.ConnectionInfo) { events <- event{kind: "close", info: info} },
+	}))
+
+	next := func() event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			require.FailNow(t, "no connection event")
+
+			return event{}
+		}
+	}
+
+	for _, wantID := range []uint64{1, 2} {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+
+		opened := next()
+		assert.Equal(t, "open", opened.kind)
+		assert.Equal(t, wantID, opened.info.ID)
+		assert.Equal(t, conn.LocalAddr().String(), opened.info.RemoteAddr.String())
+
+		// Dropping the connection mid-command is an abnormal disconnect.
+		_, err = fmt.Fprint(conn, "SET a")
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		assert.Equal(t, event{kind: "close", info: opened.info}, next())
+	}
+
+	select {
+	case e := <-events:
+		assert.Fail(t, "unexpected connection event", "%+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTCPServer_MaxConnections(t *testing.T) {
+	const maxConnections = 2
+
+	server := runServer(t, network.WithMaxConnections(maxConnections))
+	addr := server.Addr().String()
+
+	for i := range maxConnections {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// A served connection answers, so it holds its slot before the next dial.
+		_, err = fmt.Fprintf(conn, "ECHO %d\n", i)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(i), readLine(t, bufio.NewReader(conn)))
+	}
+
+	assert.Equal(t, int64(maxConnections), server.ActiveConnections())
+
+	refused, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer refused.Close()
+
+	require.NoError(t, refused.SetReadDeadline(time.Now().Add(time.Second)))
+	reader := bufio.NewReader(refused)
+	assert.Equal(t, "too many connections", readLine(t, reader))
+
+	_, err = reader.ReadByte()
+	require.ErrorIs(t, err, io.EOF, "the refused connection is closed")
+	assert.Equal(t, int64(maxConnections), server.ActiveConnections())
+}
+
+func TestTCPServer_Shutdown(t *testing.T) {
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	server, err := network.NewTCPServer("127.0.0.1:0", db, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run(ctx)
+	}()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprint(conn, "SET a 1\n")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", readLine(t, bufio.NewReader(conn)))
+
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Run did not return after cancellation")
+	}
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err, "open connections are closed on shutdown")
+
+	_, err = net.Dial("tcp", server.Addr().String())
+	require.Error(t, err, "listener is closed on shutdown")
+}
+
+func startServer(t *testing.T, opts ...network.Option) string {
+	t.Helper()
+
+	return runServer(t, opts...).Addr().String()
+}
+
+func runServer(t *testing.T, opts ...network.Option) *network.TCPServer {
+	t.Helper()
+
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage())
+
+	server, err := network.NewTCPServer("127.0.0.1:0", db, zaptest.NewLogger(t), opts...)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	return server
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+
+	return line[:len(line)-1]
+}
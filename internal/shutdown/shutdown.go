@@ -0,0 +1,59 @@
+package shutdown
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// NotifyContext is signal.NotifyContext that keeps listening once the context is done: the
+// first signal cancels it so the caller can drain, and a second one calls force, which is
+// expected to exit without waiting for the drain.
+func NotifyContext(
+	parent context.Context, force func(sig os.Signal), signals ...os.Signal,
+) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-received:
+			cancel()
+		case <-ctx.Done():
+		case <-stopped:
+			return
+		}
+
+		select {
+		case sig := <-received:
+			force(sig)
+		case <-stopped:
+		}
+	}()
+
+	var once sync.Once
+
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(received)
+			close(stopped)
+		})
+		cancel()
+	}
+}
+
+// ExitCode is the status a shell reports for a process killed by sig, 128 plus its number.
+func ExitCode(sig os.Signal) int {
+	const signalBase = 128
+
+	if s, ok := sig.(syscall.Signal); ok {
+		return signalBase + int(s)
+	}
+
+	return 1
+}
@@ -0,0 +1,61 @@
+package shutdown_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxm86545/concurrency_go/internal/shutdown"
+)
+
+func TestNotifyContext_SecondSignalForces(t *testing.T) {
+	forced := make(chan os.Signal, 1)
+	ctx, stop := shutdown.NotifyContext(context.Background(), func(sig os.Signal) {
+		forced <- sig
+	}, syscall.SIGUSR1)
+	defer stop()
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("first signal did not cancel the context")
+	}
+
+	select {
+	case <-forced:
+		t.Fatal("first signal forced the exit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The drain is in progress; the second signal aborts it.
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case sig := <-forced:
+		assert.Equal(t, syscall.SIGUSR1, sig)
+	case <-time.After(time.Second):
+		t.Fatal("second signal did not force the exit")
+	}
+}
+
+func TestNotifyContext_Stop(t *testing.T) {
+	ctx, stop := shutdown.NotifyContext(context.Background(), func(os.Signal) {
+		t.Error("force called after stop")
+	}, syscall.SIGUSR2)
+
+	stop()
+	stop()
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 130, shutdown.ExitCode(syscall.SIGINT))
+	assert.Equal(t, 143, shutdown.ExitCode(syscall.SIGTERM))
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrConnection = errors.New("client: connection error")
+	ErrNewline    = errors.New("client: values containing newlines cannot be read back")
+)
+
+var (
+	statusOK = []byte("+OK")
+	notFound = []byte("NOT_FOUND")
+)
+
+// QueryError is a failure reported by the server for a single query; the connection stays usable.
+type QueryError struct {
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return "client: query failed: " + e.Message
+}
+
+// Client turns on status lines for its connection when it connects (STATUSLINE ON), which is
+// what lets it tell values apart from error messages. Calls are serialized on one connection.
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+func Connect(addr string) (*Client, error) {
+	return ConnectContext(context.Background(), addr)
+}
+
+// ConnectContext is Connect bounded by ctx, which covers both dialing and turning on status lines.
+func ConnectContext(ctx context.Context, addr string) (*Client, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+
+	c := &Client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+
+	err = c.do(ctx, func() error {
+		if err := c.send("STATUSLINE", []byte("ON")); err != nil {
+			return err
+		}
+
+		return c.expectOK()
+	})
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("enable status lines: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *Client) Set(ctx context.Context, key, value []byte) error {
+	if bytes.IndexByte(value, '\n') >= 0 {
+		return ErrNewline
+	}
+
+	return c.do(ctx, func() error {
+		if err := c.send("SET", key, value); err != nil {
+			return err
+		}
+
+		return c.expectOK()
+	})
+}
+
+func (c *Client) Get(ctx context.Context, key []byte) ([]byte, bool, error) {
+	var (
+		value []byte
+		found bool
+	)
+
+	err := c.do(ctx, func() error {
+		if err := c.send("GET", key); err != nil {
+			return err
+		}
+
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case bytes.Equal(line, notFound):
+			return nil
+		case !bytes.Equal(line, statusOK):
+			return &QueryError{Message: string(line)}
+		}
+
+		value, err = c.readLine()
+		found = err == nil
+
+		return err
+	})
+
+	return value, found, err
+}
+
+func (c *Client) Del(ctx context.Context, key []byte) error {
+	return c.do(ctx, func() error {
+		if err := c.send("DEL", key); err != nil {
+			return err
+		}
+
+		return c.expectOK()
+	})
+}
+
+func (c *Client) Close() error {
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+
+	return nil
+}
+
+// healthy reports whether the connection is still open and has no unread data that would
+// be taken for the response to the next query.
+func (c *Client) healthy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reader.Buffered() > 0 {
+		return false
+	}
+
+	if err := c.conn.SetReadDeadline(time.Now()); err != nil {
+		return false
+	}
+
+	_, err := c.reader.Peek(1)
+
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func (c *Client) do(ctx context.Context, fn func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+
+	// Cancellation interrupts a call blocked on the connection, which is left unusable.
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		_ = c.conn.SetDeadline(time.Now())
+		close(interrupted)
+	})
+
+	err := fn()
+	if !stop() {
+		<-interrupted
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", err, ctx.Err())
+		}
+	}
+
+	return err
+}
+
+func (c *Client) send(command string, args ...[]byte) error {
+	buf := []byte(command)
+	for _, arg := range args {
+		buf = append(buf, ' ')
+		buf = appendArgument(buf, arg)
+	}
+
+	buf = append(buf, '\n')
+
+	if _, err := c.conn.Write(buf); err != nil {
+		return fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+
+	return nil
+}
+
+func (c *Client) expectOK() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(line, statusOK) {
+		return &QueryError{Message: string(line)}
+	}
+
+	return nil
+}
+
+func (c *Client) readLine() ([]byte, error) {
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+
+	return bytes.TrimSuffix(line, []byte{'\n'}), nil
+}
+
+// appendArgument quotes arg and escapes the bytes the server's parser treats specially.
+func appendArgument(buf, arg []byte) []byte {
+	if len(arg) > 0 && !bytes.ContainsFunc(arg, unicode.IsSpace) && !bytes.ContainsAny(arg, "\"\\") {
+		return append(buf, arg...)
+	}
+
+	buf = append(buf, '"')
+	for _, b := range arg {
+		switch b {
+		case '"', '\\':
+			buf = append(buf, '\\', b)
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		default:
+			buf = append(buf, b)
+		}
+	}
+
+	return append(buf, '"')
+}
@@ -0,0 +1,135 @@
+package client_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/maxm86545/concurrency_go/internal/database"
+	"github.com/maxm86545/concurrency_go/internal/database/compute"
+	"github.com/maxm86545/concurrency_go/internal/database/storage"
+	"github.com/maxm86545/concurrency_go/internal/network"
+	"github.com/maxm86545/concurrency_go/pkg/client"
+)
+
+func TestClient_EndToEnd(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := client.Connect(startServer(t))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, found, err := c.Get(ctx, []byte("k"))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	values := [][]byte{
+		[]byte("plain"),
+		[]byte("hello world"),
+		[]byte(`quote " and backslash \`),
+		[]byte("tab\there"),
+		[]byte(""),
+	}
+
+	for _, value := range values {
+		require.NoError(t, c.Set(ctx, []byte("k"), value), "%q", value)
+
+		got, found, err := c.Get(ctx, []byte("k"))
+		require.NoError(t, err, "%q", value)
+		assert.True(t, found, "%q", value)
+		assert.Equal(t, value, got, "%q", value)
+	}
+
+	require.NoError(t, c.Del(ctx, []byte("k")))
+
+	_, found, err = c.Get(ctx, []byte("k"))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.ErrorIs(t, c.Set(ctx, []byte("k"), []byte("two\nlines")), client.ErrNewline)
+}
+
+func TestClient_QueryError(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := client.Connect(startServer(t, database.WithMaxResponseSize(4)))
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Set(ctx, []byte("k"), []byte("too long")))
+
+	_, _, err = c.Get(ctx, []byte("k"))
+
+	var queryErr *client.QueryError
+	require.ErrorAs(t, err, &queryErr)
+	assert.Contains(t, queryErr.Message, "response too large")
+	require.NotErrorIs(t, err, client.ErrConnection)
+
+	require.NoError(t, c.Set(ctx, []byte("k"), []byte("ok")), "connection stays usable after a query error")
+}
+
+func TestClient_ConnectionError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	_, err = client.Connect(addr)
+	require.ErrorIs(t, err, client.ErrConnection)
+
+	c, err := client.Connect(startServer(t))
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	_, _, err = c.Get(context.Background(), []byte("k"))
+	require.ErrorIs(t, err, client.ErrConnection)
+
+	var queryErr *client.QueryError
+	assert.False(t, errors.As(err, &queryErr))
+}
+
+func TestClient_ConnectWithoutStatusLines(t *testing.T) {
+	addr, _ := startFakeServer(t, func(conn net.Conn) {
+		if _, err := bufio.NewReader(conn).ReadBytes('\n'); err != nil {
+			return
+		}
+
+		_, _ = conn.Write([]byte("parse query: unknown command: \"STATUSLINE\"\n"))
+	})
+
+	_, err := client.Connect(addr)
+
+	var queryErr *client.QueryError
+	require.ErrorAs(t, err, &queryErr)
+	assert.Equal(t, `parse query: unknown command: "STATUSLINE"`, queryErr.Message)
+}
+
+func startServer(t testing.TB, opts ...database.Option) string {
+	t.Helper()
+
+	db := database.NewDatabase(zaptest.NewLogger(t), compute.NewCompute(128), storage.NewStorage(), opts...)
+
+	// Connections keep the binary's default line protocol, without status lines.
+	server, err := network.NewTCPServer("127.0.0.1:0", db, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	return server.Addr().String()
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.uber.org/multierr"
+)
+
+const defaultPoolSize = 8
+
+var (
+	ErrPoolExhausted = errors.New("client: pool exhausted")
+	ErrPoolClosed    = errors.New("client: pool closed")
+)
+
+type PoolOption func(*Pool)
+
+// WithMaxSize limits the number of connections the pool opens at once.
+func WithMaxSize(size int) PoolOption {
+	return func(p *Pool) {
+		p.maxSize = size
+	}
+}
+
+// WithBlockWhenExhausted makes calls wait for a free connection instead of failing with
+// ErrPoolExhausted once all of them are in use.
+func WithBlockWhenExhausted(block bool) PoolOption {
+	return func(p *Pool) {
+		p.block = block
+	}
+}
+
+// Pool hands out up to a fixed number of connections to the same server, one per call,
+// so concurrent calls are not serialized the way they are on a single Client.
+type Pool struct {
+	addr    string
+	maxSize int
+	block   bool
+	slots   chan struct{}
+
+	mu     sync.Mutex
+	idle   []*Client
+	closed bool
+}
+
+func NewPool(addr string, opts ...PoolOption) (*Pool, error) {
+	p := &Pool{
+		addr:    addr,
+		maxSize: defaultPoolSize,
+		block:   true,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.maxSize < 1 {
+		return nil, fmt.Errorf("client: invalid pool size %d", p.maxSize)
+	}
+
+	p.slots = make(chan struct{}, p.maxSize)
+
+	return p, nil
+}
+
+func (p *Pool) Set(ctx context.Context, key, value []byte) error {
+	return p.with(ctx, func(c *Client) error {
+		return c.Set(ctx, key, value)
+	})
+}
+
+func (p *Pool) Get(ctx context.Context, key []byte) ([]byte, bool, error) {
+	var (
+		value []byte
+		found bool
+	)
+
+	err := p.with(ctx, func(c *Client) error {
+		var err error
+		value, found, err = c.Get(ctx, key)
+
+		return err
+	})
+
+	return value, found, err
+}
+
+func (p *Pool) Del(ctx context.Context, key []byte) error {
+	return p.with(ctx, func(c *Client) error {
+		return c.Del(ctx, key)
+	})
+}
+
+// Close closes the idle connections; the ones in use are closed when their calls return.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	var err error
+	for _, c := range p.idle {
+		err = multierr.Append(err, c.Close())
+	}
+
+	p.idle = nil
+
+	return err
+}
+
+func (p *Pool) with(ctx context.Context, fn func(c *Client) error) error {
+	c, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(c)
+	p.release(c, err)
+
+	return err
+}
+
+func (p *Pool) acquire(ctx context.Context) (*Client, error) {
+	if p.block {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else {
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			return nil, ErrPoolExhausted
+		}
+	}
+
+	c, err := p.connection(ctx)
+	if err != nil {
+		<-p.slots
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (p *Pool) connection(ctx context.Context) (*Client, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+
+		return nil, ErrPoolClosed
+	}
+
+	c := p.popHealthy()
+	p.mu.Unlock()
+
+	if c != nil {
+		return c, nil
+	}
+
+	return ConnectContext(ctx, p.addr)
+}
+
+// popHealthy pops idle connections until one passes the health check, closing the rest.
+// It returns nil when none is left; p.mu must be held.
+func (p *Pool) popHealthy() *Client {
+	for len(p.idle) > 0 {
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if c.healthy() {
+			return c
+		}
+
+		_ = c.Close()
+	}
+
+	return nil
+}
+
+// release returns c to the pool unless the call broke its connection or the pool was closed.
+func (p *Pool) release(c *Client, err error) {
+	defer func() { <-p.slots }()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || errors.Is(err, ErrConnection) {
+		_ = c.Close()
+
+		return
+	}
+
+	p.idle = append(p.idle, c)
+}
@@ -0,0 +1,224 @@
+package client_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxm86545/concurrency_go/pkg/client"
+)
+
+func TestPool_ConcurrentCalls(t *testing.T) {
+	ctx := context.Background()
+
+	pool, err := client.NewPool(startServer(t), client.WithMaxSize(4))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			key := fmt.Appendf(nil, "key%d", i)
+			value := fmt.Appendf(nil, "value %d", i)
+
+			assert.NoError(t, pool.Set(ctx, key, value))
+
+			got, found, err := pool.Get(ctx, key)
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, value, got)
+
+			assert.NoError(t, pool.Del(ctx, key))
+		})
+	}
+
+	wg.Wait()
+}
+
+func TestPool_InvalidSize(t *testing.T) {
+	_, err := client.NewPool("127.0.0.1:0", client.WithMaxSize(0))
+	require.Error(t, err)
+}
+
+func TestPool_Exhausted(t *testing.T) {
+	// The server never answers a query, so the first call holds the only connection until its deadline.
+	addr, _ := startFakeServer(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		if !acceptStatusLine(reader, conn) {
+			return
+		}
+
+		_, _ = reader.ReadBytes('\n')
+		<-t.Context().Done()
+	})
+
+	tests := []struct {
+		name  string
+		block bool
+		want  error
+	}{
+		{name: "error", block: false, want: client.ErrPoolExhausted},
+		{name: "block", block: true, want: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := client.NewPool(addr, client.WithMaxSize(1), client.WithBlockWhenExhausted(tt.block))
+			require.NoError(t, err)
+			defer pool.Close()
+
+			holdCtx, release := context.WithTimeout(context.Background(), time.Second)
+			defer release()
+
+			held := make(chan error, 1)
+			go func() {
+				_, _, err := pool.Get(holdCtx, []byte("k"))
+				held <- err
+			}()
+
+			require.Eventually(t, func() bool {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+
+				return errors.Is(pool.Set(ctx, []byte("k"), []byte("v")), tt.want)
+			}, time.Second, time.Millisecond)
+			release()
+			require.ErrorIs(t, <-held, context.Canceled)
+		})
+	}
+}
+
+func TestPool_DiscardsUnhealthyConnections(t *testing.T) {
+	// Each connection answers its first query with a stray extra line, leaving it unusable.
+	addr, accepted := startFakeServer(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		if !acceptStatusLine(reader, conn) {
+			return
+		}
+
+		if _, err := reader.ReadBytes('\n'); err != nil {
+			return
+		}
+
+		_, _ = conn.Write([]byte("+OK\n+OK\n"))
+		<-t.Context().Done()
+	})
+
+	ctx := context.Background()
+
+	pool, err := client.NewPool(addr, client.WithMaxSize(1))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	require.NoError(t, pool.Set(ctx, []byte("k"), []byte("v")))
+	require.NoError(t, pool.Set(ctx, []byte("k"), []byte("v")))
+	assert.EqualValues(t, 2, accepted.Load())
+}
+
+func TestPool_Closed(t *testing.T) {
+	pool, err := client.NewPool(startServer(t))
+	require.NoError(t, err)
+
+	require.NoError(t, pool.Set(context.Background(), []byte("k"), []byte("v")))
+	require.NoError(t, pool.Close())
+
+	require.ErrorIs(t, pool.Set(context.Background(), []byte("k"), []byte("v")), client.ErrPoolClosed)
+}
+
+func BenchmarkPool(b *testing.B) {
+	addr := startServer(b)
+
+	benchmarks := []struct {
+		name string
+		set  func(ctx context.Context, key, value []byte) error
+	}{
+		{
+			name: "single connection",
+			set: func() func(ctx context.Context, key, value []byte) error {
+				c, err := client.Connect(addr)
+				require.NoError(b, err)
+				b.Cleanup(func() { _ = c.Close() })
+
+				return c.Set
+			}(),
+		},
+		{
+			name: "pool",
+			set: func() func(ctx context.Context, key, value []byte) error {
+				pool, err := client.NewPool(addr)
+				require.NoError(b, err)
+				b.Cleanup(func() { _ = pool.Close() })
+
+				return pool.Set
+			}(),
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			ctx := context.Background()
+
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = bm.set(ctx, []byte("key"), []byte("value"))
+				}
+			})
+		})
+	}
+}
+
+func startFakeServer(t *testing.T, handle func(conn net.Conn)) (string, *atomic.Int32) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var (
+		accepted atomic.Int32
+		wg       sync.WaitGroup
+	)
+
+	wg.Go(func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			accepted.Add(1)
+
+			wg.Go(func() {
+				defer conn.Close()
+				handle(conn)
+			})
+		}
+	})
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+		wg.Wait()
+	})
+
+	return listener.Addr().String(), &accepted
+}
+
+// acceptStatusLine answers the STATUSLINE ON a client sends when it connects.
+func acceptStatusLine(reader *bufio.Reader, conn net.Conn) bool {
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		return false
+	}
+
+	_, err := conn.Write([]byte("+OK\n"))
+
+	return err == nil
+}